@@ -0,0 +1,32 @@
+// Preview the number of nodes matching the patch run selectors on each PuppetServer
+function previewNodeCounts() {
+  var params = {};
+  ['PatchWindow', 'Query', 'OSFamily', 'PuppetEnvironment', 'CertnameFilter'].forEach(function(name) {
+    params[name] = $('#patchRunForm [name="' + name + '"]').val() || '';
+  });
+  $('#NodeCounts').html('<em>Loading...</em>');
+  $.getJSON('/data/nodeCounts', params)
+    .done(function(data) {
+      var table = $('<table class="borderless"></table>');
+      $.each(data.puppet_servers, function(i, ps) {
+        var row = $('<tr></tr>');
+        row.append($('<td></td>').text(ps.puppet_server));
+        if (ps.error) {
+          row.append($('<td class="text-danger"></td>').text(ps.error));
+        } else {
+          row.append($('<td></td>').text(ps.count + ' nodes'));
+        }
+        table.append(row);
+      });
+      table.append($('<tr></tr>').append($('<th>Total</th>'), $('<th></th>').text(data.total + ' nodes')));
+      $('#NodeCounts').empty().append(table);
+    })
+    .fail(function(xhr) {
+      var message = (xhr.responseJSON && xhr.responseJSON.message) || xhr.statusText;
+      $('#NodeCounts').empty().append($('<em class="text-danger"></em>').text(message));
+    });
+}
+
+$(document).ready(function(){
+  $("#NodeCounts-Preview").click(previewNodeCounts)
+})
@@ -44,7 +44,8 @@ $(document).ready(function(){
     display: 'value',
     templates: {
       suggestion: function (data) {
-        return '<div><strong>' + data.value + '</strong> - ' + data.count + ' hosts</div>';
+        var label = data.label ? ' (' + $('<span>').text(data.label).html() + ')' : '';
+        return '<div><strong>' + data.value + '</strong>' + label + ' - ' + data.count + ' hosts</div>';
       }
     },
   })
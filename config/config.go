@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/joho/godotenv"
@@ -12,24 +13,44 @@ import (
 
 // Arguments Type
 type Arguments struct {
-	Debug          bool     `arg:"env:DEBUG" help:"enable application debug mode (more logs)"`
-	DebugDB        bool     `arg:"env:DEBUG_DB" help:"enable database debug mode (show all queries)"`
-	DebugAuth      bool     `arg:"env:DEBUG_AUTH" help:"enable authentication/authorization debug mode"`
-	TrelloAppKey   string   `default:"5a453a8d5b4ab0ae9a5746b34cc0b09e" arg:"env:TRELLO_APP_KEY" help:"Trello App Key (Identifies this App)"`
-	TrelloToken    string   `arg:"env:TRELLO_TOKEN" help:"Trello Access Token: https://trello.com/1/connect?key=5a453a8d5b4ab0ae9a5746b34cc0b09e&name=PuppetPatchingAutomation&response_type=token&scope=read,write&expiration=1day"`
-	DBType         string   `default:"sqlite3" arg:"env:DB_TYPE" help:"Database Type (eg. sqlite3, postgresql, mysql) (env: DB_TYPE)"`
-	DBHost         string   `default:"localhost" arg:"env:DB_HOST" help:"Database Host (env: DB_HOST)"`
-	DBPort         int      `default:"0" arg:"env:DB_PORT" help:"Database Port (env: DB_PORT) Default based on dbtype."`
-	DBUser         string   `default:"padb" arg:"env:DB_USER" help:"Database Username (env: DB_USER)"`
-	DBPassword     string   `default:"padb" arg:"env:DB_PASSWORD" help:"Database Password (env: DB_PASSWORD)"`
-	DBName         string   `default:"padb" arg:"env:DB_NAME" help:"Database Name (env: DB_NAME)"`
-	SessionName    string   `default:"PatchingAutomation" arg:"env:SESSION_NAME" help:"Session Name (cookie name) (env: SESSION_NAME)"`
-	SessionAuthKey string   `default:"PatchingAutomationDefaultAuthKey" arg:"env:SESSION_AUTH_KEY" help:"Session Authentication Key, should be 32 or 64 bytes (env: SESSION_AUTH_KEY)"`
-	SessionEncKey  string   `default:"PatchingAutomationDefaultEncrKey" arg:"env:SESSION_ENC_KEY" help:"Session Encrpytion Key, must be 16, 24 or 32 bytes (env: SESSION_ENC_KEY)"`
-	TrustedProxies []string `arg:"env:TRUSTED_PROXIES" help:"Trusted Proxies - to provide Client Remote IP (comma separated) (env: TRUSTED_PROXIES)"`
-	InitAdmins     []string `arg:"env:INIT_ADMINS" help:"Initial Admins - to provide initial administrative users. (comma separated) (env: INIT_ADMINS)"`
-	InitUsers      []string `arg:"env:INIT_USERS" help:"Initial Users - to provide initial authorized users (aka patchers). (comma separated) (env: INIT_USERS)"`
-	LogAudit       bool     `arg:"env:LOG_AUDIT" help:"Audit Log Authorization Messages (env: LOG_AUDIT)"`
+	Debug               bool          `arg:"env:DEBUG" help:"enable application debug mode (more logs)"`
+	DebugDB             bool          `arg:"env:DEBUG_DB" help:"enable database debug mode (show all queries)"`
+	DebugAuth           bool          `arg:"env:DEBUG_AUTH" help:"enable authentication/authorization debug mode"`
+	TrelloAppKey        string        `default:"5a453a8d5b4ab0ae9a5746b34cc0b09e" arg:"env:TRELLO_APP_KEY" help:"Trello App Key (Identifies this App)"`
+	TrelloToken         string        `arg:"env:TRELLO_TOKEN" help:"Trello Access Token (stored encrypted in the database when it is not set yet, can also be set in the WebUI): https://trello.com/1/connect?key=5a453a8d5b4ab0ae9a5746b34cc0b09e&name=PuppetPatchingAutomation&response_type=token&scope=read,write&expiration=1day"`
+	DBType              string        `default:"sqlite3" arg:"env:DB_TYPE" help:"Database Type (eg. sqlite3, postgresql, mysql) (env: DB_TYPE)"`
+	DBHost              string        `default:"localhost" arg:"env:DB_HOST" help:"Database Host (env: DB_HOST)"`
+	DBPort              int           `default:"0" arg:"env:DB_PORT" help:"Database Port (env: DB_PORT) Default based on dbtype."`
+	DBUser              string        `default:"padb" arg:"env:DB_USER" help:"Database Username (env: DB_USER)"`
+	DBPassword          string        `default:"padb" arg:"env:DB_PASSWORD" help:"Database Password (env: DB_PASSWORD)"`
+	DBName              string        `default:"padb" arg:"env:DB_NAME" help:"Database Name (env: DB_NAME)"`
+	SessionName         string        `default:"PatchingAutomation" arg:"env:SESSION_NAME" help:"Session Name (cookie name) (env: SESSION_NAME)"`
+	SessionAuthKey      string        `default:"PatchingAutomationDefaultAuthKey" arg:"env:SESSION_AUTH_KEY" help:"Session Authentication Key, should be 32 or 64 bytes (env: SESSION_AUTH_KEY)"`
+	SessionEncKey       string        `default:"PatchingAutomationDefaultEncrKey" arg:"env:SESSION_ENC_KEY" help:"Session Encrpytion Key, must be 16, 24 or 32 bytes (env: SESSION_ENC_KEY)"`
+	TrustedProxies      []string      `arg:"env:TRUSTED_PROXIES" help:"Trusted Proxies - to provide Client Remote IP (comma separated) (env: TRUSTED_PROXIES)"`
+	InitAdmins          []string      `arg:"env:INIT_ADMINS" help:"Initial Admins - to provide initial administrative users. (comma separated) (env: INIT_ADMINS)"`
+	InitUsers           []string      `arg:"env:INIT_USERS" help:"Initial Users - to provide initial authorized users (aka patchers). (comma separated) (env: INIT_USERS)"`
+	LogAudit            bool          `arg:"env:LOG_AUDIT" help:"Audit Log Authorization Messages (env: LOG_AUDIT)"`
+	AuthType            string        `default:"oidc" arg:"env:AUTH_TYPE" help:"Authentication Type (oidc, local, header) (env: AUTH_TYPE)"`
+	AuthHeader          string        `default:"X-Forwarded-User" arg:"env:AUTH_HEADER" help:"Header containing the authenticated user when AuthType is header (env: AUTH_HEADER)"`
+	AuthNameHeader      string        `arg:"env:AUTH_NAME_HEADER" help:"Optional header containing the user's display name when AuthType is header (env: AUTH_NAME_HEADER)"`
+	LocalUsers          []string      `arg:"env:LOCAL_USERS" help:"Local Users (username:password or username:bcrypthash) when AuthType is local. (comma separated) (env: LOCAL_USERS)"`
+	SecretKeys          []string      `arg:"env:SECRET_KEYS" help:"Secret Encryption Keys (keyID:base64key, 32 bytes), the first is used to encrypt, others are only used to decrypt (rotation). (comma separated) (env: SECRET_KEYS)"`
+	SecretKeyFile       string        `arg:"env:SECRET_KEY_FILE" help:"File containing Secret Encryption Keys, one keyID:base64key per line, read after SecretKeys (env: SECRET_KEY_FILE)"`
+	SecretEnvPrefix     string        `default:"PPA_SECRET_" arg:"env:SECRET_ENV_PREFIX" help:"Only environment variables with this prefix can be used in env:NAME secret references (env: SECRET_ENV_PREFIX)"`
+	SecretFileDir       string        `arg:"env:SECRET_FILE_DIR" help:"Only files in this directory can be used in file:/path secret references, file: references are disabled if not set (env: SECRET_FILE_DIR)"`
+	VaultAddr           string        `arg:"env:VAULT_ADDR" help:"Vault Address, for vault:path#key secret references (env: VAULT_ADDR)"`
+	VaultToken          string        `arg:"env:VAULT_TOKEN" help:"Vault Token, for vault:path#key secret references (env: VAULT_TOKEN)"`
+	VaultNamespace      string        `arg:"env:VAULT_NAMESPACE" help:"Vault Namespace (Vault Enterprise) (env: VAULT_NAMESPACE)"`
+	VaultSkipVerify     bool          `arg:"env:VAULT_SKIP_VERIFY" help:"Skip TLS verification of the Vault server (env: VAULT_SKIP_VERIFY)"`
+	HealthCheckInterval time.Duration `default:"0s" arg:"env:HEALTH_CHECK_INTERVAL" help:"Interval to check the connection to Puppet, Jenkins, Chat and Trello, 0 disables (i.e. 15m) (env: HEALTH_CHECK_INTERVAL)"`
+	CatalogSyncInterval time.Duration `default:"0s" arg:"env:CATALOG_SYNC_INTERVAL" help:"Interval to re-sync the Puppet tasks and plans with their Puppet Servers (flags removed ones), 0 disables (i.e. 24h) (env: CATALOG_SYNC_INTERVAL)"`
+	HealthzDependencies bool          `arg:"env:HEALTHZ_DEPENDENCIES" help:"Report the number of failed dependencies on /healthz (always 200 OK) (env: HEALTHZ_DEPENDENCIES)"`
+	ClientCacheTTL      time.Duration `default:"10m" arg:"env:CLIENT_CACHE_TTL" help:"Maximum age of cached API clients, 0 to cache until the configuration changes (env: CLIENT_CACHE_TTL)"`
+	TrelloTimeout       time.Duration `default:"30s" arg:"env:TRELLO_TIMEOUT" help:"Timeout for Trello API requests (env: TRELLO_TIMEOUT)"`
+	TrelloRetries       uint          `default:"2" arg:"env:TRELLO_RETRIES" help:"Retries for (idempotent) Trello API requests (env: TRELLO_RETRIES)"`
+	UnreportedThreshold time.Duration `default:"2h" arg:"env:UNREPORTED_THRESHOLD" help:"Nodes without a puppet report for longer than this are not ready for patching (env: UNREPORTED_THRESHOLD)"`
+	StaleNodeThreshold  time.Duration `default:"24h" arg:"env:STALE_NODE_THRESHOLD" help:"Nodes without a puppet report for longer than this are stale when verifying a patch run (env: STALE_NODE_THRESHOLD)"`
 }
 
 var args *Arguments
@@ -69,6 +90,25 @@ func (a *Arguments) Validate() (err error) {
 	if !(l == 16 || l == 24 || l == 32) {
 		err = errors.New("SessionEncKey must be 16, 24, or 32 bytes")
 	}
+
+	switch a.AuthType {
+	case "oidc":
+		// configured by OIDC_* environment variables (see oidcauth.DefaultConfig)
+	case "local":
+		if len(a.LocalUsers) == 0 {
+			log.Warn("AuthType is local, but no LocalUsers (LOCAL_USERS) were provided. Only existing users will be able to login.")
+		}
+	case "header":
+		if len(a.TrustedProxies) == 0 {
+			err = errors.Join(err, errors.New("AuthType header requires TrustedProxies (TRUSTED_PROXIES) to be set"))
+		}
+		if a.AuthHeader == "" {
+			err = errors.Join(err, errors.New("AuthType header requires AuthHeader (AUTH_HEADER) to be set"))
+		}
+	default:
+		err = errors.New("AuthType must be one of: oidc, local, header")
+	}
+
 	// if len(a.TrustedProxies) > 0 {
 	// TODO: Implement validation, TrustedProxies should "look like" IPv4 or IPv6 address or CIDR
 	// SetTrustedProxies set a list of network origins (IPv4 addresses, IPv4 CIDRs, IPv6 addresses or IPv6 CIDRs)
@@ -81,6 +121,11 @@ func (a *Arguments) Version() string {
 	return version.FormattedVersion()
 }
 
+// SetArgs replaces Args (i.e. for tests, instead of parsing the command line)
+func SetArgs(a *Arguments) {
+	args = a
+}
+
 // GetArgs returns Args
 func GetArgs() *Arguments {
 	if args == nil {
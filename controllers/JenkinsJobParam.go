@@ -55,6 +55,15 @@ func UpdateJenkinsJobParam(c *gin.Context) {
 		})
 		return
 	}
+	err = jenkinsJobParam.ValidateTemplate()
+	if err != nil {
+		log.Error("ERROR validating jenkinsJobParam template: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "ERROR validating jenkinsJobParam template: " + err.Error(),
+		})
+		return
+	}
 	err = jenkinsJobParam.Save()
 	if err != nil {
 		log.Error("ERROR SAVING jenkinsJobParam: ", err)
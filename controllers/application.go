@@ -24,6 +24,7 @@ func GetAllApplications(c *gin.Context) {
 		c.Redirect(http.StatusTemporaryRedirect, loc)
 		return
 	}
+	censorChatRooms(patchRun.ChatRooms)
 	data := gin.H{
 		"status":       "success",
 		"applications": apps,
@@ -44,7 +45,61 @@ func GetApplication(c *gin.Context) {
 	if err != nil {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "success", "application": app})
+	data := gin.H{
+		"status":      "success",
+		"application": app,
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "application-show.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, app.GetBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// ApplicationRunPuppetTask runs a PuppetTask against an Application (POST), preview a run (GET)
+// Path Params:
+// - id - Application.ID
+// - puppetServerID - PuppetServer.ID
+// - taskID - puppetTask.ID
+func ApplicationRunPuppetTask(c *gin.Context) {
+	app, puppetServer, err := getApplicationOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetTaskOnTarget(c, puppetServer, getApplicationRunTarget(app))
+}
+
+// ApplicationRunPuppetPlan runs a PuppetPlan against an Application (POST), preview a run (GET)
+// Path Params:
+// - id - Application.ID
+// - puppetServerID - PuppetServer.ID
+// - planID - puppetPlan.ID
+func ApplicationRunPuppetPlan(c *gin.Context) {
+	app, puppetServer, err := getApplicationOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetPlanOnTarget(c, puppetServer, getApplicationRunTarget(app))
+}
+
+// ApplicationBuildJenkinsJob builds a JenkinsJob for an Application (POST), preview a build (GET)
+// Path Params:
+// - id - Application.ID
+// - jobID - JenkinsJob.ID
+func ApplicationBuildJenkinsJob(c *gin.Context) {
+	app, err := getApplication(c)
+	if err != nil {
+		return
+	}
+	buildJenkinsJobOnTarget(c, &runTarget{
+		Type:        "Application",
+		ID:          app.ID,
+		Name:        app.Name,
+		Data:        app,
+		Path:        fmt.Sprintf("/application/%v", app.ID),
+		RedirectURL: fmt.Sprintf("/application/%v", app.ID),
+	})
 }
 
 // ------------------------- STANDARD PATTERN HELPERS ---------------------------------
@@ -86,3 +141,30 @@ func getApplicationByID(c *gin.Context, id uint) (app *models.Application, err e
 	}
 	return // success
 }
+
+// getApplicationOnPuppetServer returns the application, limited to the (included) servers on the puppet server
+func getApplicationOnPuppetServer(c *gin.Context) (app *models.ApplicationScope, puppetServer *models.PuppetServer, err error) {
+	application, err := getApplication(c)
+	if err != nil {
+		return
+	}
+	puppetServer, err = getRunPuppetServer(c)
+	if err != nil {
+		return
+	}
+	app = application.OnPuppetServer(puppetServer.ID)
+	return
+}
+
+// getApplicationRunTarget returns the application as the target of a PuppetTask/PuppetPlan run
+func getApplicationRunTarget(app *models.ApplicationScope) *runTarget {
+	return &runTarget{
+		Type:        "Application",
+		ID:          app.ID,
+		Name:        app.Name,
+		Data:        app,
+		Nodes:       app.GetServerList(),
+		Path:        fmt.Sprintf("/application/%v", app.ID),
+		RedirectURL: fmt.Sprintf("/application/%v", app.ID),
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -13,6 +17,11 @@ import (
 	"github.com/tjm/puppet-patching-automation/views/eventview"
 )
 
+// checkTimeout is the timeout for CheckConnection
+const checkTimeout = 10 * time.Second
+
+var errInvalidWebhookURL = errors.New("invalid WebhookURL")
+
 // Chat represents the ability to send notifications to a Chat Webhook.
 // https://chat.google.com
 type Chat struct {
@@ -20,9 +29,28 @@ type Chat struct {
 }
 
 // NewChat creates the Chat controller
-func NewChat(room *models.ChatRoom) (c *Chat) {
+// NOTE: The WebhookURL can be a reference to an external secret (env:, file:, vault:), it is resolved here
+func NewChat(room *models.ChatRoom) (c *Chat, err error) {
+	u, err := resolveWebhookURL(room)
+	if err != nil {
+		return
+	}
 	c = new(Chat)
-	c.WebhookURL = room.WebhookURL
+	c.WebhookURL = u.String()
+	return
+}
+
+// resolveWebhookURL returns the (resolved) WebhookURL of the room, which must be an http(s) URL
+func resolveWebhookURL(room *models.ChatRoom) (u *url.URL, err error) {
+	webhookURL, err := room.WebhookURL.Resolve()
+	if err != nil {
+		return
+	}
+	u, err = url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		// Do NOT return the err. It contains the URL which contains sensitive authentication data.
+		return nil, errInvalidWebhookURL
+	}
 	return
 }
 
@@ -76,3 +104,23 @@ func makeRequest(c *Chat, text string) (responseBody []byte) {
 	}
 	return
 }
+
+// CheckConnection will verify that the chat webhook host is reachable, without sending a message
+func CheckConnection(room *models.ChatRoom) (err error) {
+	u, err := resolveWebhookURL(room)
+	if err != nil {
+		return
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), checkTimeout)
+	if err != nil {
+		return
+	}
+	return conn.Close()
+}
@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+func TestResolveWebhookURL(t *testing.T) {
+	config.SetArgs(&config.Arguments{SecretEnvPrefix: "PPA_SECRET_"})
+	t.Setenv("PPA_SECRET_CHAT_WEBHOOK", "https://chat.example.com/v1/spaces/AAA/messages?key=k&token=t")
+	t.Setenv("PPA_SECRET_CHAT_INVALID", "not a url")
+	t.Setenv("DB_PASSWORD", "https://chat.example.com/secret")
+	tests := []struct {
+		webhookURL string
+		wantHost   string
+		wantErr    bool
+	}{
+		{"https://chat.example.com/v1/spaces/AAA/messages?key=k&token=t", "chat.example.com", false},
+		{"env:PPA_SECRET_CHAT_WEBHOOK", "chat.example.com", false},
+		{"env:PPA_SECRET_CHAT_INVALID", "", true},
+		{"env:PPA_SECRET_CHAT_UNSET", "", true},
+		{"env:DB_PASSWORD", "", true},  // not SecretEnvPrefix
+		{"file:/etc/passwd", "", true}, // no SecretFileDir
+		{"ftp://chat.example.com/", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.webhookURL, func(t *testing.T) {
+			u, err := resolveWebhookURL(&models.ChatRoom{WebhookURL: models.SecretString(tt.webhookURL)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && u.Host != tt.wantHost {
+				t.Errorf("host = %s, want %s", u.Host, tt.wantHost)
+			}
+		})
+	}
+}
@@ -14,6 +14,9 @@ import (
 // ListChatRooms endpoint (GET)
 func ListChatRooms(c *gin.Context) {
 	rooms := models.GetChatRooms()
+	for _, room := range rooms {
+		censorChatRoomFields(room)
+	}
 	data := gin.H{"status": "success", "rooms": rooms}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "chatRoom-list.gohtml",
@@ -30,6 +33,7 @@ func GetChatRoom(c *gin.Context) {
 	if err != nil {
 		return // error has already been logged
 	}
+	censorChatRoomFields(room)
 
 	data := gin.H{"status": "success", "room": room}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
@@ -48,11 +52,21 @@ func UpdateChatRoom(c *gin.Context) {
 		return // error has already been logged
 	}
 
+	webhookURL := room.WebhookURL
 	err = c.Bind(room)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
+	// Handle not updating WebhookURL (write-only)
+	keepSecret(&room.WebhookURL, webhookURL)
+	if room.WebhookURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errWebhookURLRequired.Error()})
+		return
+	}
+	if validateSecretReferences(c, room.WebhookURL) != nil {
+		return
+	}
 
 	// Handle DISABLE (Enable not checked)
 	if c.PostForm("Enabled") == "" {
@@ -60,6 +74,7 @@ func UpdateChatRoom(c *gin.Context) {
 	}
 
 	room.Save()
+	censorChatRoomFields(room)
 	data := gin.H{"status": "success", "room": room}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "chatRoom-success-redirect.gohtml",
@@ -89,7 +104,7 @@ func DeleteChatRoom(c *gin.Context) {
 	})
 }
 
-// TestChatRoom endpoint (GET)
+// TestChatRoom endpoint (POST) will send a test message
 // PathParams: id
 func TestChatRoom(c *gin.Context) {
 	room, err := getChatRoom(c)
@@ -97,7 +112,12 @@ func TestChatRoom(c *gin.Context) {
 		return // error has already been logged
 	}
 
-	chat := chat.NewChat(room)
+	checkChatRoom(room) // record the connection health
+	chat, err := chat.NewChat(room)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "message": "Error creating chat: " + err.Error()})
+		return
+	}
 	event := models.NewEvent(models.ActionTest)
 	event.ThreadKey = "PATestEvent"
 	chat.HandleEvent(event)
@@ -126,6 +146,7 @@ func LinkChatRoomToPatchRun(c *gin.Context) {
 		return
 	}
 
+	censorChatRooms(patchRun.ChatRooms)
 	data := gin.H{"status": "success", "patch_run_id": patchRun.ID, "ChatRooms": patchRun.ChatRooms}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "patchRun-success-redirect.gohtml",
@@ -136,7 +157,20 @@ func LinkChatRoomToPatchRun(c *gin.Context) {
 
 // linkChatRoomsToPatchRun will link the ChatRooms to the Patch Run
 func linkChatRoomsToPatchRun(c *gin.Context, patchRun *models.PatchRun) (err error) {
-	// ChatRooms
+	rooms, err := getChatRoomsFromForm(c)
+	if err != nil {
+		return
+	}
+	err = patchRun.LinkChatRooms(rooms)
+	if err != nil {
+		log.Error("Error saving patchRun: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+	}
+	return
+}
+
+// getChatRoomsFromForm will return the ChatRooms selected in the form (rooms)
+func getChatRoomsFromForm(c *gin.Context) (rooms models.ChatRooms, err error) {
 	roomIDs, err := convertSliceStringToUint(c.PostFormArray("rooms"))
 	if err != nil {
 		log.Error("Error getting []uint from rooms param: ", err)
@@ -144,16 +178,10 @@ func linkChatRoomsToPatchRun(c *gin.Context, patchRun *models.PatchRun) (err err
 		return
 	}
 	log.WithField("rooms", roomIDs).Debug("Link Chat Rooms")
-	rooms, err := models.GetChatRoomsByIDs(roomIDs)
+	rooms, err = models.GetChatRoomsByIDs(roomIDs)
 	if err != nil {
 		log.Error("Error retrieving rooms from DB: ", err)
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
-		return
-	}
-	err = patchRun.LinkChatRooms(rooms)
-	if err != nil {
-		log.Error("Error saving patchRun: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
 	}
 	return
 }
@@ -192,3 +220,17 @@ func getChatRoomByID(c *gin.Context, id uint) (room *models.ChatRoom, err error)
 	}
 	return // success
 }
+
+// censorChatRooms will censor the linked ChatRooms (i.e. PatchRun.ChatRooms)
+func censorChatRooms(rooms models.ChatRooms) {
+	for _, room := range rooms {
+		censorChatRoomFields(room)
+	}
+}
+
+func censorChatRoomFields(room *models.ChatRoom) {
+	// Censor WebhookURL parameter (sensitive, contains the key/token), references (env:, file:, vault:) are not secret
+	if room.WebhookURL != "" && !room.WebhookURL.IsReference() {
+		room.WebhookURL = censoredValue
+	}
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// showDryRun will show what would run for the (dry run) PuppetJobs: nodes, params and target PuppetServer
+func showDryRun(c *gin.Context, jobs []*models.PuppetJob) {
+	data := gin.H{
+		"status":  "dry-run",
+		"message": "Dry run recorded, nothing was patched (noop jobs were sent to the orchestrator).",
+		"jobs":    jobs,
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "puppetJob-dryRun.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
@@ -43,7 +43,62 @@ func GetEnvironment(c *gin.Context) {
 	if err != nil {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "success", "env_id": env.ID, "environment": env})
+	data := gin.H{
+		"status":      "success",
+		"env_id":      env.ID,
+		"environment": env,
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "environment-show.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, env.GetBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// EnvironmentRunPuppetTask runs a PuppetTask against an Environment (POST), preview a run (GET)
+// Path Params:
+// - id - Environment.ID
+// - puppetServerID - PuppetServer.ID
+// - taskID - puppetTask.ID
+func EnvironmentRunPuppetTask(c *gin.Context) {
+	env, puppetServer, err := getEnvironmentOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetTaskOnTarget(c, puppetServer, getEnvironmentRunTarget(env))
+}
+
+// EnvironmentRunPuppetPlan runs a PuppetPlan against an Environment (POST), preview a run (GET)
+// Path Params:
+// - id - Environment.ID
+// - puppetServerID - PuppetServer.ID
+// - planID - puppetPlan.ID
+func EnvironmentRunPuppetPlan(c *gin.Context) {
+	env, puppetServer, err := getEnvironmentOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetPlanOnTarget(c, puppetServer, getEnvironmentRunTarget(env))
+}
+
+// EnvironmentBuildJenkinsJob builds a JenkinsJob for an Environment (POST), preview a build (GET)
+// Path Params:
+// - id - Environment.ID
+// - jobID - JenkinsJob.ID
+func EnvironmentBuildJenkinsJob(c *gin.Context) {
+	env, err := getEnvironment(c)
+	if err != nil {
+		return
+	}
+	buildJenkinsJobOnTarget(c, &runTarget{
+		Type:        "Environment",
+		ID:          env.ID,
+		Name:        env.Name,
+		Data:        env,
+		Path:        fmt.Sprintf("/environment/%v", env.ID),
+		RedirectURL: fmt.Sprintf("/environment/%v", env.ID),
+	})
 }
 
 // ------------------------- STANDARD PATTERN HELPERS ---------------------------------
@@ -74,3 +129,30 @@ func getEnvironmentByID(c *gin.Context, id uint) (environment *models.Environmen
 	}
 	return // success
 }
+
+// getEnvironmentOnPuppetServer returns the environment, limited to the (included) servers on the puppet server
+func getEnvironmentOnPuppetServer(c *gin.Context) (env *models.EnvironmentScope, puppetServer *models.PuppetServer, err error) {
+	environment, err := getEnvironment(c)
+	if err != nil {
+		return
+	}
+	puppetServer, err = getRunPuppetServer(c)
+	if err != nil {
+		return
+	}
+	env = environment.OnPuppetServer(puppetServer.ID)
+	return
+}
+
+// getEnvironmentRunTarget returns the environment as the target of a PuppetTask/PuppetPlan run
+func getEnvironmentRunTarget(env *models.EnvironmentScope) *runTarget {
+	return &runTarget{
+		Type:        "Environment",
+		ID:          env.ID,
+		Name:        env.Name,
+		Data:        env,
+		Nodes:       env.GetServerList(),
+		Path:        fmt.Sprintf("/environment/%v", env.ID),
+		RedirectURL: fmt.Sprintf("/environment/%v", env.ID),
+	}
+}
@@ -9,6 +9,14 @@ var (
 	errInvalidID = errors.New("error parsing id parameter")
 	errIDLatest  = errors.New("latest id requested")
 	errIDNew     = errors.New("new")
+
+	errWebhookURLRequired        = errors.New("WebhookURL is required")
+	errPuppetCredentialsRequired = errors.New("either Token or RBACUsername (RBAC service account) is required")
+	errRBACPasswordRequired      = errors.New("RBACPassword is required with RBACUsername")
+	errPatchWindowExists         = errors.New("a patch window with that name already exists")
+	errServerExcluded            = errors.New("server is excluded from patching")
+	errNotAssociated             = errors.New("is not associated to the PuppetServer")
+	errNotForTarget              = errors.New("is not available for")
 	// errInsertFailed = errors.New("Error in the user insertion")
 	// errUpdateFailed = errors.New("Error in the user updation")
 	// errDeleteFailed = errors.New("Error in the user deletion")
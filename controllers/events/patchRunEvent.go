@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/tjm/puppet-patching-automation/controllers/chat"
 	"github.com/tjm/puppet-patching-automation/models"
@@ -17,7 +18,11 @@ func PatchRunEvent(c *gin.Context, patchRun *models.PatchRun, event *models.Even
 	event.URL = location.Get(c)
 	for _, room := range patchRun.ChatRooms {
 		if room.Enabled {
-			chat := chat.NewChat(room)
+			chat, err := chat.NewChat(room)
+			if err != nil {
+				log.WithField("chatRoom", room.Name).Error("Error creating chat: ", err)
+				continue
+			}
 			chat.HandleEvent(event)
 		}
 	}
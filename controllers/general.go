@@ -1,19 +1,25 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/tjm/puppet-patching-automation/functions"
 	"github.com/tjm/puppet-patching-automation/models"
 	"github.com/tjm/puppet-patching-automation/version"
 )
 
 var formatAllSupported = []string{gin.MIMEHTML, gin.MIMEJSON, gin.MIMEYAML, gin.MIMEXML}
 
+// censoredValue replaces secrets in responses, secrets are write-only
+const censoredValue = "[censored]"
+
 // var formatHTMLOnly = []string{gin.MIMEHTML}
 
 // GetHome endpoint (GET)
@@ -42,6 +48,25 @@ func GetPing(c *gin.Context) {
 	})
 }
 
+// keepSecret will keep the existing secret if the submitted value is blank (or the censored value)
+func keepSecret(secret *models.SecretString, existing models.SecretString) {
+	if *secret == "" || *secret == censoredValue {
+		*secret = existing
+	}
+}
+
+// validateSecretReferences will return an error (and send 400) if one of the secrets is a reference that is not allowed
+func validateSecretReferences(c *gin.Context, secrets ...models.SecretString) (err error) {
+	for _, secret := range secrets {
+		err = secret.ValidateReference()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+	}
+	return
+}
+
 // convertSliceStringToUint will convert a slice of strings to a slice of uints
 func convertSliceStringToUint(ss []string) (si []uint, err error) {
 	si = make([]uint, 0, len(ss))
@@ -80,6 +105,55 @@ func validateID(c *gin.Context, idParam string) (id uint, err error) {
 	return
 }
 
+// runTarget is the object (PatchRun, Application, Environment, Component or Server) a PuppetTask/PuppetPlan
+// or JenkinsJob is run against (for a PuppetTask/PuppetPlan, limited to the servers on a PuppetServer)
+type runTarget struct {
+	Type        string      // PuppetJob/JenkinsBuild InitiatorType
+	ID          uint        // PuppetJob/JenkinsBuild InitiatorID
+	Name        string      // for display
+	Data        interface{} // the param templates render against this
+	Nodes       []string    // included servers on the PuppetServer (PuppetTask/PuppetPlan)
+	Path        string      // path of the object, i.e. /component/1
+	RedirectURL string      // where to go back to
+	PatchRunID  uint        // PatchRun targets only, the builds in the build list of the patch run (JenkinsBuild)
+}
+
+// validateRunTarget makes sure a PuppetTask/PuppetPlan or JenkinsJob (kind) is available on the target type (isFor) and,
+// for a PuppetTask/PuppetPlan, associated to the PuppetServer it runs on (associated)
+// NOTE: The error response has been sent
+func validateRunTarget(c *gin.Context, kind string, isFor bool, associated bool, target *runTarget) (err error) {
+	if !isFor {
+		err = fmt.Errorf("%s %w %s", kind, errNotForTarget, target.Type)
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	if !associated {
+		err = fmt.Errorf("%s %w", kind, errNotAssociated)
+		log.Error(err)
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": err.Error()})
+	}
+	return
+}
+
+// isDryRun returns true if a dry run was requested (dryRun=true or the "Dry Run" action)
+func isDryRun(c *gin.Context) bool {
+	return c.Query("dryRun") == "true" || c.PostForm("dryRun") == "true" || c.PostForm("action") == "Dry Run"
+}
+
+// getSyncEnvironments returns the (code) environments to sync, the synced environments and the
+// submitted "Environments" (comma separated)
+func getSyncEnvironments(c *gin.Context, synced []string) (environments []string) {
+	environments = synced
+	for _, env := range strings.Split(c.PostForm("Environments"), ",") {
+		env = strings.TrimSpace(env)
+		if env != "" && !functions.Contains(environments, env) {
+			environments = append(environments, env)
+		}
+	}
+	return
+}
+
 func getHTMLData(c *gin.Context, breadcrumbs models.BreadCrumbs, data ...gin.H) (htmlData gin.H) {
 	breadcrumbs[len(breadcrumbs)-1].Active = true // Set last breadcrumb as "Active"
 	data = append(data, gin.H{
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/controllers/chat"
+	"github.com/tjm/puppet-patching-automation/controllers/jenkinsapi"
+	"github.com/tjm/puppet-patching-automation/controllers/puppet"
+	"github.com/tjm/puppet-patching-automation/controllers/trelloapi"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// healthCheckTimeout is the timeout for a Jenkins health check
+var healthCheckTimeout = 30 * time.Second
+
+// ListHealthChecks endpoint (GET) will show the results of the last health checks
+func ListHealthChecks(c *gin.Context) {
+	showHealthChecks(c, models.GetHealthChecks())
+}
+
+// RunHealthChecks endpoint (POST) will check all enabled integrations
+func RunHealthChecks(c *gin.Context) {
+	showHealthChecks(c, runAllHealthChecks())
+}
+
+// TestPuppetServer endpoint (POST) will test the connection to each Puppet Server API
+// PathParams: id
+func TestPuppetServer(c *gin.Context) {
+	puppetServer, err := getPuppetServer(c)
+	if err != nil {
+		return
+	}
+	checks := checkPuppetServer(puppetServer)
+	showHealthChecks(c, checks)
+}
+
+// TestJenkinsServer endpoint (POST) will test the connection to the Jenkins Server
+// PathParams: id
+func TestJenkinsServer(c *gin.Context) {
+	jenkinsServer, err := getJenkinsServer(c)
+	if err != nil {
+		return
+	}
+	checks := models.HealthChecks{checkJenkinsServer(jenkinsServer)}
+	showHealthChecks(c, checks)
+}
+
+// GetHealthz endpoint (GET)
+// basic healthcheck, reports the number of failed dependencies (from the last health checks) if HealthzDependencies is enabled
+// NOTE: This is unauthenticated, so errors are not included, see /config/health
+func GetHealthz(c *gin.Context) {
+	data := gin.H{"message": "pong"}
+	if config.GetArgs().HealthzDependencies {
+		// NOTE: /healthz is unauthenticated, so only the counts (the failed integrations are on /config/health)
+		checks := models.GetHealthChecks()
+		failed := len(checks.GetFailed())
+		data["status"] = "ok"
+		if failed > 0 {
+			data["status"] = "degraded"
+		}
+		data["checks"] = len(checks)
+		data["failed"] = failed
+	}
+	c.JSON(http.StatusOK, data)
+}
+
+// StartHealthChecks will run the health checks periodically (HealthCheckInterval), if enabled
+func StartHealthChecks() {
+	interval := config.GetArgs().HealthCheckInterval
+	if interval <= 0 {
+		return
+	}
+	log.WithField("interval", interval).Info("Starting periodic health checks")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			failed := runAllHealthChecks().GetFailed()
+			if len(failed) > 0 {
+				log.WithField("failed", len(failed)).Warn("Health checks failed, see /config/health")
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// showHealthChecks will render the health check results
+func showHealthChecks(c *gin.Context, checks models.HealthChecks) {
+	data := gin.H{"status": "success", "health_checks": checks, "failed": len(checks.GetFailed())}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "health-list.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, checks.GetBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// runAllHealthChecks will check all enabled integrations
+func runAllHealthChecks() (checks models.HealthChecks) {
+	for _, puppetServer := range models.GetEnabledPuppetServers() {
+		checks = append(checks, checkPuppetServer(puppetServer)...)
+	}
+	for _, jenkinsServer := range models.GetEnabledJenkinsServers() {
+		checks = append(checks, checkJenkinsServer(jenkinsServer))
+	}
+	rooms, err := models.GetEnabledChatRooms()
+	if err != nil {
+		log.Error("Error retrieving chat rooms: ", err)
+	}
+	for _, room := range rooms {
+		checks = append(checks, checkChatRoom(room))
+	}
+	checks = append(checks, runHealthCheck(models.HealthTargetTrello, 0, models.HealthComponentTrello, "Trello", trelloapi.CheckConnection))
+	return
+}
+
+// checkPuppetServer will check each of the PuppetServer APIs
+func checkPuppetServer(p *models.PuppetServer) models.HealthChecks {
+	return models.HealthChecks{
+		runHealthCheck(models.HealthTargetPuppetServer, p.ID, models.HealthComponentPuppetDB, p.Name, func() error {
+			return puppet.CheckPuppetDB(p)
+		}),
+		runHealthCheck(models.HealthTargetPuppetServer, p.ID, models.HealthComponentOrchestrator, p.Name, func() error {
+			return puppet.CheckOrchestrator(p)
+		}),
+		runHealthCheck(models.HealthTargetPuppetServer, p.ID, models.HealthComponentPE, p.Name, func() error {
+			return puppet.CheckPE(p)
+		}),
+	}
+}
+
+// checkJenkinsServer will check the Jenkins API
+func checkJenkinsServer(j *models.JenkinsServer) *models.HealthCheck {
+	return runHealthCheck(models.HealthTargetJenkinsServer, j.ID, models.HealthComponentJenkins, j.Name, func() (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		defer cancel()
+		_, err = jenkinsapi.Info(ctx, j)
+		return
+	})
+}
+
+// checkChatRoom will check that the ChatRoom webhook is reachable
+func checkChatRoom(room *models.ChatRoom) *models.HealthCheck {
+	return runHealthCheck(models.HealthTargetChatRoom, room.ID, models.HealthComponentChatRoom, room.Name, func() error {
+		return chat.CheckConnection(room)
+	})
+}
+
+// runHealthCheck will time the check and record the result
+func runHealthCheck(targetType string, targetID uint, component, name string, check func() error) (h *models.HealthCheck) {
+	h = models.NewHealthCheck(targetType, targetID, component)
+	start := time.Now()
+	err := redactHealthCheckError(check())
+	h.Record(name, time.Since(start), err)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"target":    targetType,
+			"name":      name,
+			"component": component,
+		}).Warn("Health check failed: ", err)
+	}
+	err = h.Save()
+	if err != nil {
+		log.Error("Error saving health check: ", err)
+	}
+	return
+}
+
+// redactHealthCheckError removes the URL of a *url.Error (only the scheme and host are kept) from the error message
+// NOTE: The error is stored and displayed, the URL can contain credentials (i.e. Trello key/token, webhook URL)
+func redactHealthCheckError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	redacted := censoredValue
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.Host != "" {
+		redacted = u.Scheme + "://" + u.Host
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), urlErr.URL, redacted))
+}
@@ -1,8 +1,8 @@
 package controllers
 
 import (
-	"bytes"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -16,16 +16,37 @@ import (
 // Path Params:
 // - id - PatchRunID
 // - jobID - JenkinsJobID
+// Form Params:
+// - waitForBuild
+// - dryRun (or action "Dry Run")
 func BuildJenkinsJob(c *gin.Context) {
-	var htmlTemplate = "patchRun-success-redirect.gohtml"
-	var data gin.H
-	var waitForBuild bool
-
-	// PatchRun
 	patchRun, err := getPatchRun(c)
 	if err != nil {
 		return
 	}
+	censorChatRooms(patchRun.ChatRooms) // the target is returned with the build (and rendered by the param templates)
+	buildJenkinsJobOnTarget(c, &runTarget{
+		Type:        "PatchRun",
+		ID:          patchRun.ID,
+		Name:        patchRun.Name,
+		Data:        patchRun,
+		Path:        fmt.Sprintf("/patchRun/%v", patchRun.ID),
+		RedirectURL: fmt.Sprintf("/patchRun/%v", patchRun.ID),
+		PatchRunID:  patchRun.ID,
+	})
+}
+
+// buildJenkinsJobOnTarget builds a job with the params rendered against the target (POST), preview a build (GET)
+// Path Params:
+// - jobID - JenkinsJobID
+// Form Params:
+// - waitForBuild
+// - dryRun (or action "Dry Run")
+func buildJenkinsJobOnTarget(c *gin.Context, target *runTarget) {
+	var htmlTemplate = "common-success-redirect.gohtml"
+	var data gin.H
+	var waitForBuild bool
+
 	// JenkinsJob
 	jobID, err := validateID(c, "jobID")
 	if err != nil {
@@ -35,6 +56,10 @@ func BuildJenkinsJob(c *gin.Context) {
 	if err != nil {
 		return
 	}
+	err = validateRunTarget(c, "job "+jenkinsJob.Name, jenkinsJob.IsFor(target.Type), true, target)
+	if err != nil {
+		return
+	}
 
 	//JenkinsServer
 	jenkinsServer, err := getJenkinsServerByID(c, jenkinsJob.JenkinsServerID)
@@ -43,10 +68,13 @@ func BuildJenkinsJob(c *gin.Context) {
 	}
 
 	// BuildParams
-	buildParams, err := getBuildParams(patchRun, jenkinsJob)
+	buildParams, err := jenkinsJob.GetParamValues(target.Data)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
+	// Password and credentials params are only sent to Jenkins (masked in the recorded build and the responses)
+	maskedParams := models.MaskSensitiveParams(buildParams, jenkinsJob.GetSensitiveParamNames(), models.SensitiveMask)
 
 	if c.Request.Method == "POST" { // BUILD
 		// Verify Job is Enabled
@@ -63,9 +91,39 @@ func BuildJenkinsJob(c *gin.Context) {
 
 		// Create jenkinsBuild and add associations
 		jenkinsBuild := models.NewJenkinsBuild()
-		jenkinsBuild.PatchRunID = patchRun.ID
+		jenkinsBuild.PatchRunID = target.PatchRunID
+		jenkinsBuild.InitiatorID = target.ID
+		jenkinsBuild.InitiatorType = target.Type
 		jenkinsBuild.JenkinsJobID = jenkinsJob.ID
 		jenkinsBuild.JenkinsServerID = jenkinsServer.ID
+		jenkinsBuild.Params = maskedParams
+
+		// Dry Run (record the build, but do not send it to Jenkins)
+		if isDryRun(c) {
+			jenkinsBuild.Name = jenkinsJob.Name
+			jenkinsBuild.Status = models.JenkinsBuildStatusDryRun
+			jenkinsBuild.DryRun = true
+			err = jenkinsBuild.Init()
+			if err != nil {
+				log.Error("Error saving build to DB: ", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error saving build to DB: " + err.Error()})
+				return
+			}
+			c.Negotiate(http.StatusOK, gin.Negotiate{
+				HTMLName: "jenkinsBuild-dryRun.gohtml",
+				Data: gin.H{
+					"status":         "dry-run",
+					"message":        "Dry run recorded, the job was not built.",
+					"jenkins_build":  jenkinsBuild,
+					"jenkins_job":    jenkinsJob,
+					"jenkins_server": jenkinsServer.Name,
+					"build_params":   maskedParams,
+					"target":         target,
+				},
+				Offered: formatAllSupported,
+			})
+			return
+		}
 		queueID, err := jenkinsapi.BuildJob(c, jenkinsServer, jenkinsJob.APIJobPath, jenkinsBuild, buildParams, waitForBuild)
 		if err != nil {
 			log.Error("Error building job: ", err)
@@ -75,18 +133,19 @@ func BuildJenkinsJob(c *gin.Context) {
 
 		data = gin.H{
 			"status":           "success",
-			"buildParams":      buildParams,
+			"redirectURL":      target.RedirectURL,
+			"buildParams":      maskedParams,
 			"jenkins_build":    jenkinsBuild,
-			"patch_run_id":     patchRun.ID,
+			"patch_run_id":     target.PatchRunID,
 			"jenkins_queue_id": queueID,
 		}
 	} else { // PREVIEW
 		htmlTemplate = "jenkinsBuild-preview.gohtml"
 		data = gin.H{
 			"status":       "preview",
-			"build_params": buildParams,
+			"build_params": maskedParams,
 			"jenkins_job":  jenkinsJob,
-			"patch_run":    patchRun,
+			"target":       target,
 		}
 	}
 
@@ -98,50 +157,6 @@ func BuildJenkinsJob(c *gin.Context) {
 
 }
 
-// getBuildParams will parse the Job Params templates and return them
-func getBuildParams(patchRun *models.PatchRun, jenkinsJob *models.JenkinsJob) (buildParams map[string]string, err error) {
-	buildParams = make(map[string]string)
-	jobParams, err := jenkinsJob.GetParams()
-	if err != nil {
-		log.Error("Error retrieving jobParams: ", err)
-		return
-	}
-
-	for _, jobParam := range jobParams {
-		if jobParam.TemplateValue == "" {
-			defaultValue, err := jobParam.GetDefaultValue()
-			if err != nil {
-				log.WithFields(log.Fields{
-					"jenkinsJob": jenkinsJob,
-					"jobParam":   jobParam,
-				}).Error("Error retrieving default value", err)
-				// NOTE: defaultValue will be ""
-			}
-			buildParams[jobParam.Name] = defaultValue
-		} else {
-			// GetTemplate
-			tpl, err := jobParam.GetTemplate()
-			if err != nil {
-				log.WithField("jenkinsJobParam", jobParam.ID).Error("Error getting template.")
-				return buildParams, err
-			}
-
-			// Execute Template
-			out := new(bytes.Buffer)
-			err = tpl.Execute(out, patchRun)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"jobName":   jenkinsJob.Name,
-					"paramName": jobParam.Name,
-					"paramID":   jobParam.ID,
-				}).Error("Error Executing Template for job: ", err)
-			}
-			buildParams[jobParam.Name] = out.String()
-		}
-	}
-	return
-}
-
 // ------------------------- STANDARD PATTERN HELPERS ---------------------------------
 
 // // getJenkinsBuild will get the id from context and return job
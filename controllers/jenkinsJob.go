@@ -62,9 +62,21 @@ func UpdateJenkinsJob(c *gin.Context) {
 	if c.PostForm("IsForApplication") == "" {
 		jenkinsJob.IsForApplication = false
 	}
+	if c.PostForm("IsForEnvironment") == "" {
+		jenkinsJob.IsForEnvironment = false
+	}
+	if c.PostForm("IsForComponent") == "" {
+		jenkinsJob.IsForComponent = false
+	}
 	if c.PostForm("IsForServer") == "" {
 		jenkinsJob.IsForServer = false
 	}
+	err = jenkinsJob.ValidateParamTemplates()
+	if err != nil {
+		log.Error("ERROR validating jenkinsJob param templates: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ERROR validating jenkinsJob param templates: " + err.Error()})
+		return
+	}
 	err = jenkinsJob.Save()
 	if err != nil {
 		log.Error("Error saving jenkinsJob: ", err)
@@ -61,8 +61,9 @@ func UpdateJenkinsServer(c *gin.Context) {
 		return
 	}
 	// Handle not updating token
-	if jenkinsServer.Token == "" {
-		jenkinsServer.Token = token
+	keepSecret(&jenkinsServer.Token, token)
+	if validateSecretReferences(c, jenkinsServer.Token) != nil {
+		return
 	}
 	// Handle DISABLE (Enable not checked)
 	if c.PostForm("Enabled") == "" {
@@ -243,8 +244,8 @@ func getJenkinsServerByID(c *gin.Context, id uint) (jenkinsServer *models.Jenkin
 }
 
 func censorJenkinsServerFields(jenkinsServer *models.JenkinsServer) {
-	// Censor Token parameter (sensitive)
-	if jenkinsServer.Token != "" {
-		jenkinsServer.Token = "[censored]"
+	// Censor Token parameter (sensitive), references (env:, file:, vault:) are not secret
+	if jenkinsServer.Token != "" && !jenkinsServer.Token.IsReference() {
+		jenkinsServer.Token = censoredValue
 	}
 }
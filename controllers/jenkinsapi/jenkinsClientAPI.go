@@ -7,28 +7,32 @@ import (
 	"github.com/bndr/gojenkins"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/tjm/puppet-patching-automation/functions"
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
-// getJenkinsClient will return the jenkins client
+// getJenkinsClient will return the (cached) jenkins client
 func getJenkinsClient(ctx context.Context, jenkinsServer *models.JenkinsServer) (apiClient *gojenkins.Jenkins, err error) {
-	if jenkinsServer.APIClient == nil {
-		apiClient = gojenkins.CreateJenkins(nil, jenkinsServer.GetURL(), jenkinsServer.Username, jenkinsServer.Token)
-		// Provide CA certificate if server is SSL and using self-signed CA certificate
-		if jenkinsServer.SSL && jenkinsServer.CACert != "" {
-			apiClient.Requester.CACert = []byte(jenkinsServer.CACert)
+	return models.GetClient(models.ClientKindJenkins, jenkinsServer.ID, jenkinsServer.GetConfigHash(), func() (apiClient *gojenkins.Jenkins, err error) {
+		// Resolve the token (it may be an env:, file: or vault: reference)
+		token, err := jenkinsServer.Token.Resolve()
+		if err != nil {
+			log.Error("ERROR getJenkinsClient resolving token: " + err.Error())
+			return
 		}
-		// ctx.Value("debug")
+		// NOTE: The CA certificate is provided by the http.Client (gojenkins does not use Requester.CACert)
+		httpClient := functions.NewHTTPClient(
+			functions.GetTLSConfig(jenkinsServer.CACert, jenkinsServer.SSLSkipVerify),
+			jenkinsServer.GetAPITimeout(),
+			jenkinsServer.APIRetries,
+		)
+		apiClient = gojenkins.CreateJenkins(httpClient, jenkinsServer.GetURL(), jenkinsServer.Username, token)
 		_, err = apiClient.Init(ctx)
 		if err != nil {
 			log.Error("ERROR getJenkinsClient: " + err.Error())
-			return
 		}
-		jenkinsServer.APIClient = apiClient
-	} else {
-		apiClient = jenkinsServer.APIClient
-	}
-	return
+		return
+	})
 }
 
 // splitPath will split the path into a job name and an array of strings for parents (for passing to GetJob)
@@ -19,7 +19,9 @@ import (
 )
 
 var (
-	errPatchRunRequired = errors.New("ERROR: Patch Window (patch_window) is required")
+	errPatchRunRequired     = errors.New("ERROR: Patch Window (patch_window) or Query (query) is required")
+	errServerNotInPatchRun  = errors.New("server is not in the patch run")
+	errInvalidSnapshotStage = errors.New("invalid snapshot stage (must be pre or post)")
 )
 
 // GetPatchRunList endpoint (GET)
@@ -43,17 +45,17 @@ func UpdatePatchRun(c *gin.Context) {
 		// Error has already been sent, just return
 		return
 	}
-	oldPatchWindow := run.PatchWindow
+	oldSelector := run.NodeSelector
 	if run.ID == 0 {
 		update = false
 	}
 	err = c.Bind(run)
 	if err != nil {
-		if run.PatchWindow == "" { // Lets get a nicer error for patch_run missing
-			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errPatchRunRequired.Error()})
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
-		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	if run.NodeSelector.IsEmpty() { // Lets get a nicer error for patch_window (or query) missing
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errPatchRunRequired.Error()})
 		return
 	}
 	err = run.Save()
@@ -61,7 +63,7 @@ func UpdatePatchRun(c *gin.Context) {
 		log.Error("Error saving patchRun: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
 	}
-	if run.PatchWindow != oldPatchWindow {
+	if run.NodeSelector != oldSelector {
 		errors := puppet.GetInventoryForPatchRun(run)
 		if len(errors) > 0 {
 			errorStrings := getErrorStrings(errors)
@@ -83,6 +85,7 @@ func UpdatePatchRun(c *gin.Context) {
 	}
 	events.PatchRunEvent(c, run, models.NewEvent(eventType))
 
+	censorChatRooms(run.ChatRooms)
 	data := gin.H{"status": "success", "patch_run_id": run.ID, "patch_run": run}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "patchRun-success-redirect.gohtml",
@@ -131,6 +134,7 @@ func GetPatchRun(c *gin.Context) {
 		// Error has already been sent, just return
 		return
 	}
+	censorChatRooms(run.ChatRooms)
 	data := gin.H{"status": "success", "patch_run": run}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "patchRun-show.gohtml",
@@ -157,6 +161,7 @@ func RunPuppetDBQuery(c *gin.Context) {
 
 	events.PatchRunEvent(c, run, models.NewEvent(models.ActionPatchRunUpdated))
 
+	censorChatRooms(run.ChatRooms)
 	data := gin.H{"status": "success", "patch_run_id": run.ID, "patch_run": run}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "patchRun-success-redirect.gohtml",
@@ -165,6 +170,328 @@ func RunPuppetDBQuery(c *gin.Context) {
 	})
 }
 
+// GetPatchRunVerification endpoint (GET) will show the results of the last verification against PuppetDB
+// - PathParams: id
+func GetPatchRunVerification(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	showPatchRunVerification(c, run, run.GetAllServers(), nil)
+}
+
+// VerifyPatchRun endpoint (POST) will re-check every server in the patch run against PuppetDB
+// - PathParams: id
+// - FormParams: autoExclude (exclude stale, deactivated and moved servers from patching)
+func VerifyPatchRun(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	autoExclude := c.PostForm("autoExclude") == "true" || c.PostForm("autoExclude") == "on"
+	servers, errs := puppet.VerifyPatchRun(run, autoExclude)
+	showPatchRunVerification(c, run, servers, errs)
+}
+
+// ExcludePatchRunServer endpoint (POST) will exclude a server from patching
+// - PathParams: id, serverID
+// - FormParams: reason
+func ExcludePatchRunServer(c *gin.Context) {
+	run, server, err := getPatchRunServer(c)
+	if err != nil {
+		return
+	}
+	reason := c.PostForm("reason")
+	if reason == "" {
+		reason = server.DriftMessage
+	}
+	server.Exclude(reason)
+	data := gin.H{"status": "success", "server": server, "redirectURL": fmt.Sprintf("/patchRun/%v/verify", run.ID)}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "common-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// IncludePatchRunServer endpoint (POST) will include a (previously excluded) server in patching
+// - PathParams: id, serverID
+func IncludePatchRunServer(c *gin.Context) {
+	run, server, err := getPatchRunServer(c)
+	if err != nil {
+		return
+	}
+	server.Include()
+	data := gin.H{"status": "success", "server": server, "redirectURL": fmt.Sprintf("/patchRun/%v/verify", run.ID)}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "common-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// GetPatchRunReadiness endpoint (GET) will show the results of the last pre-patch readiness check
+// - PathParams: id
+func GetPatchRunReadiness(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	showPatchRunReadiness(c, run, run.GetAllServers(), nil)
+}
+
+// CheckPatchRunReadiness endpoint (POST) will check every server in the patch run is ready for patching
+// - PathParams: id
+func CheckPatchRunReadiness(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	servers, errs := puppet.CheckPatchRunReadiness(run)
+	// the pre-patch snapshot is the baseline of the results, only "Take Pre-Patch Snapshot" replaces it
+	_, snapshotErrs := puppet.TakeFactSnapshots(run, models.SnapshotStagePre, false)
+	showPatchRunReadiness(c, run, servers, append(errs, snapshotErrs...))
+}
+
+// showPatchRunReadiness will render the readiness report for a patch run
+func showPatchRunReadiness(c *gin.Context, run *models.PatchRun, servers models.Servers, errs []error) {
+	censorChatRooms(run.ChatRooms)
+	data := gin.H{
+		"status":    "success",
+		"patch_run": run,
+		"servers":   servers,
+		"readiness": servers.GetReadiness(),
+	}
+	if len(errs) > 0 {
+		data["messages"] = getErrorStrings(errs)
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "patchRun-readiness.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, run.GetReadinessBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// GetPatchRunResults endpoint (GET) will show the results of the last post-patch verification
+// - PathParams: id
+func GetPatchRunResults(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	showPatchRunResults(c, run, run.GetAllServers().GetIncluded(), nil)
+}
+
+// VerifyPatchRunResults endpoint (POST) will re-read the facts for every server in the patch run and compare them to the pre-patch facts
+// - PathParams: id
+func VerifyPatchRunResults(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	servers, errs := puppet.VerifyPatchResults(run)
+	showPatchRunResults(c, run, servers, errs)
+}
+
+// showPatchRunResults will render the post-patch verification results for a patch run
+func showPatchRunResults(c *gin.Context, run *models.PatchRun, servers models.Servers, errs []error) {
+	flagged := make(map[string]int)
+	for _, server := range servers {
+		if server.PatchResult.IsFlagged() {
+			flagged[server.PatchResult.Status]++
+		}
+	}
+	censorChatRooms(run.ChatRooms)
+	data := gin.H{
+		"status":    "success",
+		"patch_run": run,
+		"servers":   servers,
+		"flagged":   flagged,
+	}
+	if len(errs) > 0 {
+		data["messages"] = getErrorStrings(errs)
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "patchRun-results.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, run.GetResultsBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// GetPatchRunSnapshots endpoint (GET) will show the fact snapshots (diffs) for the patch run
+// - PathParams: id
+// - QueryParams: certname (optional), changed (only show facts that changed)
+func GetPatchRunSnapshots(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	showPatchRunSnapshots(c, run, nil)
+}
+
+// TakePatchRunSnapshots endpoint (POST) will snapshot (replace) the facts for every server in the patch run
+// - PathParams: id, stage (pre or post)
+func TakePatchRunSnapshots(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	stage := c.Param("stage")
+	if stage != models.SnapshotStagePre && stage != models.SnapshotStagePost {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errInvalidSnapshotStage.Error()})
+		return
+	}
+	count, errs := puppet.TakeFactSnapshots(run, stage, true)
+	if len(errs) > 0 {
+		showPatchRunSnapshots(c, run, errs)
+		return
+	}
+	data := gin.H{"status": "success", "snapshots": count, "redirectURL": fmt.Sprintf("/patchRun/%v/snapshots", run.ID)}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "common-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// showPatchRunSnapshots will render the fact snapshots (diffs) for a patch run (with the errors, if any)
+func showPatchRunSnapshots(c *gin.Context, run *models.PatchRun, errs []error) {
+	snapshots := run.GetFactSnapshots(c.Query("certname"))
+	diffs := getFactDiffs(c, snapshots)
+	censorChatRooms(run.ChatRooms)
+	data := gin.H{
+		"status":    "success",
+		"patch_run": run,
+		"certname":  c.Query("certname"),
+		"changed":   c.Query("changed") == "true",
+		"stages":    snapshots.GetStages(),
+		"diffs":     diffs,
+	}
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusInternalServerError
+		data["status"] = "error"
+		data["messages"] = getErrorStrings(errs)
+	}
+	c.Negotiate(code, gin.Negotiate{
+		HTMLName: "patchRun-snapshots.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, run.GetSnapshotsBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// GetPatchRunSnapshotCSV endpoint (GET) will export the fact snapshots (diffs) for the patch run
+// - PathParams: id
+// - QueryParams: certname (optional), changed (only export facts that changed)
+func GetPatchRunSnapshotCSV(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	diffs := getFactDiffs(c, run.GetFactSnapshots(c.Query("certname")))
+	output, _ := views.OutputFactSnapshotCSV(diffs)
+	contentLength := int64(output.Len())
+	fileName := functions.SanitizeFilename(run.Name+"-snapshots-"+functions.FormatAsISO8601NoSpace(time.Now())+".csv", false)
+	headers := map[string]string{
+		"Content-Disposition": `attachment; filename="` + fileName + `"`,
+	}
+	c.DataFromReader(http.StatusOK, contentLength, "text/csv", output, headers)
+}
+
+// getFactDiffs returns the fact diffs from the snapshots (only the facts that changed when QueryParam changed is true)
+func getFactDiffs(c *gin.Context, snapshots models.FactSnapshots) (diffs []*models.FactDiff) {
+	diffs = snapshots.GetDiffs()
+	if c.Query("changed") != "true" {
+		return
+	}
+	changed := make([]*models.FactDiff, 0)
+	for _, diff := range diffs {
+		if diff.Changed {
+			changed = append(changed, diff)
+		}
+	}
+	return changed
+}
+
+// showPatchRunVerification will render the verification results (servers) for a patch run
+func showPatchRunVerification(c *gin.Context, run *models.PatchRun, servers models.Servers, errs []error) {
+	drifted, excluded := make(map[string]int), 0
+	for _, server := range servers {
+		if server.HasDrift() {
+			drifted[server.DriftStatus]++
+		}
+		if server.Excluded {
+			excluded++
+		}
+	}
+	censorChatRooms(run.ChatRooms)
+	data := gin.H{
+		"status":    "success",
+		"patch_run": run,
+		"servers":   servers,
+		"drifted":   drifted,
+		"excluded":  excluded,
+	}
+	if len(errs) > 0 {
+		data["messages"] = getErrorStrings(errs)
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "patchRun-verify.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, run.GetVerifyBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// GetPatchRunPinnedPackages endpoint (GET) will list the packages that are pinned (or blocked) on the servers in the patch run
+// - PathParams: id
+func GetPatchRunPinnedPackages(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	censorChatRooms(run.ChatRooms)
+	data := gin.H{"status": "success", "patch_run": run, "pinned_packages": run.GetPinnedPackages()}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "patchRun-pinnedPackages.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, run.GetPinnedPackagesBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// GetPatchRunPackages endpoint (GET) will show the package × server matrix of the package updates in the patch run
+// - PathParams: id
+// - QueryParams: package (search)
+func GetPatchRunPackages(c *gin.Context) {
+	run, err := getPatchRun(c)
+	if err != nil {
+		// Error has already been sent, just return
+		return
+	}
+	censorChatRooms(run.ChatRooms)
+	data := gin.H{"status": "success", "patch_run": run, "search": c.Query("package"), "matrix": run.GetPackageMatrix(c.Query("package"))}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "patchRun-packages.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, run.GetPackagesBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
 // GetServerList endpoint
 // PathParams: patchid
 func GetServerList(c *gin.Context) {
@@ -213,6 +540,32 @@ func GetAppsEnvs(c *gin.Context) {
 	c.String(http.StatusOK, output)
 }
 
+// PatchRunRunPuppetTask runs a PuppetTask against a PatchRun (POST), preview a run (GET)
+// Path Params:
+// - id - PatchRun.ID
+// - puppetServerID - PuppetServer.ID
+// - taskID - puppetTask.ID
+func PatchRunRunPuppetTask(c *gin.Context) {
+	run, puppetServer, err := getPatchRunOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetTaskOnTarget(c, puppetServer, getPatchRunRunTarget(run))
+}
+
+// PatchRunRunPuppetPlan runs a PuppetPlan against a PatchRun (POST), preview a run (GET)
+// Path Params:
+// - id - PatchRun.ID
+// - puppetServerID - PuppetServer.ID
+// - planID - puppetPlan.ID
+func PatchRunRunPuppetPlan(c *gin.Context) {
+	run, puppetServer, err := getPatchRunOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetPlanOnTarget(c, puppetServer, getPatchRunRunTarget(run))
+}
+
 // ------------------------- STANDARD PATTERN HELPERS ---------------------------------
 
 // getPatchRun will get the id from context and return job
@@ -233,13 +586,37 @@ func getPatchRun(c *gin.Context) (patchRun *models.PatchRun, err error) {
 			return nil, errIDLatest
 		} else if errors.Is(err, errIDNew) {
 			patchRun = models.NewPatchRun()
-			err = nil
+			err = prefillPatchRun(c, patchRun)
 		}
 		return
 	}
 	return getPatchRunByID(c, id)
 }
 
+// getPatchRunServer will get the patch run (id) and server (serverID) from context, the server must be in the patch run
+func getPatchRunServer(c *gin.Context) (patchRun *models.PatchRun, server *models.Server, err error) {
+	patchRun, err = getPatchRun(c)
+	if err != nil {
+		return
+	}
+	serverID, err := validateID(c, "serverID")
+	if err != nil {
+		return
+	}
+	server, err = getServerByID(c, serverID)
+	if err != nil {
+		return
+	}
+	for _, s := range patchRun.GetAllServers() {
+		if s.ID == server.ID {
+			return // success
+		}
+	}
+	err = errServerNotInPatchRun
+	c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+	return
+}
+
 // getPatchRunByID retrives the patchRun from the DB
 func getPatchRunByID(c *gin.Context, id uint) (patchRun *models.PatchRun, err error) {
 	// Get PatchRun from DB
@@ -258,3 +635,31 @@ func getPatchRunByID(c *gin.Context, id uint) (patchRun *models.PatchRun, err er
 	}
 	return // success
 }
+
+// getPatchRunOnPuppetServer returns the patch run, limited to the (included) servers on the puppet server
+func getPatchRunOnPuppetServer(c *gin.Context) (run *models.PatchRunScope, puppetServer *models.PuppetServer, err error) {
+	patchRun, err := getPatchRun(c)
+	if err != nil {
+		return
+	}
+	puppetServer, err = getRunPuppetServer(c)
+	if err != nil {
+		return
+	}
+	run = patchRun.OnPuppetServer(puppetServer.ID)
+	return
+}
+
+// getPatchRunRunTarget returns the patch run as the target of a PuppetTask/PuppetPlan run
+func getPatchRunRunTarget(run *models.PatchRunScope) *runTarget {
+	censorChatRooms(run.ChatRooms) // the target is returned with the job (and rendered by the param templates)
+	return &runTarget{
+		Type:        "PatchRun",
+		ID:          run.ID,
+		Name:        run.Name,
+		Data:        run,
+		Nodes:       run.GetServerList(),
+		Path:        fmt.Sprintf("/patchRun/%v", run.ID),
+		RedirectURL: fmt.Sprintf("/patchRun/%v", run.ID),
+	}
+}
@@ -1,48 +1,273 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/gin-gonic/gin"
-	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 
 	"github.com/tjm/puppet-patching-automation/controllers/puppet"
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
+// patchWindowValue is a discovered patch window fact value (for the patch window typeahead)
+type patchWindowValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+	Label string `json:"label,omitempty"`
+}
+
 // GetPatchWindows endpoint (GET)
 func GetPatchWindows(c *gin.Context) {
-	patchWindows := make(map[string]puppetdb.Fact)
-	// var errors []error
+	counts, _ := getPatchWindowCounts()
+
+	// Add labels from the catalog
+	labels := make(map[string]string)
+	for _, w := range models.GetPatchWindows() {
+		labels[w.Name] = w.Label
+	}
+
+	list := make([]patchWindowValue, 0)
+	for value, count := range counts {
+		list = append(list, patchWindowValue{Value: value, Count: count, Label: labels[value]})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Value < list[j].Value })
+
+	//data := gin.H{"status": "success", "patch_windows": list}
+	// TODO: return errors list if they are there and maybe think about a partial success return code?
+	c.JSON(http.StatusOK, list)
+}
+
+// GetNodeCounts endpoint (GET) will preview the number of nodes matching a NodeSelector on each PuppetServer
+// QueryParams: PatchWindow, Query, OSFamily, PuppetEnvironment, CertnameFilter
+func GetNodeCounts(c *gin.Context) {
+	var selector models.NodeSelector
+	err := c.ShouldBindQuery(&selector)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	if selector.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errPatchRunRequired.Error()})
+		return
+	}
+	counts, total := puppet.CountNodes(selector)
+	c.JSON(http.StatusOK, gin.H{"status": "success", "total": total, "puppet_servers": counts})
+}
 
+// ListPatchWindowCatalog endpoint (GET)
+func ListPatchWindowCatalog(c *gin.Context) {
+	showPatchWindowCatalog(c, models.GetPatchWindows())
+}
+
+// SyncPatchWindowCatalog endpoint (POST) will sync the catalog with the patch window fact values from PuppetDB
+func SyncPatchWindowCatalog(c *gin.Context) {
+	counts, errs := getPatchWindowCounts()
+	if len(errs) > 0 {
+		// Do not mark patch windows unused when a PuppetDB could not be queried
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "messages": getErrorStrings(errs)})
+		return
+	}
+	added, err := models.SyncPatchWindows(counts)
+	if err != nil {
+		log.Error("Error syncing patch windows: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	log.WithFields(log.Fields{"discovered": len(counts), "added": added}).Info("Synced patch window catalog")
+	showPatchWindowCatalog(c, models.GetPatchWindows())
+}
+
+// GetPatchWindow endpoint (GET)
+// PathParams: id
+func GetPatchWindow(c *gin.Context) {
+	window, err := getPatchWindow(c)
+	if err != nil {
+		return // error has already been logged
+	}
+	censorChatRooms(window.ChatRooms)
+	data := gin.H{"status": "success", "patch_window": window}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "patchWindow-show.gohtml",
+		HTMLData: getHTMLData(c, window.GetBreadCrumbs(), data),
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// UpdatePatchWindow endpoint (PUT)
+// - PathParams: id
+func UpdatePatchWindow(c *gin.Context) {
+	window, err := getPatchWindow(c)
+	if err != nil {
+		return // error has already been logged
+	}
+	err = c.Bind(window)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	existing, err := models.GetPatchWindowByName(window.Name)
+	if err == nil && existing.ID != window.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errPatchWindowExists.Error()})
+		return
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	rooms, err := getChatRoomsFromForm(c)
+	if err != nil {
+		return // error has already been sent
+	}
+
+	// Saving a discovered patch window adds it to the catalog
+	window.Discovered = false
+	if window.ID == 0 {
+		err = window.Init()
+	} else {
+		err = window.Save()
+	}
+	if err == nil {
+		err = window.LinkChatRooms(rooms)
+	}
+	if err != nil {
+		log.Error("Error saving patch window: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	censorChatRooms(rooms)
+	data := gin.H{"status": "success", "patch_window": window, "redirectURL": fmt.Sprintf("/config/patchWindow/%v", window.ID)}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "common-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// DeletePatchWindow endpoint (DELETE)
+// - PathParams: id
+func DeletePatchWindow(c *gin.Context) {
+	window, err := getPatchWindow(c)
+	if err != nil {
+		return // error has already been logged
+	}
+	err = window.Delete(true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	data := gin.H{"status": "success", "message": "Deleted", "redirectURL": "/config/patchWindow"}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "common-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// showPatchWindowCatalog will render the patch window catalog
+func showPatchWindowCatalog(c *gin.Context, windows models.PatchWindows) {
+	unknown, unused := 0, 0
+	for _, w := range windows {
+		censorChatRooms(w.ChatRooms)
+		if w.IsUnknown() {
+			unknown++
+		}
+		if w.IsUnused() {
+			unused++
+		}
+	}
+	data := gin.H{"status": "success", "patch_windows": windows, "unknown": unknown, "unused": unused}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "patchWindow-list.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, windows.GetBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// getPatchWindowCounts will return the patch window fact values and node counts, combined from all enabled PuppetServers
+func getPatchWindowCounts() (counts map[string]int, errs []error) {
+	counts = make(map[string]int)
 	for _, ps := range models.GetEnabledPuppetServers() {
 		facts, err := puppet.GetPatchWindows(ps)
 		if err != nil {
 			log.Error("Error Querying Puppet Facts: ", err)
-			// errors = append(errors, err)
+			errs = append(errs, fmt.Errorf("%s: %w", ps.Name, err))
 		}
 
 		// Collect results from multiple servers combining "counts"
 		for _, fact := range facts {
-			val := fact.Value.(string)
-			if val != "" { // Exclude empty patch window values
-				if _, ok := patchWindows[val]; ok {
-					fact.Count += patchWindows[val].Count
-					patchWindows[val] = fact
-				} else {
-					patchWindows[val] = fact
-				}
+			val, ok := fact.Value.(string)
+			if ok && val != "" { // Exclude empty patch window values
+				counts[val] += fact.Count
 			}
 		}
 	}
+	return
+}
 
-	list := make([]puppetdb.Fact, 0)
-	for _, fact := range patchWindows {
-		list = append(list, fact)
+// prefillPatchRun will prefill a new PatchRun from the patch window catalog (QueryParam: patchWindowID)
+// NOTE: Times are set to the next occurrence of the patch window time slot
+func prefillPatchRun(c *gin.Context, patchRun *models.PatchRun) (err error) {
+	if c.Request.Method != http.MethodGet || c.Query("patchWindowID") == "" {
+		return
 	}
+	ids, err := convertSliceStringToUint([]string{c.Query("patchWindowID")})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errInvalidID.Error()})
+		return
+	}
+	window, err := models.GetPatchWindowByID(ids[0])
+	if err != nil {
+		log.Error("Error retrieving patch window from DB: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Error retrieving patch window from DB: " + err.Error()})
+		return
+	}
+	patchRun.PatchWindow = window.Name
+	patchRun.Description = window.GetDisplayName()
+	patchRun.ChatRooms = window.ChatRooms
+	if start, end, ok := window.NextOccurrence(patchRun.StartTime); ok {
+		patchRun.StartTime = start
+		patchRun.EndTime = end
+	}
+	return
+}
 
-	//data := gin.H{"status": "success", "patch_windows": list}
-	// TODO: return errors list if they are there and maybe think about a partial success return code?
-	c.JSON(http.StatusOK, list)
+// ------------------------- STANDARD PATTERN HELPERS ---------------------------------
+
+// getPatchWindow will get the id from context and return the patch window
+func getPatchWindow(c *gin.Context) (window *models.PatchWindow, err error) {
+	// First retrieve "id" parameter
+	id, err := validateID(c, "id")
+	if err != nil {
+		if errors.Is(err, errIDNew) {
+			window = models.NewPatchWindow()
+			err = nil
+		}
+		return
+	}
+	return getPatchWindowByID(c, id)
+}
+
+// getPatchWindowByID retrives the patch window from the DB
+func getPatchWindowByID(c *gin.Context, id uint) (window *models.PatchWindow, err error) {
+	window, err = models.GetPatchWindowByID(id)
+	if err != nil {
+		log.Error("Error retrieving patch window from DB: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Error retrieving patch window from DB: " + err.Error()})
+		return
+	}
+	// Another check to verify the patch window was retrieved, id should not be 0
+	if window.ID == 0 {
+		err = errNotExist
+		log.Error("Error patch window id should not be 0 (not found)")
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Error patch window id should not be 0 (not found)"})
+		return
+	}
+	return // success
 }
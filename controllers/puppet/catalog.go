@@ -0,0 +1,324 @@
+package puppet
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/puppetlabs/go-pe-client/pkg/orch"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// CatalogItem is a task or plan available on a PuppetServer (bulk import)
+type CatalogItem struct {
+	Name       string
+	ID         uint // PuppetTask.ID or PuppetPlan.ID, 0 if not imported yet
+	Associated bool // associated to the PuppetServer
+}
+
+// CatalogSyncResult is the result of a catalog sync
+type CatalogSyncResult struct {
+	Updated []string // updated from the API (details, params and metadata)
+	Removed []string // flagged, no longer on (one of) their PuppetServers
+	Errors  []string
+}
+
+// errCatalogListing is returned for a listing that failed before (the error is only reported once)
+var errCatalogListing = errors.New("listing failed")
+
+// catalogCache caches the task/plan names per PuppetServer and environment during a catalog sync
+type catalogCache map[string]map[string]bool
+
+// catalogSyncMutex serializes the catalog syncs (manual and periodic)
+var catalogSyncMutex sync.Mutex
+
+// matchCatalogFilter returns true if the name or its module matches one of the globs (comma separated),
+// i.e. "mymod", "mymod::*" or "pe_*,patchy" (an empty filter matches everything)
+func matchCatalogFilter(name, filter string) bool {
+	if strings.TrimSpace(filter) == "" {
+		return true
+	}
+	module, _ := splitName(name)
+	for _, glob := range strings.Split(filter, ",") {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(glob, module); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTaskCatalog returns the tasks in the environment on the PuppetServer that match the filter (sorted by name)
+func GetTaskCatalog(p *models.PuppetServer, env, filter string) (items []*CatalogItem, err error) {
+	apiTasks, err := GetTasks(p, env)
+	if err != nil {
+		return
+	}
+	associated, err := p.GetTasks()
+	if err != nil {
+		return
+	}
+	items = make([]*CatalogItem, 0)
+	for _, apiTask := range apiTasks.Items {
+		if !matchCatalogFilter(apiTask.Name, filter) {
+			continue
+		}
+		item := &CatalogItem{Name: apiTask.Name}
+		for _, task := range associated {
+			if task.Name == apiTask.Name && task.GetEnvironment() == env {
+				item.ID, item.Associated = task.ID, true
+				break
+			}
+		}
+		if item.ID == 0 {
+			var task *models.PuppetTask
+			task, err = models.GetPuppetTaskByName(apiTask.Name, env)
+			if err != nil {
+				return
+			}
+			item.ID = task.ID
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return
+}
+
+// GetPlanCatalog returns the plans in the environment on the PuppetServer that match the filter (sorted by name)
+func GetPlanCatalog(p *models.PuppetServer, env, filter string) (items []*CatalogItem, err error) {
+	apiPlans, err := GetPlans(p, env)
+	if err != nil {
+		return
+	}
+	associated, err := p.GetPlans()
+	if err != nil {
+		return
+	}
+	items = make([]*CatalogItem, 0)
+	for _, apiPlan := range apiPlans.Items {
+		if !matchCatalogFilter(apiPlan.Name, filter) {
+			continue
+		}
+		item := &CatalogItem{Name: apiPlan.Name}
+		for _, plan := range associated {
+			if plan.Name == apiPlan.Name && plan.GetEnvironment() == env {
+				item.ID, item.Associated = plan.ID, true
+				break
+			}
+		}
+		if item.ID == 0 {
+			var plan *models.PuppetPlan
+			plan, err = models.GetPuppetPlanByName(apiPlan.Name, env)
+			if err != nil {
+				return
+			}
+			item.ID = plan.ID
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return
+}
+
+// ImportTasks creates (or associates) the tasks of the environment on the PuppetServer and updates them from the API
+// NOTE: Existing tasks (same name and environment) are reused, so their param templates are kept
+func ImportTasks(p *models.PuppetServer, env string, names []string) (tasks models.PuppetTasks, errs []string) {
+	tasks = make(models.PuppetTasks, 0)
+	errs = make([]string, 0)
+	for _, name := range names {
+		task, err := models.GetPuppetTaskByName(name, env)
+		if err == nil {
+			if task.ID == 0 {
+				task = models.NewPuppetTask()
+				task.Name = name
+				task.Environment = env
+			}
+			err = UpdateTaskDetails(p, task)
+		}
+		if err != nil {
+			log.WithField("task", name).Error("Error importing task: ", err)
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return
+}
+
+// ImportPlans creates (or associates) the plans of the environment on the PuppetServer and updates them from the API
+// NOTE: Existing plans (same name and environment) are reused, so their param templates are kept
+func ImportPlans(p *models.PuppetServer, env string, names []string) (plans models.PuppetPlans, errs []string) {
+	plans = make(models.PuppetPlans, 0)
+	errs = make([]string, 0)
+	for _, name := range names {
+		plan, err := models.GetPuppetPlanByName(name, env)
+		if err == nil {
+			if plan.ID == 0 {
+				plan = models.NewPuppetPlan()
+				plan.Name = name
+				plan.Environment = env
+			}
+			err = UpdatePlanDetails(p, plan)
+		}
+		if err != nil {
+			log.WithField("plan", name).Error("Error importing plan: ", err)
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	return
+}
+
+// SyncCatalog re-syncs the tasks and plans with their (enabled) PuppetServers. The tasks/plans that are no longer
+// listed on (one of) their PuppetServers are flagged (IsNotOnServer), like the params (IsNotInTask), the others are
+// updated from the API (details, params and metadata). Only the fields from the API are saved (not the user edits).
+func SyncCatalog(tasks models.PuppetTasks, plans models.PuppetPlans) (result *CatalogSyncResult) {
+	catalogSyncMutex.Lock()
+	defer catalogSyncMutex.Unlock()
+	result = &CatalogSyncResult{Updated: make([]string, 0), Removed: make([]string, 0), Errors: make([]string, 0)}
+	cache := make(catalogCache)
+	for _, item := range tasks {
+		task, err := models.GetPuppetTaskByID(item.ID) // with the params
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("task %s: %s", item.Name, err))
+			continue
+		}
+		puppetServers, err := task.GetPuppetServers()
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("task %s: %s", task.Name, err))
+			continue
+		}
+		found, missing, checked := cache.check(puppetServers, "tasks", task.Name, task.GetEnvironment(), result)
+		if checked == 0 {
+			continue // nothing to compare with
+		}
+		notOnServer := len(missing) > 0
+		if notOnServer {
+			result.Removed = append(result.Removed, fmt.Sprintf("task %s (not on %s)", task.Name, strings.Join(missing, ", ")))
+		}
+		if task.IsNotOnServer != notOnServer {
+			err = task.SetNotOnServer(notOnServer)
+		}
+		if err == nil && found != nil {
+			err = UpdateTaskDetails(found, task) // only the fields from the API are saved
+			if err == nil {
+				result.Updated = append(result.Updated, "task "+task.Name)
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("task %s: %s", task.Name, err))
+		}
+	}
+	for _, item := range plans {
+		plan, err := models.GetPuppetPlanByID(item.ID) // with the params
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("plan %s: %s", item.Name, err))
+			continue
+		}
+		puppetServers, err := plan.GetPuppetServers()
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("plan %s: %s", plan.Name, err))
+			continue
+		}
+		found, missing, checked := cache.check(puppetServers, "plans", plan.Name, plan.GetEnvironment(), result)
+		if checked == 0 {
+			continue // nothing to compare with
+		}
+		notOnServer := len(missing) > 0
+		if notOnServer {
+			result.Removed = append(result.Removed, fmt.Sprintf("plan %s (not on %s)", plan.Name, strings.Join(missing, ", ")))
+		}
+		if plan.IsNotOnServer != notOnServer {
+			err = plan.SetNotOnServer(notOnServer)
+		}
+		if err == nil && found != nil {
+			err = UpdatePlanDetails(found, plan) // only the fields from the API are saved
+			if err == nil {
+				result.Updated = append(result.Updated, "plan "+plan.Name)
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("plan %s: %s", plan.Name, err))
+		}
+	}
+	log.WithFields(log.Fields{
+		"updated": len(result.Updated),
+		"removed": len(result.Removed),
+		"errors":  len(result.Errors),
+	}).Info("Catalog sync")
+	return
+}
+
+// check returns the first PuppetServer that lists the task/plan (kind "tasks" or "plans"), the PuppetServers that
+// do not list it and the number of PuppetServers checked (disabled or unreachable PuppetServers are skipped)
+func (cache catalogCache) check(puppetServers models.PuppetServers, kind, name, env string, result *CatalogSyncResult) (found *models.PuppetServer, missing []string, checked int) {
+	missing = make([]string, 0)
+	for _, p := range puppetServers {
+		if !p.Enabled {
+			continue
+		}
+		names, err := cache.get(p, kind, env)
+		if err != nil {
+			if !errors.Is(err, errCatalogListing) {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s on %s (%s): %s", kind, p.Name, env, err))
+			}
+			continue
+		}
+		checked++
+		if !names[name] {
+			missing = append(missing, p.Name)
+		} else if found == nil {
+			found = p
+		}
+	}
+	return
+}
+
+// get returns the task/plan names (kind "tasks" or "plans") on the PuppetServer for the environment
+// NOTE: A failed listing is cached (nil), later calls return errCatalogListing
+func (cache catalogCache) get(p *models.PuppetServer, kind, env string) (names map[string]bool, err error) {
+	key := fmt.Sprintf("%s/%d/%s", kind, p.ID, env)
+	names, ok := cache[key]
+	if ok {
+		if names == nil {
+			err = errCatalogListing
+		}
+		return
+	}
+	cache[key] = nil
+	if kind == "tasks" {
+		var apiTasks *orch.Tasks
+		apiTasks, err = GetTasks(p, env)
+		if err != nil {
+			return
+		}
+		names = make(map[string]bool)
+		for _, item := range apiTasks.Items {
+			names[item.Name] = true
+		}
+	} else {
+		var apiPlans *orch.Plans
+		apiPlans, err = GetPlans(p, env)
+		if err != nil {
+			return
+		}
+		names = make(map[string]bool)
+		for _, item := range apiPlans.Items {
+			names[item.Name] = true
+		}
+	}
+	cache[key] = names
+	return
+}
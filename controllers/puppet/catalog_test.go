@@ -0,0 +1,38 @@
+package puppet
+
+import "testing"
+
+func TestMatchCatalogFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   bool
+	}{
+		{"mymod::deploy", "", true},
+		{"mymod::deploy", " ", true},
+		{"mymod::deploy", "mymod", true},
+		{"mymod", "mymod", true}, // init task/plan
+		{"mymod::deploy", "mymod::*", true},
+		{"mymod::deploy", "mymod::deploy", true},
+		{"mymod::deploy", "mymod::dep*", true},
+		{"mymod::deploy", "mymod::rollout", false},
+		{"mymod::deploy", "othermod", false},
+		{"mymod::deploy", "my", false},
+		{"mymodule::deploy", "mymod", false},
+		{"pe_patch::patch_server", "pe_*", true},
+		{"pe_patch::patch_server", "pe_*,patchy", true},
+		{"patchy::cluster_patching", "pe_*, patchy", true},
+		{"facts::retrieve", "pe_*,patchy", false},
+		{"facts::retrieve", ",,facts", true},
+		{"facts::retrieve", "*", true},
+		{"facts::retrieve", "*::retrieve", true},
+		{"facts::retrieve", "[", false}, // invalid glob
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.filter, func(t *testing.T) {
+			if got := matchCatalogFilter(tt.name, tt.filter); got != tt.want {
+				t.Errorf("matchCatalogFilter(%q, %q) = %v, want %v", tt.name, tt.filter, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,71 +1,42 @@
 package puppet
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"strconv"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
-
-	log "github.com/sirupsen/logrus"
 )
 
-func getTLSconfig(cacert string, SSLSkipVerify bool) (config *tls.Config) {
-	// Get the SystemCertPool, continue with an empty pool on error
-	rootCAs, err := x509.SystemCertPool()
-	if err != nil {
-		log.Error("Error getting SystemCertPool:" + err.Error())
-		// continue
-	}
-	if rootCAs == nil {
-		rootCAs = x509.NewCertPool()
-	}
-	if cacert != "" {
-		// Append our cert to the system pool
-		if ok := rootCAs.AppendCertsFromPEM([]byte(cacert)); !ok {
-			log.Error("No CA certs appended")
-			// continue
-		}
+// getInterfaceValue will return an interface{} with an appropriate type for the puppetType
+// NOTE: Strings are converted based on the Puppet data type (JSON for Array, Hash and Struct),
+// returns an error if the value does not match the type. An empty value is not set (nil).
+func getInterfaceValue(puppetType string, val string) (retVal interface{}, err error) {
+	if val == "" {
+		return nil, nil // Don't set a parameter that is "" (empty)
 	}
-
-	// Trust the augmented cert pool in our client
-
-	/* #nosec G402 - SSLSkipVerify defaults to false, users are warned when switching it on. */
-	config = &tls.Config{
-		RootCAs:            rootCAs,
-		InsecureSkipVerify: SSLSkipVerify,
+	t, err := parsePuppetType(puppetType)
+	if err != nil {
+		return
 	}
-	return
+	return t.convert(val)
 }
 
-// getInterfaceValue will return an interface{} with an appropriate type for the puppetType
-// NOTE: This is *very* basic and will revert to just returning the string value by default.
-func getInterfaceValue(puppetType string, val string) (retVal interface{}) {
-	var err error
-	if val == "" {
-		return nil // Don't set a parameter that is "" (empty)
-	}
-	// Handle Optional[WHATEVER]
-	if strings.HasPrefix(puppetType, "Optional[") {
-		puppetType = strings.TrimPrefix(puppetType, "Optional[")
-		puppetType = strings.TrimSuffix(puppetType, "]")
-		return getInterfaceValue(puppetType, val)
+// ParamViolations are the params (by name) with a value that does not match their Puppet data type
+type ParamViolations map[string]string
+
+// Err returns an error listing the violations, sorted by param name (nil if there are none)
+func (v ParamViolations) Err() error {
+	if len(v) == 0 {
+		return nil
 	}
-	if puppetType == "Integer" {
-		retVal, err = strconv.Atoi(val)
-		if err != nil {
-			log.WithField("val", val).Error("Error converting to integer: ", err)
-			return nil
-		}
-		return
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
 	}
-	if puppetType == "Boolean" {
-		switch val {
-		case "yes", "true", "1":
-			return true
-		default:
-			return false
-		}
+	sort.Strings(names)
+	messages := make([]string, 0, len(v))
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("param %s %s", name, v[name]))
 	}
-	// Otherwise just return the "string" (shrug)
-	return val
+	return errors.New(strings.Join(messages, "; "))
 }
@@ -0,0 +1,105 @@
+package puppet
+
+import (
+	"strings"
+
+	"github.com/puppetlabs/go-pe-client/pkg/orch"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// commandTask will send the task request to the orchestrator and record the PuppetJob (with the sensitive params masked)
+// NOTE: A dry run is sent in noop mode if the task supports noop, otherwise it is only recorded
+func commandTask(p *models.PuppetServer, request *orch.TaskRequest, sensitive []string, parentType string, parentID uint, supportsNoop bool, dryRun bool) (job *models.PuppetJob, err error) {
+	if dryRun && !supportsNoop {
+		job, err = newDryRunJob(p)
+	} else {
+		var client *orch.Client
+		client, err = getOrchClient(p)
+		if err != nil {
+			return // already logged
+		}
+		request.Noop = dryRun
+		var jobID *orch.JobID
+		jobID, err = client.CommandTask(request)
+		if err != nil {
+			log.Error("Error CommandTask: ", err)
+			return
+		}
+		job, err = parseJobID(p, jobID)
+	}
+	job.Name = request.Task
+	job.PuppetParentType = parentType
+	job.PuppetParentID = parentID
+	job.Environment = request.Environment
+	job.Nodes = request.Scope.Nodes
+	job.Params = models.MaskSensitiveParams(request.Params, sensitive, models.SensitiveMask)
+	job.DryRun = dryRun
+	job.Noop = request.Noop
+	if saveErr := job.Save(); saveErr != nil {
+		log.Error("Error saving PuppetJob: ", saveErr)
+	}
+	// if err != nil, we have already logged an error, return it
+	return
+}
+
+// commandPlan will send the plan run request to the orchestrator and record the PuppetJob (with the sensitive params masked)
+// NOTE: Plans do not support noop, so a dry run is only recorded
+func commandPlan(p *models.PuppetServer, request *orch.PlanRunRequest, sensitive []string, nodes []string, parentType string, parentID uint, dryRun bool) (job *models.PuppetJob, err error) {
+	if dryRun {
+		job, err = newDryRunJob(p)
+	} else {
+		var client *orch.Client
+		client, err = getOrchClient(p)
+		if err != nil {
+			return // already logged
+		}
+		var jobID *orch.PlanRunJobID
+		jobID, err = client.CommandPlanRun(request)
+		if err != nil {
+			log.Error("Error CommandPlanRun: ", err)
+			return
+		}
+		job, err = parsePlanRunJobID(p, jobID)
+	}
+	job.Name = request.Name
+	job.PuppetParentType = parentType
+	job.PuppetParentID = parentID
+	job.Environment = request.Environment
+	job.Nodes = nodes
+	job.Params = models.MaskSensitiveParams(request.Params, sensitive, models.SensitiveMask)
+	job.DryRun = dryRun
+	if saveErr := job.Save(); saveErr != nil {
+		log.Error("Error saving PuppetJob: ", saveErr)
+	}
+	// if err != nil, we have already logged an error, return it
+	return
+}
+
+// newDryRunJob returns a (saved) PuppetJob for a dry run that is not sent to the orchestrator
+func newDryRunJob(p *models.PuppetServer) (job *models.PuppetJob, err error) {
+	job = models.NewPuppetJob()
+	job.Status = models.PuppetJobStatusDryRun
+	job.PuppetServerID = p.ID
+	err = job.Init()
+	if err != nil {
+		log.Error("Error saving PuppetJob: ", err)
+	}
+	return
+}
+
+// taskSupportsNoop returns true if the (built-in default) task supports noop, from the task metadata
+// NOTE: Only called for a dry run, any error is treated as no support
+func taskSupportsNoop(p *models.PuppetServer, env string, taskName string) bool {
+	nameSplit := strings.SplitN(taskName, "::", 2)
+	name := "init"
+	if len(nameSplit) > 1 {
+		name = nameSplit[1]
+	}
+	task, err := GetTask(p, env, nameSplit[0], name)
+	if err != nil || task == nil {
+		return false
+	}
+	return task.Metadata.SupportsNoop
+}
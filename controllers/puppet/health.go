@@ -0,0 +1,35 @@
+package puppet
+
+import (
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// CheckPuppetDB will verify the connection (and token) to PuppetDB with a simple query
+func CheckPuppetDB(p *models.PuppetServer) (err error) {
+	client, err := getPDBClient(p)
+	if err != nil {
+		return
+	}
+	_, err = client.Environments()
+	return
+}
+
+// CheckOrchestrator will verify the connection (and token) to the Orchestrator with a simple query
+func CheckOrchestrator(p *models.PuppetServer) (err error) {
+	client, err := getOrchClient(p)
+	if err != nil {
+		return
+	}
+	_, err = client.InventoryNode(p.Hostname)
+	return
+}
+
+// CheckPE will verify the connection (and token) to the Puppet Enterprise API with a simple query
+func CheckPE(p *models.PuppetServer) (err error) {
+	client, err := getPEClient(p)
+	if err != nil {
+		return
+	}
+	_, err = client.Environments()
+	return
+}
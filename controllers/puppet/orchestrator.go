@@ -5,24 +5,30 @@ import (
 
 	"github.com/puppetlabs/go-pe-client/pkg/orch"
 
+	"github.com/tjm/puppet-patching-automation/functions"
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
-// getOrchClient Create a Puppet Orchestrator client
+// getOrchClient returns the (cached) Puppet Orchestrator client
+// NOTE: orch.NewClient does not expose the timeout or transport, so APITimeout and APIRetries are not used
 func getOrchClient(p *models.PuppetServer) (client *orch.Client, err error) {
-	if p.OrchClient == nil {
+	// Renew the RBAC token (if needed) before the config hash is calculated
+	err = ensureToken(p)
+	if err != nil {
+		return
+	}
+	return models.GetClient(models.ClientKindOrch, p.ID, p.GetConfigHash(), func() (client *orch.Client, err error) {
 		// Validate Orchestrator URL
-		var u *url.URL
-		u, err = url.Parse(p.GetOrchURL())
+		u, err := url.Parse(p.GetOrchURL())
 		if err != nil {
 			return
 		}
-
-		client = orch.NewClient(u.String(), p.Token, getTLSconfig(p.CACert, p.SSLSkipVerify))
-		// pdb.Version() // TODO: Add some simple query to quickly "verify" that the connection is working
-		p.OrchClient = client
-	} else {
-		client = p.OrchClient
-	}
-	return
+		// Resolve the token (it may be an env:, file: or vault: reference)
+		token, err := p.Token.Resolve()
+		if err != nil {
+			return
+		}
+		client = orch.NewClient(u.String(), token, functions.GetTLSConfig(p.CACert, p.SSLSkipVerify))
+		return
+	})
 }
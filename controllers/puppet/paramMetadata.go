@@ -0,0 +1,199 @@
+package puppet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/functions"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// paramMetadata is the metadata of a task/plan parameter, including the fields the go-pe-client does not decode
+type paramMetadata struct {
+	Type         string      `json:"type"`
+	Description  string      `json:"description"`
+	Default      interface{} `json:"default"`       // tasks
+	DefaultValue interface{} `json:"default_value"` // plans
+	Sensitive    bool        `json:"sensitive"`
+}
+
+// GetDefault returns the default value as a string (JSON for non-string values) and if there is a default value
+func (m *paramMetadata) GetDefault() (value string, ok bool) {
+	def := m.Default
+	if def == nil {
+		def = m.DefaultValue
+	}
+	switch d := def.(type) {
+	case nil:
+		return "", false
+	case string:
+		return d, true
+	}
+	b, err := json.Marshal(def)
+	if err != nil {
+		return fmt.Sprint(def), true
+	}
+	return string(b), true
+}
+
+// IsRequired returns true if the param has no default value and the type does not accept undef (i.e. Optional or Variant[Undef, ...])
+// NOTE: An untyped param is Any, which accepts undef
+func (m *paramMetadata) IsRequired() bool {
+	if _, ok := m.GetDefault(); ok {
+		return false
+	}
+	t, err := parsePuppetType(m.Type)
+	if err != nil {
+		return false
+	}
+	return !t.acceptsUndef()
+}
+
+// IsSensitive returns true if the param is marked sensitive or its type is Sensitive (i.e. Sensitive[String] or Optional[Sensitive])
+func (m *paramMetadata) IsSensitive() bool {
+	if m.Sensitive {
+		return true
+	}
+	t, err := parsePuppetType(m.Type)
+	if err != nil {
+		return false
+	}
+	for t.Name == "Optional" || t.Name == "NotUndef" {
+		t = t.typeArg(0)
+	}
+	return t.Name == "Sensitive"
+}
+
+// apiMetadata is the metadata of a task or plan, as returned by the orchestrator
+type apiMetadata struct {
+	Description  string                    `json:"description"`
+	SupportsNoop bool                      `json:"supports_noop"` // tasks
+	Parameters   map[string]*paramMetadata `json:"parameters"`
+}
+
+// getParamMetadata returns the parameter metadata of a task or plan (kind "tasks" or "plans")
+func getParamMetadata(p *models.PuppetServer, kind, env, module, name string) (params map[string]*paramMetadata, err error) {
+	metadata, err := getMetadata(p, kind, env, module, name)
+	if err != nil {
+		return
+	}
+	return metadata.Parameters, nil
+}
+
+// getMetadata returns the metadata of a task or plan (kind "tasks" or "plans")
+// NOTE: This is a direct request, the go-pe-client does not decode "default", "default_value" or "sensitive".
+func getMetadata(p *models.PuppetServer, kind, env, module, name string) (metadata *apiMetadata, err error) {
+	err = ensureToken(p)
+	if err != nil {
+		return
+	}
+	token, err := p.Token.Resolve()
+	if err != nil {
+		return
+	}
+	apiURL := fmt.Sprintf("%s/orchestrator/v1/%s/%s/%s", p.GetOrchURL(), kind, url.PathEscape(module), url.PathEscape(name))
+	if env != "" {
+		apiURL += "?environment=" + url.QueryEscape(env)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.GetAPITimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Authentication", token)
+	client := functions.NewHTTPClient(functions.GetTLSConfig(p.CACert, p.SSLSkipVerify), p.GetAPITimeout(), p.APIRetries)
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s metadata returned %s: %s", kind, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		Metadata *apiMetadata `json:"metadata"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return
+	}
+	metadata = result.Metadata
+	if metadata == nil {
+		metadata = new(apiMetadata)
+	}
+	if metadata.Parameters == nil {
+		metadata.Parameters = make(map[string]*paramMetadata)
+	}
+	return
+}
+
+// splitName returns the module and the task/plan name ("init" if not set), i.e. mymod::deploy
+func splitName(name string) (module, shortName string) {
+	nameSplit := strings.SplitN(name, "::", 2)
+	module = nameSplit[0]
+	shortName = "init"
+	if len(nameSplit) > 1 {
+		shortName = nameSplit[1]
+	}
+	return
+}
+
+// syncMetadata records the metadata of a task or plan (kind "tasks" or "plans") on the PuppetServer for the environment
+// NOTE: A failed sync (i.e. the task does not exist in the environment) is recorded as the SyncError and returned
+func syncMetadata(p *models.PuppetServer, kind, parentType string, parentID uint, name, env string) (err error) {
+	module, shortName := splitName(name)
+	m := &models.PuppetMetadata{
+		PuppetParentType: parentType,
+		PuppetParentID:   parentID,
+		PuppetServerID:   p.ID,
+		Environment:      env,
+		Params:           make(map[string]*models.PuppetParamMetadata),
+	}
+	metadata, err := getMetadata(p, kind, env, module, shortName)
+	if err != nil {
+		m.SyncError = err.Error()
+	} else {
+		m.Description = metadata.Description
+		m.SupportsNoop = metadata.SupportsNoop
+		for paramName, param := range metadata.Parameters {
+			def, _ := param.GetDefault()
+			m.Params[paramName] = &models.PuppetParamMetadata{
+				Type:         param.Type,
+				Description:  param.Description,
+				DefaultValue: def,
+				IsRequired:   param.IsRequired(),
+				IsSensitive:  param.IsSensitive(),
+			}
+		}
+	}
+	saveErr := models.SetPuppetMetadata(m)
+	if saveErr != nil {
+		log.Error("Error saving PuppetMetadata: ", saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%s (%s): %w", p.Name, env, err)
+	}
+	return
+}
+
+// SyncTaskMetadata records the metadata of the task on the PuppetServer for the (code) environment
+func SyncTaskMetadata(p *models.PuppetServer, task *models.PuppetTask, env string) error {
+	return syncMetadata(p, "tasks", "Task", task.ID, task.Name, env)
+}
+
+// SyncPlanMetadata records the metadata of the plan on the PuppetServer for the (code) environment
+func SyncPlanMetadata(p *models.PuppetServer, plan *models.PuppetPlan, env string) error {
+	return syncMetadata(p, "plans", "Plan", plan.ID, plan.Name, env)
+}
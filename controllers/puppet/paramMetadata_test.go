@@ -0,0 +1,36 @@
+package puppet
+
+import "testing"
+
+func TestParamMetadata(t *testing.T) {
+	tests := []struct {
+		name          string
+		metadata      paramMetadata
+		wantRequired  bool
+		wantSensitive bool
+	}{
+		{name: "untyped", metadata: paramMetadata{}},
+		{name: "String", metadata: paramMetadata{Type: "String"}, wantRequired: true},
+		{name: "String with default", metadata: paramMetadata{Type: "String", Default: "a"}},
+		{name: "plan default_value", metadata: paramMetadata{Type: "Integer", DefaultValue: 0.0}},
+		{name: "Optional", metadata: paramMetadata{Type: "Optional[String]"}},
+		{name: "Variant with Undef", metadata: paramMetadata{Type: "Variant[Undef, String]"}},
+		{name: "Variant with Optional", metadata: paramMetadata{Type: "Variant[Integer, Optional[String]]"}},
+		{name: "Variant without Undef", metadata: paramMetadata{Type: "Variant[Integer, String]"}, wantRequired: true},
+		{name: "NotUndef", metadata: paramMetadata{Type: "NotUndef[Any]"}, wantRequired: true},
+		{name: "sensitive flag", metadata: paramMetadata{Type: "String", Sensitive: true}, wantRequired: true, wantSensitive: true},
+		{name: "Sensitive type", metadata: paramMetadata{Type: "Sensitive[String]"}, wantRequired: true, wantSensitive: true},
+		{name: "Optional Sensitive", metadata: paramMetadata{Type: "Optional[Sensitive[String]]"}, wantSensitive: true},
+		{name: "invalid type", metadata: paramMetadata{Type: "String["}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.metadata.IsRequired(); got != tt.wantRequired {
+				t.Errorf("IsRequired() = %v, want %v", got, tt.wantRequired)
+			}
+			if got := tt.metadata.IsSensitive(); got != tt.wantSensitive {
+				t.Errorf("IsSensitive() = %v, want %v", got, tt.wantSensitive)
+			}
+		})
+	}
+}
@@ -1,11 +1,11 @@
 package puppet
 
 import (
-	"fmt"
 	"net/url"
 
 	"github.com/puppetlabs/go-pe-client/pkg/pe"
 
+	"github.com/tjm/puppet-patching-automation/functions"
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
@@ -19,22 +19,26 @@ func PEEnvironments(p *models.PuppetServer) (environments []string, err error) {
 	return
 }
 
-// getPEClient Create a Puppet Enterprise client
+// getPEClient returns the (cached) Puppet Enterprise client
+// NOTE: pe.NewClient does not expose the timeout or transport, so APITimeout and APIRetries are not used
 func getPEClient(p *models.PuppetServer) (client *pe.Client, err error) {
-	if p.PEClient == nil {
-		// Validate Orchestrator URL
-		var u *url.URL
-		u, err = url.Parse(p.GetPEURL())
+	// Renew the RBAC token (if needed) before the config hash is calculated
+	err = ensureToken(p)
+	if err != nil {
+		return
+	}
+	return models.GetClient(models.ClientKindPE, p.ID, p.GetConfigHash(), func() (client *pe.Client, err error) {
+		// Validate PE URL
+		u, err := url.Parse(p.GetPEURL())
 		if err != nil {
 			return
 		}
-		fmt.Println(u)
-
-		client = pe.NewClient(u.String(), p.Token, getTLSconfig(p.CACert, p.SSLSkipVerify))
-		// pdb.Version() // TODO: Add some simple query to quickly "verify" that the connection is working
-		p.PEClient = client
-	} else {
-		client = p.PEClient
-	}
-	return
+		// Resolve the token (it may be an env:, file: or vault: reference)
+		token, err := p.Token.Resolve()
+		if err != nil {
+			return
+		}
+		client = pe.NewClient(u.String(), token, functions.GetTLSConfig(p.CACert, p.SSLSkipVerify))
+		return
+	})
 }
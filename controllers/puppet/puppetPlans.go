@@ -1,6 +1,7 @@
 package puppet
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/puppetlabs/go-pe-client/pkg/orch"
@@ -9,11 +10,13 @@ import (
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
+var errHealthCheckScriptRequired = errors.New("HealthCheckScript is required to execute ComponentPatching (Linux servers)")
+
 // PatchComponent - Patch all servers for a component
 // NOTE: Currently there are no health checks done and all servers may patch at the same time.
 // Loops through each of the servers in a component, and then tries to patch them in a group, based
 // on the puppet server they are associated to.
-func PatchComponent(component *models.Component, baseURL string) (jobs []*models.PuppetJob, err error) {
+func PatchComponent(component *models.Component, baseURL string, dryRun bool) (jobs []*models.PuppetJob, err error) {
 
 	puppetServers, serverList, err := getComponentDetails(component)
 	if err != nil {
@@ -22,19 +25,40 @@ func PatchComponent(component *models.Component, baseURL string) (jobs []*models
 
 	// Loop through each of the discovered lists of servers
 	for psid, servers := range serverList {
-		var job *models.PuppetJob
-		nodes := make([]string, 0)
-		for _, server := range servers {
-			nodes = append(nodes, server.Name)
-		}
-
-		// TODO: Figure out how to make this function reusable by only calling this if its "legacy patching"
+		var newJobs []*models.PuppetJob
 
-		job, err = runPatchPlan(puppetServers[psid], component.HealthCheckScript, nodes, baseURL)
+		// Plan bound to the "cluster patch" action on the PuppetServer (nil is the built-in default)
+		var plan *models.PuppetPlan
+		plan, err = puppetServers[psid].GetPatchPlan()
+		if err != nil {
+			log.Error("ERROR loading the patching plan in PatchComponent: ", err)
+			continue
+		}
+		if plan != nil {
+			nodes := make([]string, 0)
+			for _, server := range servers {
+				nodes = append(nodes, server.Name)
+			}
+			// Limit the servers to this puppet server for the param templates
+			target := *component
+			target.Servers = servers
+			var params map[string]string
+			params, err = plan.GetParamValues(&target)
+			if err == nil {
+				var job *models.PuppetJob
+				job, err = RunPuppetPlan(puppetServers[psid], plan, "", nodes, params, baseURL, dryRun)
+				if err == nil {
+					newJobs = append(newJobs, job)
+				}
+			}
+		} else {
+			newJobs, err = runDefaultComponentPatching(puppetServers[psid], component.HealthCheckScript, servers, baseURL, dryRun)
+		}
 		if err != nil {
 			log.Error("ERROR in PatchComponent: ", err)
 			// return
-		} else {
+		}
+		for _, job := range newJobs {
 			job.InitiatorID = component.ID
 			job.InitiatorType = "Component"
 			err = job.Save()
@@ -48,33 +72,61 @@ func PatchComponent(component *models.Component, baseURL string) (jobs []*models
 	return
 }
 
+// runDefaultComponentPatching runs the built-in default patching on the servers (of one PuppetServer): the cluster
+// patching plan on the Linux servers and the patch task (Windows params) on the Windows servers
+// NOTE: The cluster patching plan runs the post reboot script (HealthCheckScript), it is Linux only
+func runDefaultComponentPatching(p *models.PuppetServer, healthCheckScript string, servers []*models.Server, baseURL string, dryRun bool) (jobs []*models.PuppetJob, err error) {
+	linux := make([]string, 0)
+	windows := make([]string, 0)
+	for _, server := range servers {
+		if server.IsWindows() {
+			windows = append(windows, server.Name)
+		} else {
+			linux = append(linux, server.Name)
+		}
+	}
+	var job *models.PuppetJob
+	if len(windows) > 0 {
+		job, err = runPatchTask(p, windows, true, baseURL, dryRun)
+		if err != nil {
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	if len(linux) > 0 {
+		if healthCheckScript == "" || healthCheckScript == "UNSET" {
+			err = errHealthCheckScriptRequired // required by the built-in default plan
+			return
+		}
+		job, err = runPatchPlan(p, healthCheckScript, linux, baseURL, dryRun)
+		if err != nil {
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	return
+}
+
 // RunPuppetPlan will run a Puppet Plan on a Puppet Server and return the PuppetJob
-func RunPuppetPlan(p *models.PuppetServer, plan *models.PuppetPlan, params map[string]string, baseURL string) (job *models.PuppetJob, err error) {
-	client, err := getOrchClient(p)
-	if err != nil {
-		return // already logged
+// NOTE: nodes are only recorded on the PuppetJob, the plan targets are in the params
+func RunPuppetPlan(p *models.PuppetServer, plan *models.PuppetPlan, env string, nodes []string, params map[string]string, baseURL string, dryRun bool) (job *models.PuppetJob, err error) {
+	if env == "" {
+		env = plan.GetEnvironment()
+	}
+	planParams, violations, err := parsePlanParams(p, plan, env, params)
+	if err == nil {
+		err = violations.Err()
 	}
-	planParams, err := parsePlanParams(plan, params)
 	if err != nil {
 		log.Error("Error Parsing Parameters: ", err)
 		return
 	}
-	jobID, err := client.CommandPlanRun(&orch.PlanRunRequest{
+	return commandPlan(p, &orch.PlanRunRequest{
 		Name:        plan.Name,
 		Params:      planParams,
-		Environment: plan.Environment,
+		Environment: env,
 		Description: "Started from: " + baseURL,
-	})
-	if err != nil {
-		log.Error("Error RunPuppetPlan: ", err)
-		return
-	}
-	job, err = parsePlanRunJobID(p, jobID)
-	job.PuppetParentType = "Plan"
-	job.PuppetParentID = plan.ID
-	job.Name = plan.Name
-	// if err != nil, we have already logged an error, return it
-	return
+	}, append(plan.GetSensitiveParamNames(), plan.GetMetadata(p.ID, env).GetSensitiveParamNames()...), nodes, "Plan", plan.ID, dryRun)
 }
 
 // getComponentDetails returns a list of PuppetServers and a serverList indexed by puppetServer.ID
@@ -82,26 +134,19 @@ func getComponentDetails(component *models.Component) (puppetServers map[uint]*m
 	puppetServers = make(map[uint]*models.PuppetServer) // List of Puppet Servers by ID
 	serverList = make(map[uint][]*models.Server)        // List of servers by Puppet Server ID
 
-	for _, server := range component.GetServers() {
-		// Make sure we have a PuppetServer
-		if _, ok := puppetServers[server.PuppetServerID]; !ok {
-			puppetServers[server.PuppetServerID], err = models.GetPuppetServerByID(server.PuppetServerID)
-			if err != nil {
-				return
-			}
+	for psid, list := range groupServersByPuppetServer(component.GetIncludedServers()) {
+		puppetServers[psid], err = models.GetPuppetServerByID(psid)
+		if err != nil {
+			return
 		}
-		serverList[server.PuppetServerID] = append(serverList[server.PuppetServerID], server)
+		serverList[psid] = list
 	}
 	return
 }
 
-// runPatchPlan runs the test task on the nodes
-func runPatchPlan(p *models.PuppetServer, postRebootScriptPath string, nodes []string, baseURL string) (job *models.PuppetJob, err error) {
-	client, err := getOrchClient(p)
-	if err != nil {
-		return // already logged
-	}
-	jobID, err := client.CommandPlanRun(&orch.PlanRunRequest{
+// runPatchPlan runs the (built-in default) cluster patching plan on the nodes
+func runPatchPlan(p *models.PuppetServer, postRebootScriptPath string, nodes []string, baseURL string, dryRun bool) (job *models.PuppetJob, err error) {
+	return commandPlan(p, &orch.PlanRunRequest{
 		Name: "patchy::cluster_patching",
 		Params: map[string]interface{}{
 			"targets":                nodes,
@@ -109,16 +154,7 @@ func runPatchPlan(p *models.PuppetServer, postRebootScriptPath string, nodes []s
 		},
 		Environment: "production",
 		Description: "Started from: " + baseURL,
-	})
-	if err != nil {
-		log.Error("Error runPatchPlan: ", err)
-		return
-	}
-	job, err = parsePlanRunJobID(p, jobID)
-	job.PuppetParentType = "Default"
-	job.Name = "patchy::cluster_patching"
-	// if err != nil, we have already logged an error, return it
-	return
+	}, nil, nodes, "Default", 0, dryRun)
 }
 
 // GetPlan returns Plan from PuppetServer
@@ -172,10 +208,11 @@ func UpdatePlanDetails(p *models.PuppetServer, dbPlan *models.PuppetPlan) (err e
 			"module":       module,
 			"planName":     planName,
 		}).Error("Error GetPlan", err)
+		return
 	}
 	dbPlan.Description = apiPlan.Metadata.Description
 	dbPlan.APIPlanID = apiPlan.ID
-	err = dbPlan.Save()
+	err = dbPlan.SaveFromAPI()
 	if err != nil {
 		log.Error("Error saving task to DB: ", err)
 		return
@@ -185,14 +222,21 @@ func UpdatePlanDetails(p *models.PuppetServer, dbPlan *models.PuppetPlan) (err e
 		log.Error("Error associating Plan to PuppetServer: ", err)
 		return
 	}
-	// Handle Parameters
-	for apiName, apiParam := range apiPlan.Metadata.Parameters {
-		_ = apiName
-		_ = apiParam
+	// Per PuppetServer and environment metadata (used at launch)
+	syncErr := SyncPlanMetadata(p, dbPlan, dbPlan.GetEnvironment())
+	if syncErr != nil {
+		log.Warn("Error syncing plan metadata: ", syncErr)
 	}
+	// The params are shared, keep the params of the plan on the other PuppetServers and environments
+	otherParams := dbPlan.GetMetadataParams()
 
-	// Find removed params
-	for _, dbParam := range dbPlan.Params {
+	// Find removed params (reloaded, the params may have been edited since the plan was loaded)
+	dbParams, err := dbPlan.GetParams()
+	if err != nil {
+		log.Error("Error retrieving plan params: ", err)
+		return
+	}
+	for _, dbParam := range dbParams {
 		var found bool
 		for apiParamName := range apiPlan.Metadata.Parameters {
 			// This is crude, find a parameter name that matches
@@ -201,7 +245,7 @@ func UpdatePlanDetails(p *models.PuppetServer, dbPlan *models.PuppetPlan) (err e
 				break
 			}
 		}
-		if !found {
+		if !found && otherParams[dbParam.Name] == nil {
 			log.WithField("paramName", dbParam.Name).Info("Found a parameter that is no longer in the job.")
 			if dbParam.TemplateValue == "" {
 				// If no TemplateValue is set, just delete
@@ -212,7 +256,7 @@ func UpdatePlanDetails(p *models.PuppetServer, dbPlan *models.PuppetPlan) (err e
 			} else {
 				// Flag the values as "IsNotInTask"
 				dbParam.IsNotInPlan = true
-				err = dbParam.Save()
+				err = dbParam.SaveFromAPI()
 				if err != nil {
 					log.Error("ERROR saving dbParam: ", err)
 				}
@@ -220,6 +264,12 @@ func UpdatePlanDetails(p *models.PuppetServer, dbPlan *models.PuppetPlan) (err e
 		}
 	}
 
+	// Default values, required-ness and sensitivity (not decoded by the go-pe-client)
+	metadata, metadataErr := getParamMetadata(p, "plans", dbPlan.Environment, module, planName)
+	if metadataErr != nil {
+		log.WithField("puppetServer", p.Name).Warn("Error retrieving plan param metadata, defaults are not updated: ", metadataErr)
+	}
+
 	// Update DB Params from API
 	params := make([]*models.PuppetPlanParam, 0)
 	for apiParamName, apiParam := range apiPlan.Metadata.Parameters {
@@ -227,7 +277,13 @@ func UpdatePlanDetails(p *models.PuppetServer, dbPlan *models.PuppetPlan) (err e
 		param.PuppetPlanID = dbPlan.ID
 		param.Description = apiParam.Description
 		param.Type = apiParam.Type
-		err = param.Save()
+		param.IsNotInPlan = false
+		if m, ok := metadata[apiParamName]; ok {
+			param.DefaultValue, _ = m.GetDefault()
+			param.IsRequired = m.IsRequired()
+			param.IsSensitive = m.IsSensitive()
+		}
+		err = param.SaveFromAPI()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"Name": param.Name,
@@ -236,7 +292,24 @@ func UpdatePlanDetails(p *models.PuppetServer, dbPlan *models.PuppetPlan) (err e
 		}
 		params = append(params, param)
 	}
+	for name, m := range otherParams {
+		if _, ok := apiPlan.Metadata.Parameters[name]; ok {
+			continue
+		}
+		param := dbPlan.Param(name) // created if it does not exist
+		if param.Type == "" || param.IsNotInPlan {
+			param.Type, param.Description, param.DefaultValue = m.Type, m.Description, m.DefaultValue
+			param.IsRequired, param.IsSensitive = m.IsRequired, m.IsSensitive
+		}
+		param.IsNotInPlan = false
+		err = param.SaveFromAPI()
+		if err != nil {
+			log.WithField("Name", param.Name).Error("Error saving to DB: ", err)
+		}
+		params = append(params, param)
+	}
 	dbPlan.Params = params
+
 	return
 }
 
@@ -261,9 +334,13 @@ func parsePlanRunJobID(p *models.PuppetServer, jobID *orch.PlanRunJobID) (job *m
 }
 
 // parsePlanParams returns a map[string]interface from map[string]string for puppet plan parameters
-func parsePlanParams(plan *models.PuppetPlan, params map[string]string) (newParams map[string]interface{}, err error) {
+// NOTE: The values are converted to the Puppet data type of the param, the params that do not match
+// (or are required and empty) are in violations
+func parsePlanParams(p *models.PuppetServer, plan *models.PuppetPlan, env string, params map[string]string) (newParams map[string]interface{}, violations ParamViolations, err error) {
+	metadata := plan.GetMetadata(p.ID, env) // nil if not synced, the plan params are used
 	var planParam *models.PuppetPlanParam
 	newParams = make(map[string]interface{})
+	violations = make(ParamViolations)
 	for k, v := range params {
 		planParam, err = plan.GetParamByName(k)
 		if err != nil {
@@ -273,10 +350,44 @@ func parsePlanParams(plan *models.PuppetPlan, params map[string]string) (newPara
 			}).Error("Error loading parameter: ", err)
 			return
 		}
-		val := getInterfaceValue(planParam.Type, v)
+		paramType, sensitive := planParam.Type, planParam.IsSensitive
+		if metadata != nil {
+			m, ok := metadata.Params[k]
+			if !ok {
+				if strings.TrimSpace(v) != "" {
+					violations[k] = "is not in the plan on " + metadata.GetName()
+				}
+				continue
+			}
+			paramType, sensitive = m.Type, m.IsSensitive
+		}
+		val, convErr := getInterfaceValue(paramType, v)
+		if convErr != nil {
+			violations[k] = convErr.Error()
+			if sensitive {
+				violations[k] = "expects " + paramType // do not show the value
+			}
+			continue
+		}
 		if val != nil {
 			newParams[k] = val
 		}
 	}
+	missing := plan.GetMissingParams(params)
+	if metadata != nil {
+		missing = metadata.GetMissingParams(params)
+	}
+	for _, name := range missing {
+		violations[name] = "is required"
+	}
+	return
+}
+
+// GetPlanParamViolations returns the params that do not match their Puppet data type on the PuppetServer for the environment (i.e. for the preview)
+func GetPlanParamViolations(p *models.PuppetServer, plan *models.PuppetPlan, env string, params map[string]string) (violations ParamViolations, err error) {
+	if env == "" {
+		env = plan.GetEnvironment()
+	}
+	_, violations, err = parsePlanParams(p, plan, env, params)
 	return
 }
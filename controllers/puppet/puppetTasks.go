@@ -9,109 +9,123 @@ import (
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
+// Default Tasks (pe_patch module, see FactName)
+const (
+	defaultPatchTask       = "patch_server"
+	defaultTestTask        = "clean_cache"  // Linux (yum/apt)
+	defaultWindowsTestTask = "refresh_fact" // clean_cache is not available on Windows
+)
+
+// defaultPatchParams returns the default parameters for the patch_server task
+// NOTE: "smart" reboots are only supported on Linux, Windows reboots if any updates were installed
+func defaultPatchParams(windows bool) map[string]interface{} {
+	if windows {
+		return map[string]interface{}{
+			"reboot": "patched",
+			// "security_only": "false",
+		}
+	}
+	return map[string]interface{}{
+		// "clean_cache": "true",
+		"reboot": "smart",
+		// "yum_params": "",
+	}
+}
+
 // PatchServer will patch a specific server
-func PatchServer(server *models.Server, baseURL string, test bool) (job *models.PuppetJob, err error) {
+func PatchServer(server *models.Server, baseURL string, test bool, dryRun bool) (job *models.PuppetJob, err error) {
 	puppetServer, err := models.GetPuppetServerByID(server.PuppetServerID)
 	if err != nil {
 		return
 	}
 
+	// Task bound to the action on the PuppetServer (nil is the built-in default)
+	var task *models.PuppetTask
+	if test {
+		task, err = puppetServer.GetTestTask()
+	} else {
+		task, err = puppetServer.GetPatchTask()
+	}
+	if err != nil {
+		log.Error("Error loading the patching task for PuppetServer: ", err)
+		return
+	}
+	if task != nil {
+		var params map[string]string
+		params, err = task.GetParamValues(server)
+		if err != nil {
+			return
+		}
+		return RunPuppetTask(puppetServer, task, "", []string{server.Name}, params, baseURL, dryRun)
+	}
+
 	if test {
-		job, err = runTestTask(puppetServer, []string{server.Name}, baseURL)
+		job, err = runTestTask(puppetServer, []string{server.Name}, server.IsWindows(), baseURL, dryRun)
 	} else {
-		job, err = runPatchTask(puppetServer, []string{server.Name}, baseURL)
+		job, err = runPatchTask(puppetServer, []string{server.Name}, server.IsWindows(), baseURL, dryRun)
 	}
 	return
 }
 
 // RunPuppetTask will run a PuppetTask on a PuppetServer and return a PuppetJob
-func RunPuppetTask(p *models.PuppetServer, task *models.PuppetTask, nodes []string, params map[string]string, baseURL string) (job *models.PuppetJob, err error) {
-	client, err := getOrchClient(p)
-	if err != nil {
-		return // already logged
+func RunPuppetTask(p *models.PuppetServer, task *models.PuppetTask, env string, nodes []string, params map[string]string, baseURL string, dryRun bool) (job *models.PuppetJob, err error) {
+	if env == "" {
+		env = task.GetEnvironment()
+	}
+	taskParams, violations, err := parseTaskParams(p, task, env, params)
+	if err == nil {
+		err = violations.Err()
 	}
-	taskParams, err := parseTaskParams(task, params)
 	if err != nil {
 		log.Error("Error Parsing Parameters: ", err)
 		return
 	}
-	jobID, err := client.CommandTask(&orch.TaskRequest{
+	// noop support of the task on the PuppetServer for the environment (if synced)
+	metadata := task.GetMetadata(p.ID, env)
+	supportsNoop := task.SupportsNoop
+	if metadata != nil {
+		supportsNoop = metadata.SupportsNoop
+	}
+	return commandTask(p, &orch.TaskRequest{
 		Task:        task.Name,
 		Params:      taskParams,
-		Environment: task.Environment,
+		Environment: env,
 		Description: "Started from: " + baseURL,
 		Scope: orch.Scope{
 			Nodes: nodes,
 		},
-	})
-	if err != nil {
-		log.Error("Error RunPuppetTask: ", err)
-		return
-	}
-	job, err = parseJobID(p, jobID)
-	job.PuppetParentType = "Task"
-	job.PuppetParentID = task.ID
-	job.Name = task.Name
-	// if err != nil, we have already logged an error, return it
-	return
+	}, append(task.GetSensitiveParamNames(), metadata.GetSensitiveParamNames()...), "Task", task.ID, supportsNoop, dryRun)
 }
 
-// runTestTask runs the test task on the nodes
-func runTestTask(p *models.PuppetServer, nodes []string, baseURL string) (job *models.PuppetJob, err error) {
-	client, err := getOrchClient(p)
-	if err != nil {
-		return // already logged
+// runTestTask runs the test task on the nodes (all Windows or all Linux)
+func runTestTask(p *models.PuppetServer, nodes []string, windows bool, baseURL string, dryRun bool) (job *models.PuppetJob, err error) {
+	taskName := strings.Split(p.FactName, ".")[0] + "::" + defaultTestTask
+	if windows {
+		taskName = strings.Split(p.FactName, ".")[0] + "::" + defaultWindowsTestTask
 	}
-	patchingModule := strings.Split(p.FactName, ".")[0]
-	jobID, err := client.CommandTask(&orch.TaskRequest{
+	return commandTask(p, &orch.TaskRequest{
 		Description: "Started from: " + baseURL,
 		Environment: "production",
-		Task:        patchingModule + "::clean_cache",
+		Task:        taskName,
 		Params:      map[string]interface{}{},
 		Scope: orch.Scope{
 			Nodes: nodes,
 		},
-	})
-	if err != nil {
-		log.Error("Error runTestTask: ", err)
-		return
-	}
-	job, err = parseJobID(p, jobID)
-	job.PuppetParentType = "Default"
-	job.Name = patchingModule + "::clean_cache"
-	// if err != nil, we have already logged an error, return it
-	return
+	}, nil, "Default", 0, dryRun && taskSupportsNoop(p, "production", taskName), dryRun)
 }
 
-// runPatchTask runs the patching task on the nodes
-func runPatchTask(p *models.PuppetServer, nodes []string, baseURL string) (job *models.PuppetJob, err error) {
-	client, err := getOrchClient(p)
-	if err != nil {
-		return // already logged
-	}
-	patchingModule := strings.Split(p.FactName, ".")[0]
-	jobID, err := client.CommandTask(&orch.TaskRequest{
+// runPatchTask runs the patching task on the nodes (all Windows or all Linux)
+func runPatchTask(p *models.PuppetServer, nodes []string, windows bool, baseURL string, dryRun bool) (job *models.PuppetJob, err error) {
+	taskName := strings.Split(p.FactName, ".")[0] + "::" + defaultPatchTask
+	return commandTask(p, &orch.TaskRequest{
 		Description: "Started from: " + baseURL,
 		Environment: "production",
-		Task:        patchingModule + "::patch_server",
-		Params: map[string]interface{}{
-			// "clean_cache": "true",
-			"reboot": "smart",
-			// "yum_params": "",
-		},
+		Task:        taskName,
+		Params:      defaultPatchParams(windows),
 		Scope: orch.Scope{
 			Nodes: nodes,
 		},
-	})
-	if err != nil {
-		log.Error("Error CommandTask: ", err)
-		return
-	}
-	job, err = parseJobID(p, jobID)
-	job.PuppetParentType = "Default"
-	job.Name = patchingModule + "::patch_server"
-	// if err != nil, we have already logged an error, return it
-	return
+	}, nil, "Default", 0, dryRun && taskSupportsNoop(p, "production", taskName), dryRun)
 }
 
 // GetTask returns Task from PuppetServer
@@ -165,10 +179,12 @@ func UpdateTaskDetails(p *models.PuppetServer, dbTask *models.PuppetTask) (err e
 			"module":       module,
 			"taskName":     taskName,
 		}).Error("Error GetTask", err)
+		return
 	}
 	dbTask.Description = apiTask.Metadata.Description
+	dbTask.SupportsNoop = apiTask.Metadata.SupportsNoop
 	dbTask.APITaskID = apiTask.ID
-	err = dbTask.Save()
+	err = dbTask.SaveFromAPI()
 	if err != nil {
 		log.Error("Error saving task to DB: ", err)
 		return
@@ -178,14 +194,21 @@ func UpdateTaskDetails(p *models.PuppetServer, dbTask *models.PuppetTask) (err e
 		log.Error("Error associating Task to PuppetServer: ", err)
 		return
 	}
-	// Handle Parameters
-	for apiName, apiParam := range apiTask.Metadata.Parameters {
-		_ = apiName
-		_ = apiParam
+	// Per PuppetServer and environment metadata (used at launch)
+	syncErr := SyncTaskMetadata(p, dbTask, dbTask.GetEnvironment())
+	if syncErr != nil {
+		log.Warn("Error syncing task metadata: ", syncErr)
 	}
+	// The params are shared, keep the params of the task on the other PuppetServers and environments
+	otherParams := dbTask.GetMetadataParams()
 
-	// Find removed params
-	for _, dbParam := range dbTask.Params {
+	// Find removed params (reloaded, the params may have been edited since the task was loaded)
+	dbParams, err := dbTask.GetParams()
+	if err != nil {
+		log.Error("Error retrieving task params: ", err)
+		return
+	}
+	for _, dbParam := range dbParams {
 		var found bool
 		for apiParamName := range apiTask.Metadata.Parameters {
 			// This is crude, find a parameter name that matches
@@ -194,7 +217,7 @@ func UpdateTaskDetails(p *models.PuppetServer, dbTask *models.PuppetTask) (err e
 				break
 			}
 		}
-		if !found {
+		if !found && otherParams[dbParam.Name] == nil {
 			log.WithField("paramName", dbParam.Name).Info("Found a parameter that is no longer in the job.")
 			if dbParam.TemplateValue == "" {
 				// If no TemplateValue is set, just delete
@@ -205,13 +228,19 @@ func UpdateTaskDetails(p *models.PuppetServer, dbTask *models.PuppetTask) (err e
 			} else {
 				// Flag the values as "IsNotInTask"
 				dbParam.IsNotInTask = true
-				err = dbParam.Save()
+				err = dbParam.SaveFromAPI()
 				if err != nil {
 					log.Error("ERROR saving dbParam: ", err)
 				}
 			}
 		}
 	}
+	// Default values, required-ness and sensitivity (not decoded by the go-pe-client)
+	metadata, metadataErr := getParamMetadata(p, "tasks", dbTask.Environment, module, taskName)
+	if metadataErr != nil {
+		log.WithField("puppetServer", p.Name).Warn("Error retrieving task param metadata, defaults are not updated: ", metadataErr)
+	}
+
 	// Update DB Params from API
 	params := make([]*models.PuppetTaskParam, 0)
 	for apiParamName, apiParam := range apiTask.Metadata.Parameters {
@@ -219,7 +248,13 @@ func UpdateTaskDetails(p *models.PuppetServer, dbTask *models.PuppetTask) (err e
 		param.PuppetTaskID = dbTask.ID
 		param.Description = apiParam.Description
 		param.Type = apiParam.Type
-		err = param.Save()
+		param.IsNotInTask = false
+		if m, ok := metadata[apiParamName]; ok {
+			param.DefaultValue, _ = m.GetDefault()
+			param.IsRequired = m.IsRequired()
+			param.IsSensitive = m.IsSensitive()
+		}
+		err = param.SaveFromAPI()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"Name": param.Name,
@@ -228,7 +263,24 @@ func UpdateTaskDetails(p *models.PuppetServer, dbTask *models.PuppetTask) (err e
 		}
 		params = append(params, param)
 	}
+	for name, m := range otherParams {
+		if _, ok := apiTask.Metadata.Parameters[name]; ok {
+			continue
+		}
+		param := dbTask.Param(name) // created if it does not exist
+		if param.Type == "" || param.IsNotInTask {
+			param.Type, param.Description, param.DefaultValue = m.Type, m.Description, m.DefaultValue
+			param.IsRequired, param.IsSensitive = m.IsRequired, m.IsSensitive
+		}
+		param.IsNotInTask = false
+		err = param.SaveFromAPI()
+		if err != nil {
+			log.WithField("Name", param.Name).Error("Error saving to DB: ", err)
+		}
+		params = append(params, param)
+	}
 	dbTask.Params = params
+
 	return
 }
 
@@ -257,10 +309,14 @@ func parseJobID(p *models.PuppetServer, jobID *orch.JobID) (job *models.PuppetJo
 	return
 }
 
-// parseTaskParams returns a map[string]interface from map[string]string for puppet plan parameters
-func parseTaskParams(task *models.PuppetTask, params map[string]string) (newParams map[string]interface{}, err error) {
+// parseTaskParams returns a map[string]interface from map[string]string for puppet task parameters
+// NOTE: The values are converted to the Puppet data type of the param, the params that do not match
+// (or are required and empty) are in violations
+func parseTaskParams(p *models.PuppetServer, task *models.PuppetTask, env string, params map[string]string) (newParams map[string]interface{}, violations ParamViolations, err error) {
+	metadata := task.GetMetadata(p.ID, env) // nil if not synced, the task params are used
 	var taskParam *models.PuppetTaskParam
 	newParams = make(map[string]interface{})
+	violations = make(ParamViolations)
 	for k, v := range params {
 		taskParam, err = task.GetParamByName(k)
 		if err != nil {
@@ -270,13 +326,44 @@ func parseTaskParams(task *models.PuppetTask, params map[string]string) (newPara
 			}).Error("Error loading parameter: ", err)
 			return
 		}
-		if v != "" {
-			newParams[k] = v
+		paramType, sensitive := taskParam.Type, taskParam.IsSensitive
+		if metadata != nil {
+			m, ok := metadata.Params[k]
+			if !ok {
+				if strings.TrimSpace(v) != "" {
+					violations[k] = "is not in the task on " + metadata.GetName()
+				}
+				continue
+			}
+			paramType, sensitive = m.Type, m.IsSensitive
+		}
+		val, convErr := getInterfaceValue(paramType, v)
+		if convErr != nil {
+			violations[k] = convErr.Error()
+			if sensitive {
+				violations[k] = "expects " + paramType // do not show the value
+			}
+			continue
 		}
-		val := getInterfaceValue(taskParam.Type, v)
 		if val != nil {
 			newParams[k] = val
 		}
 	}
+	missing := task.GetMissingParams(params)
+	if metadata != nil {
+		missing = metadata.GetMissingParams(params)
+	}
+	for _, name := range missing {
+		violations[name] = "is required"
+	}
+	return
+}
+
+// GetTaskParamViolations returns the params that do not match their Puppet data type on the PuppetServer for the environment (i.e. for the preview)
+func GetTaskParamViolations(p *models.PuppetServer, task *models.PuppetTask, env string, params map[string]string) (violations ParamViolations, err error) {
+	if env == "" {
+		env = task.GetEnvironment()
+	}
+	_, violations, err = parseTaskParams(p, task, env, params)
 	return
 }
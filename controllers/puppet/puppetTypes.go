@@ -0,0 +1,627 @@
+package puppet
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// puppetType is a parsed Puppet data type, i.e. Optional[Array[String[1]]] or Enum['a', 'b']
+type puppetType struct {
+	Name string        // i.e. "Optional", "Array" or "Boltlib::TargetSpec"
+	Args []interface{} // *puppetType, string, int64, float64, *regexp.Regexp or []*puppetStructMember
+	text string        // source text, for error messages
+}
+
+// puppetStructMember is a key of a Struct[{...}]
+type puppetStructMember struct {
+	Key      string
+	Optional bool
+	Type     *puppetType
+}
+
+// String returns the type as it was written
+func (t *puppetType) String() string {
+	return t.text
+}
+
+// parsePuppetType parses a Puppet data type, an empty type is Any
+func parsePuppetType(s string) (t *puppetType, err error) {
+	if strings.TrimSpace(s) == "" {
+		return &puppetType{Name: "Any", text: "Any"}, nil
+	}
+	p := &puppetTypeParser{src: []rune(s)}
+	t, err = p.parseType()
+	if err != nil {
+		return nil, fmt.Errorf("invalid puppet type %q: %w", s, err)
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, fmt.Errorf("invalid puppet type %q: unexpected %q at %d", s, string(p.src[p.pos:]), p.pos)
+	}
+	return
+}
+
+// puppetTypeParser is a recursive descent parser for Puppet data types
+type puppetTypeParser struct {
+	src []rune
+	pos int
+}
+
+func (p *puppetTypeParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *puppetTypeParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *puppetTypeParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// expect consumes the (optional leading space and) rune r
+func (p *puppetTypeParser) expect(r rune) error {
+	p.skipSpace()
+	if p.peek() != r {
+		if p.eof() {
+			return fmt.Errorf("expected %q at end", r)
+		}
+		return fmt.Errorf("expected %q at %d, got %q", r, p.pos, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+// parseType parses Name or Name[args]
+func (p *puppetTypeParser) parseType() (t *puppetType, err error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && (unicode.IsLetter(p.peek()) || unicode.IsDigit(p.peek()) || p.peek() == '_' || p.peek() == ':') {
+		p.pos++
+	}
+	if p.pos == start {
+		if p.eof() {
+			return nil, fmt.Errorf("expected a type at end")
+		}
+		return nil, fmt.Errorf("expected a type at %d, got %q", p.pos, p.peek())
+	}
+	t = &puppetType{Name: string(p.src[start:p.pos])}
+	p.skipSpace()
+	if p.peek() == '[' {
+		p.pos++
+		t.Args, err = p.parseArgs(']')
+		if err != nil {
+			return
+		}
+	}
+	t.text = strings.TrimSpace(string(p.src[start:p.pos]))
+	return
+}
+
+// parseArgs parses a comma separated list of args up to (and including) end
+func (p *puppetTypeParser) parseArgs(end rune) (args []interface{}, err error) {
+	args = make([]interface{}, 0)
+	for {
+		p.skipSpace()
+		if p.peek() == end {
+			p.pos++
+			return
+		}
+		var arg interface{}
+		arg, err = p.parseArg()
+		if err != nil {
+			return
+		}
+		args = append(args, arg)
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		err = p.expect(end)
+		return
+	}
+}
+
+// parseArg parses a type, string, number, regexp or hash (Struct)
+func (p *puppetTypeParser) parseArg() (arg interface{}, err error) {
+	p.skipSpace()
+	switch r := p.peek(); {
+	case r == '\'' || r == '"':
+		return p.parseString()
+	case r == '/':
+		return p.parseRegexp()
+	case r == '-' || unicode.IsDigit(r):
+		return p.parseNumber()
+	case r == '{':
+		p.pos++
+		return p.parseStructMembers()
+	}
+	t, err := p.parseType()
+	if err != nil {
+		return
+	}
+	if t.Name == "default" {
+		return nil, nil // i.e. Integer[default, 10]
+	}
+	return t, nil
+}
+
+func (p *puppetTypeParser) parseString() (s string, err error) {
+	quote := p.peek()
+	p.pos++
+	var b strings.Builder
+	for !p.eof() && p.peek() != quote {
+		if p.peek() == '\\' && p.pos+1 < len(p.src) {
+			p.pos++
+		}
+		b.WriteRune(p.peek())
+		p.pos++
+	}
+	if p.eof() {
+		return "", fmt.Errorf("unterminated string")
+	}
+	p.pos++
+	return b.String(), nil
+}
+
+func (p *puppetTypeParser) parseRegexp() (re *regexp.Regexp, err error) {
+	p.pos++
+	var b strings.Builder
+	for !p.eof() && p.peek() != '/' {
+		if p.peek() == '\\' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '/' {
+			p.pos++
+		}
+		b.WriteRune(p.peek())
+		p.pos++
+	}
+	if p.eof() {
+		return nil, fmt.Errorf("unterminated regexp")
+	}
+	p.pos++
+	return regexp.Compile(b.String())
+}
+
+// parseNumber parses an integer or a float (i.e. -1, 0.5 or 1e-5)
+func (p *puppetTypeParser) parseNumber() (n interface{}, err error) {
+	start := p.pos
+	p.pos++
+	for !p.eof() {
+		r := p.peek()
+		exponentSign := (r == '-' || r == '+') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')
+		if !unicode.IsDigit(r) && r != '.' && r != 'e' && r != 'E' && !exponentSign {
+			break
+		}
+		p.pos++
+	}
+	s := string(p.src[start:p.pos])
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseStructMembers parses { 'key' => Type, Optional['key'] => Type, ... }
+func (p *puppetTypeParser) parseStructMembers() (members []*puppetStructMember, err error) {
+	members = make([]*puppetStructMember, 0)
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			return
+		}
+		member := new(puppetStructMember)
+		var key interface{}
+		key, err = p.parseArg()
+		if err != nil {
+			return
+		}
+		switch k := key.(type) {
+		case string:
+			member.Key = k
+		case *puppetType: // bare word key, Optional['key'] or NotUndef['key']
+			switch {
+			case len(k.Args) == 0:
+				member.Key = k.Name
+			case len(k.Args) == 1 && (k.Name == "Optional" || k.Name == "NotUndef"):
+				switch optionalKey := k.Args[0].(type) {
+				case string:
+					member.Key = optionalKey
+				case *puppetType:
+					member.Key = optionalKey.Name
+				}
+				member.Optional = k.Name == "Optional"
+			}
+			if member.Key == "" {
+				return nil, fmt.Errorf("invalid struct key %s", k)
+			}
+		default:
+			return nil, fmt.Errorf("invalid struct key %v", key)
+		}
+		err = p.expect('=')
+		if err != nil {
+			return
+		}
+		err = p.expect('>')
+		if err != nil {
+			return
+		}
+		member.Type, err = p.parseType()
+		if err != nil {
+			return
+		}
+		members = append(members, member)
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		err = p.expect('}')
+		return
+	}
+}
+
+// typeArg returns the type argument at i (Any if missing)
+func (t *puppetType) typeArg(i int) *puppetType {
+	if i < len(t.Args) {
+		if arg, ok := t.Args[i].(*puppetType); ok {
+			return arg
+		}
+	}
+	return &puppetType{Name: "Any", text: "Any"}
+}
+
+// intArg returns the integer argument at i (def if missing or default)
+func (t *puppetType) intArg(i int, def int64) int64 {
+	if i < len(t.Args) {
+		switch arg := t.Args[i].(type) {
+		case int64:
+			return arg
+		case float64:
+			return int64(arg)
+		}
+	}
+	return def
+}
+
+// floatArg returns the numeric argument at i (def if missing or default)
+func (t *puppetType) floatArg(i int, def float64) float64 {
+	if i < len(t.Args) {
+		switch arg := t.Args[i].(type) {
+		case int64:
+			return float64(arg)
+		case float64:
+			return arg
+		}
+	}
+	return def
+}
+
+// acceptsUndef returns true if the type accepts undef (an unset param), i.e. Optional[String] or Variant[Undef, String]
+func (t *puppetType) acceptsUndef() bool {
+	switch t.Name {
+	case "Optional", "Any", "Undef", "Data", "RichData":
+		return true
+	case "Variant":
+		for _, arg := range t.Args {
+			if variant, ok := arg.(*puppetType); ok && variant.acceptsUndef() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeError returns the error for a value that does not match the type
+func (t *puppetType) typeError(value interface{}) error {
+	if s, ok := value.(string); ok {
+		return fmt.Errorf("expects %s, got %q", t, s)
+	}
+	return fmt.Errorf("expects %s, got %v", t, value)
+}
+
+// convert converts the value (a string from a template or a decoded JSON value) to the type
+// NOTE: nil is only returned for an unset (Optional/Undef) value
+func (t *puppetType) convert(value interface{}) (interface{}, error) {
+	s, isString := value.(string)
+	switch t.Name {
+	case "Optional":
+		if value == nil || (isString && s == "") {
+			return nil, nil
+		}
+		if len(t.Args) > 0 {
+			if literal, ok := t.Args[0].(string); ok { // Optional['value']
+				return (&puppetType{Name: "Enum", Args: []interface{}{literal}, text: t.text}).convert(value)
+			}
+		}
+		return t.typeArg(0).convert(value)
+	case "NotUndef", "Sensitive":
+		if value == nil {
+			return nil, t.typeError(value)
+		}
+		return t.typeArg(0).convert(value)
+	case "Undef":
+		if value == nil || (isString && s == "") {
+			return nil, nil
+		}
+		return nil, t.typeError(value)
+	case "Any", "Data", "RichData", "Scalar", "ScalarData":
+		if isString && (strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{")) {
+			var decoded interface{}
+			if decodeJSON(s, &decoded) == nil {
+				return decoded, nil
+			}
+		}
+		return value, nil
+	case "String":
+		if !isString {
+			return nil, t.typeError(value)
+		}
+		length := int64(len([]rune(s)))
+		if length < t.intArg(0, 0) || length > t.intArg(1, math.MaxInt64) {
+			return nil, t.typeError(value)
+		}
+		return s, nil
+	case "Integer":
+		i, err := toInt(value)
+		if err != nil || i < t.intArg(0, math.MinInt64) || i > t.intArg(1, math.MaxInt64) {
+			return nil, t.typeError(value)
+		}
+		return int(i), nil
+	case "Float":
+		f, err := toFloat(value)
+		if err != nil || f < t.floatArg(0, math.Inf(-1)) || f > t.floatArg(1, math.Inf(1)) {
+			return nil, t.typeError(value)
+		}
+		return f, nil
+	case "Numeric":
+		if i, err := toInt(value); err == nil {
+			return int(i), nil
+		}
+		f, err := toFloat(value)
+		if err != nil {
+			return nil, t.typeError(value)
+		}
+		return f, nil
+	case "Boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "yes", "1":
+				return true, nil
+			case "false", "no", "0":
+				return false, nil
+			}
+		}
+		return nil, t.typeError(value)
+	case "Enum":
+		if isString {
+			for _, arg := range t.Args {
+				switch literal := arg.(type) {
+				case string: // Enum['a', 'b']
+					if literal == s {
+						return s, nil
+					}
+				case *puppetType: // Enum[a, b] (bare words)
+					if len(literal.Args) == 0 && literal.Name == s {
+						return s, nil
+					}
+				}
+			}
+		}
+		return nil, t.typeError(value)
+	case "Pattern":
+		if isString {
+			for _, arg := range t.Args {
+				if re, ok := arg.(*regexp.Regexp); ok && re.MatchString(s) {
+					return s, nil
+				}
+				if literal, ok := arg.(string); ok {
+					if re, err := regexp.Compile(literal); err == nil && re.MatchString(s) {
+						return s, nil
+					}
+				}
+			}
+		}
+		return nil, t.typeError(value)
+	case "Variant":
+		for _, arg := range t.Args {
+			if variant, ok := arg.(*puppetType); ok {
+				if converted, err := variant.convert(value); err == nil {
+					return converted, nil
+				}
+			}
+		}
+		return nil, t.typeError(value)
+	case "Array", "Tuple":
+		return t.convertArray(value)
+	case "Hash", "Struct":
+		return t.convertHash(value)
+	case "TargetSpec", "Boltlib::TargetSpec":
+		if isString && strings.HasPrefix(s, "[") {
+			return (&puppetType{Name: "Array", Args: []interface{}{&puppetType{Name: "String", text: "String"}}, text: t.text}).convert(value)
+		}
+		if isString && s != "" {
+			return s, nil // a name or a comma separated list of names
+		}
+		if _, ok := value.([]interface{}); ok {
+			return (&puppetType{Name: "Array", Args: []interface{}{&puppetType{Name: "String", text: "String"}}, text: t.text}).convert(value)
+		}
+		return nil, t.typeError(value)
+	}
+	// Type aliases (i.e. Stdlib::Absolutepath) and other types are passed as is
+	return value, nil
+}
+
+// convertArray converts a JSON array or a comma separated list to an Array or Tuple
+func (t *puppetType) convertArray(value interface{}) (interface{}, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(v), "[") {
+			if err := decodeJSON(v, &items); err != nil {
+				return nil, fmt.Errorf("expects %s, invalid JSON: %w", t, err)
+			}
+		} else {
+			items = make([]interface{}, 0)
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+	default:
+		return nil, t.typeError(value)
+	}
+
+	// Array[Type, min, max] or Tuple[Type, Type, ..., min, max]
+	types := []*puppetType{t.typeArg(0)}
+	minSize, maxSize := t.intArg(1, 0), t.intArg(2, math.MaxInt64)
+	if t.Name == "Tuple" {
+		types = make([]*puppetType, 0, len(t.Args))
+		for _, arg := range t.Args {
+			if tupleType, ok := arg.(*puppetType); ok {
+				types = append(types, tupleType)
+			}
+		}
+		minSize, maxSize = t.intArg(len(types), int64(len(types))), t.intArg(len(types)+1, int64(len(types)))
+		if len(types) == 0 {
+			types = append(types, t.typeArg(0))
+		}
+	}
+	if int64(len(items)) < minSize || int64(len(items)) > maxSize {
+		return nil, fmt.Errorf("expects %s, got %d items", t, len(items))
+	}
+
+	converted := make([]interface{}, len(items))
+	for i, item := range items {
+		itemType := types[len(types)-1]
+		if i < len(types) {
+			itemType = types[i]
+		}
+		c, err := itemType.convert(item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d %w", i, err)
+		}
+		converted[i] = c
+	}
+	return converted, nil
+}
+
+// convertHash converts a JSON object to a Hash or Struct
+func (t *puppetType) convertHash(value interface{}) (interface{}, error) {
+	var hash map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		hash = v
+	case string:
+		if err := decodeJSON(v, &hash); err != nil {
+			return nil, fmt.Errorf("expects %s, invalid JSON: %w", t, err)
+		}
+	default:
+		return nil, t.typeError(value)
+	}
+
+	converted := make(map[string]interface{}, len(hash))
+	if t.Name == "Hash" {
+		if int64(len(hash)) < t.intArg(2, 0) || int64(len(hash)) > t.intArg(3, math.MaxInt64) {
+			return nil, fmt.Errorf("expects %s, got %d keys", t, len(hash))
+		}
+		for k, v := range hash {
+			if _, err := t.typeArg(0).convert(k); err != nil {
+				return nil, fmt.Errorf("key %q %w", k, err)
+			}
+			c, err := t.typeArg(1).convert(v)
+			if err != nil {
+				return nil, fmt.Errorf("key %q %w", k, err)
+			}
+			converted[k] = c
+		}
+		return converted, nil
+	}
+
+	// Struct[{ 'key' => Type, ... }]
+	var members []*puppetStructMember
+	if len(t.Args) > 0 {
+		members, _ = t.Args[0].([]*puppetStructMember)
+	}
+	known := make(map[string]bool, len(members))
+	for _, member := range members {
+		known[member.Key] = true
+		v, ok := hash[member.Key]
+		if !ok {
+			if member.Optional || member.Type.Name == "Optional" {
+				continue
+			}
+			return nil, fmt.Errorf("expects %s, missing key %q", t, member.Key)
+		}
+		c, err := member.Type.convert(v)
+		if err != nil {
+			return nil, fmt.Errorf("key %q %w", member.Key, err)
+		}
+		converted[member.Key] = c
+	}
+	for k := range hash {
+		if !known[k] {
+			return nil, fmt.Errorf("expects %s, unexpected key %q", t, k)
+		}
+	}
+	return converted, nil
+}
+
+// decodeJSON decodes JSON keeping the numbers as json.Number (so integers stay integers)
+func decodeJSON(s string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// toInt converts a string, json.Number or integral float64 to an int64
+func toInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	case json.Number:
+		return v.Int64()
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("not an integer: %v", value)
+}
+
+// toFloat converts a string, json.Number or number to a float64
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("not a number: %v", value)
+}
@@ -0,0 +1,233 @@
+package puppet
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParsePuppetType(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantName string
+		wantArgs []interface{} // *puppetType args are compared by String()
+		wantErr  bool
+	}{
+		{input: "", wantName: "Any"},
+		{input: "String", wantName: "String", wantArgs: []interface{}{}},
+		{input: " String[1] ", wantName: "String", wantArgs: []interface{}{int64(1)}},
+		{input: "Optional[Array[String[1]]]", wantName: "Optional", wantArgs: []interface{}{"Array[String[1]]"}},
+		{input: "Enum['a', \"b\"]", wantName: "Enum", wantArgs: []interface{}{"a", "b"}},
+		{input: "Enum[a, b]", wantName: "Enum", wantArgs: []interface{}{"a", "b"}},
+		{input: "Pattern[/^\\d+$/, 'x']", wantName: "Pattern", wantArgs: []interface{}{regexp.MustCompile(`^\d+$`), "x"}},
+		{input: "Variant[Integer, Undef]", wantName: "Variant", wantArgs: []interface{}{"Integer", "Undef"}},
+		{input: "Tuple[String, Integer, 1, 2]", wantName: "Tuple", wantArgs: []interface{}{"String", "Integer", int64(1), int64(2)}},
+		{input: "Integer[default, 10]", wantName: "Integer", wantArgs: []interface{}{nil, int64(10)}},
+		{input: "Float[-1.5, 1e-5]", wantName: "Float", wantArgs: []interface{}{-1.5, 1e-5}},
+		{input: "Float[1E+3]", wantName: "Float", wantArgs: []interface{}{1e3}},
+		{input: "Boltlib::TargetSpec", wantName: "Boltlib::TargetSpec", wantArgs: []interface{}{}},
+		{input: "String[1", wantErr: true},
+		{input: "Enum['a", wantErr: true},
+		{input: "Pattern[/a]", wantErr: true},
+		{input: "Struct[{'a' => }]", wantErr: true},
+		{input: "Struct[{'a' String}]", wantErr: true},
+		{input: "String]", wantErr: true},
+		{input: "[String]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parsePuppetType(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePuppetType(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Name != tt.wantName {
+				t.Errorf("Name = %q, want %q", got.Name, tt.wantName)
+			}
+			if tt.wantArgs == nil {
+				return
+			}
+			if len(got.Args) != len(tt.wantArgs) {
+				t.Fatalf("Args = %v, want %v", got.Args, tt.wantArgs)
+			}
+			for i, want := range tt.wantArgs {
+				switch arg := got.Args[i].(type) {
+				case *puppetType:
+					if want, ok := want.(string); !ok || (arg.String() != want && arg.Name != want) {
+						t.Errorf("Args[%d] = %s, want %v", i, arg, want)
+					}
+				case *regexp.Regexp:
+					if want, ok := want.(*regexp.Regexp); !ok || arg.String() != want.String() {
+						t.Errorf("Args[%d] = /%s/, want %v", i, arg, want)
+					}
+				default:
+					if !reflect.DeepEqual(arg, want) {
+						t.Errorf("Args[%d] = %#v, want %#v", i, arg, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParsePuppetTypeStruct(t *testing.T) {
+	got, err := parsePuppetType("Struct[{'name' => String, Optional['port'] => Integer, NotUndef[mode] => Enum[a, b]}]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, ok := got.Args[0].([]*puppetStructMember)
+	if !ok || len(members) != 3 {
+		t.Fatalf("Args = %#v, want 3 struct members", got.Args)
+	}
+	want := []struct {
+		key      string
+		optional bool
+		typ      string
+	}{{"name", false, "String"}, {"port", true, "Integer"}, {"mode", false, "Enum[a, b]"}}
+	for i, w := range want {
+		m := members[i]
+		if m.Key != w.key || m.Optional != w.optional || m.Type.String() != w.typ {
+			t.Errorf("member %d = {%q %v %s}, want %v", i, m.Key, m.Optional, m.Type, w)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		typ     string
+		value   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		// Optional / Undef / NotUndef
+		{typ: "Optional[String]", value: "", want: nil},
+		{typ: "Optional[String]", value: nil, want: nil},
+		{typ: "Optional[Integer]", value: "5", want: 5},
+		{typ: "Optional[Integer]", value: "x", wantErr: true},
+		{typ: "Optional['yes']", value: "yes", want: "yes"},
+		{typ: "Optional['yes']", value: "no", wantErr: true},
+		{typ: "Undef", value: "", want: nil},
+		{typ: "Undef", value: "x", wantErr: true},
+		{typ: "NotUndef[String]", value: nil, wantErr: true},
+		{typ: "Sensitive[String]", value: "secret", want: "secret"},
+		// Scalars
+		{typ: "String", value: "abc", want: "abc"},
+		{typ: "String[1]", value: "", wantErr: true},
+		{typ: "String[1, 2]", value: "abc", wantErr: true},
+		{typ: "Integer", value: " 42 ", want: 42},
+		{typ: "Integer", value: "4.2", wantErr: true},
+		{typ: "Integer[0]", value: "-1", wantErr: true},
+		{typ: "Integer[default, 10]", value: "-100", want: -100},
+		{typ: "Integer[default, 10]", value: "11", wantErr: true},
+		{typ: "Float", value: "1.5", want: 1.5},
+		{typ: "Float[0, 1e-5]", value: "0.00001", want: 0.00001},
+		{typ: "Float[0, 1e-5]", value: "0.1", wantErr: true},
+		{typ: "Numeric", value: "3", want: 3},
+		{typ: "Numeric", value: "3.5", want: 3.5},
+		{typ: "Boolean", value: "Yes", want: true},
+		{typ: "Boolean", value: "0", want: false},
+		{typ: "Boolean", value: "maybe", wantErr: true},
+		// Enum / Pattern / Variant
+		{typ: "Enum['a', 'b']", value: "b", want: "b"},
+		{typ: "Enum['a', 'b']", value: "c", wantErr: true},
+		{typ: "Enum[a, b]", value: "a", want: "a"},
+		{typ: "Enum[a, b]", value: "c", wantErr: true},
+		{typ: "Pattern[/^\\d+$/]", value: "123", want: "123"},
+		{typ: "Pattern[/^\\d+$/]", value: "12a", wantErr: true},
+		{typ: "Pattern['^a', /b$/]", value: "xb", want: "xb"},
+		{typ: "Variant[Integer, Enum['all']]", value: "7", want: 7},
+		{typ: "Variant[Integer, Enum['all']]", value: "all", want: "all"},
+		{typ: "Variant[Integer, Enum['all']]", value: "some", wantErr: true},
+		{typ: "Variant[Undef, String]", value: "", want: nil},
+		// Array / Tuple
+		{typ: "Array[String]", value: "a, b,,c", want: []interface{}{"a", "b", "c"}},
+		{typ: "Array[Integer]", value: "[1, 2]", want: []interface{}{1, 2}},
+		{typ: "Array[Integer]", value: "[1, \"x\"]", wantErr: true},
+		{typ: "Array[String, 1]", value: "", wantErr: true},
+		{typ: "Array[String, 1, 2]", value: "a,b,c", wantErr: true},
+		{typ: "Tuple[String, Integer]", value: `["a", 1]`, want: []interface{}{"a", 1}},
+		{typ: "Tuple[String, Integer]", value: `["a"]`, wantErr: true},
+		{typ: "Tuple[String, Integer, 1]", value: `["a"]`, want: []interface{}{"a"}},
+		{typ: "Tuple[String, Integer, 1, 3]", value: `["a", 1, 2]`, want: []interface{}{"a", 1, 2}},
+		{typ: "Tuple[String, Integer, 1, 3]", value: `["a", 1, 2, 3]`, wantErr: true},
+		// Hash / Struct
+		{typ: "Hash[String, Integer]", value: `{"a": 1}`, want: map[string]interface{}{"a": 1}},
+		{typ: "Hash[String, Integer]", value: `{"a": "x"}`, wantErr: true},
+		{typ: "Hash[String, Any, 1]", value: `{}`, wantErr: true},
+		{typ: "Struct[{'name' => String, Optional['port'] => Integer}]", value: `{"name": "web"}`, want: map[string]interface{}{"name": "web"}},
+		{typ: "Struct[{'name' => String, Optional['port'] => Integer}]", value: `{"name": "web", "port": 80}`, want: map[string]interface{}{"name": "web", "port": 80}},
+		{typ: "Struct[{'name' => String, 'port' => Optional[Integer]}]", value: `{"name": "web"}`, want: map[string]interface{}{"name": "web"}},
+		{typ: "Struct[{'name' => String, Optional['port'] => Integer}]", value: `{"port": 80}`, wantErr: true},
+		{typ: "Struct[{'name' => String}]", value: `{"name": "web", "other": 1}`, wantErr: true},
+		{typ: "Struct[{'name' => String}]", value: `not json`, wantErr: true},
+		// TargetSpec
+		{typ: "TargetSpec", value: "web01,web02", want: "web01,web02"},
+		{typ: "Boltlib::TargetSpec", value: `["web01", "web02"]`, want: []interface{}{"web01", "web02"}},
+		{typ: "TargetSpec", value: "", wantErr: true},
+		// Any / type aliases
+		{typ: "Any", value: `{"a": [1]}`, want: map[string]interface{}{"a": []interface{}{"1"}}},
+		{typ: "Data", value: "plain", want: "plain"},
+		{typ: "Stdlib::Absolutepath", value: "/tmp", want: "/tmp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ+"="+toString(tt.value), func(t *testing.T) {
+			typ, err := parsePuppetType(tt.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := typ.convert(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convert(%v) = %v, error = %v, wantErr %v", tt.value, got, err, tt.wantErr)
+			}
+			if !tt.wantErr && !equalJSONValue(got, tt.want) {
+				t.Errorf("convert(%v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// toString returns the test value as a string (for the sub test name)
+func toString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if value == nil {
+		return "nil"
+	}
+	return "value"
+}
+
+// equalJSONValue compares converted values, json.Number (Any) is compared by its string
+func equalJSONValue(got, want interface{}) bool {
+	switch w := want.(type) {
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !equalJSONValue(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for k := range w {
+			if !equalJSONValue(g[k], w[k]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		if n, ok := got.(interface{ String() string }); ok {
+			return n.String() == w
+		}
+	}
+	return reflect.DeepEqual(got, want)
+}
@@ -3,18 +3,19 @@ package puppet
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/tjm/puppet-patching-automation/functions"
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
-var pdbTimeout = 30 * time.Second
-
 // PDBEnvironments will return puppet environments for the selected puppet server
 func PDBEnvironments(p *models.PuppetServer) (envs []puppetdb.Environment, err error) {
 	client, err := getPDBClient(p)
@@ -115,18 +116,34 @@ func QueryPuppetDBInventory(p *models.PuppetServer, patchRun *models.PatchRun) (
 	if err != nil {
 		return // already logged
 	}
-	query := fmt.Sprintf(`["~","facts.%s","%v"]`, p.FactName, patchRun.PatchWindow)
-	pagination := puppetdb.Pagination{
-		IncludeTotal: true,
+	queries, err := buildInventoryQueries(p, patchRun.NodeSelector)
+	if err != nil {
+		log.Error("Error building puppetDB query: " + err.Error())
+		return
+	}
+	if len(queries) == 0 {
+		log.Info("Inventory Results: 0 (PQL query returned no nodes)")
+		return
 	}
 	orderBy := puppetdb.OrderBy{
 		Field: "certname",
 		Order: "asc",
 	}
-	items, err := client.Inventory(query, &pagination, &orderBy)
-	if err != nil {
-		log.Error("Error querying puppetDB: " + err.Error())
-		return
+	items := make([]puppetdb.Inventory, 0)
+	for _, query := range queries {
+		pagination := puppetdb.Pagination{
+			IncludeTotal: true,
+		}
+		var batch []puppetdb.Inventory
+		batch, err = client.Inventory(query, &pagination, &orderBy)
+		if err != nil {
+			log.Error("Error querying puppetDB: " + err.Error())
+			return
+		}
+		items = append(items, batch...)
+	}
+	if len(queries) > 1 {
+		sort.Slice(items, func(i, j int) bool { return items[i].Certname < items[j].Certname })
 	}
 	log.Info("Inventory Results: ", len(items))
 
@@ -170,6 +187,10 @@ func QueryPuppetDBInventory(p *models.PuppetServer, patchRun *models.PatchRun) (
 		dbServer := component.Server(server.Certname)
 		parseServerResult(dbServer, server, p)
 		dbServer.Save()
+		err = saveFactSnapshot(p, patchRun.ID, models.SnapshotStageInventory, server)
+		if err != nil {
+			log.WithField("server", server.Certname).Error("Error saving fact snapshot: ", err)
+		}
 
 	}
 	return nil
@@ -183,10 +204,19 @@ func parseServerResult(s *models.Server, Server puppetdb.Inventory, p *models.Pu
 	s.IPAddress = getFactString(Server, "ipaddress")
 	s.OperatingSystem = getFactString(Server, "os.name")
 	s.OSVersion = getFactString(Server, "os.release.full")
+	s.OSFamily = getFactString(Server, "os.family")
 	s.PackageUpdates = getFactInt(Server, patchingFact[0]+".package_update_count")
 	s.PatchWindow = getFactString(Server, p.FactName)
 	s.PinnedPackages = getFactArrayOfStrings(Server, patchingFact[0]+".pinned_packages")
+	s.BlockedPackages = getFactArrayOfStrings(Server, patchingFact[0]+".blocked_packages")
 	s.SecurityUpdates = getFactInt(Server, patchingFact[0]+".security_package_update_count")
+	s.UpdatePackages = getFactArrayOfStrings(Server, patchingFact[0]+".package_updates")
+	s.SecurityPackages = getFactArrayOfStrings(Server, patchingFact[0]+".security_package_updates")
+	s.UpdateKBs = getFactArrayOfStrings(Server, patchingFact[0]+".missing_update_kbs")
+	s.Kernel = getFactString(Server, "kernelrelease")
+	s.Uptime = getFactInt(Server, "system_uptime.seconds")
+	s.RebootRequired = getFactBool(Server, patchingFact[0]+".reboots.reboot_required")
+	s.FactsAt = getFactsTime(Server)
 
 	// Get cqjw-xxxxx name for legacy cliqa servers (example)
 	if strings.Contains(Server.Certname, "cliqa") {
@@ -197,24 +227,32 @@ func parseServerResult(s *models.Server, Server puppetdb.Inventory, p *models.Pu
 	s.UUID = getFactString(Server, "dmi.product.uuid")
 }
 
-// getPDBClient Create a Puppet Enterprise client
+// getPDBClient returns the (cached) PuppetDB client
 func getPDBClient(p *models.PuppetServer) (client *puppetdb.Client, err error) {
-	if p.PDBClient == nil {
-		// Validate Orchestrator URL
-		var u *url.URL
-		u, err = url.Parse(p.GetPuppetDBUrl())
+	// Renew the RBAC token (if needed) before the config hash is calculated
+	err = ensureToken(p)
+	if err != nil {
+		return
+	}
+	return models.GetClient(models.ClientKindPuppetDB, p.ID, p.GetConfigHash(), func() (client *puppetdb.Client, err error) {
+		// Validate PuppetDB URL
+		u, err := url.Parse(p.GetPuppetDBUrl())
 		if err != nil {
 			return
 		}
-		fmt.Println(u)
-
-		client = puppetdb.NewClient(u.String(), p.Token, getTLSconfig(p.CACert, p.SSLSkipVerify), pdbTimeout)
-		// pdb.Version() // TODO: Add some simple query to quickly "verify" that the connection is working
-		p.PDBClient = client
-	} else {
-		client = p.PDBClient
-	}
-	return
+		// Resolve the token (it may be an env:, file: or vault: reference)
+		token, err := p.Token.Resolve()
+		if err != nil {
+			return
+		}
+		tlsConfig := functions.GetTLSConfig(p.CACert, p.SSLSkipVerify)
+		client = puppetdb.NewClient(u.String(), token, tlsConfig, p.GetAPITimeout())
+		// NOTE: SetTransport replaces the transport (and TLS config) created by NewClient
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.SetTransport(functions.NewRetryTransport(transport, p.APIRetries))
+		return
+	})
 }
 
 func getFact(facts map[string]interface{}, factPath string) (fact interface{}, err error) {
@@ -262,13 +300,39 @@ func getFactArrayOfStrings(server puppetdb.Inventory, factPath string) (result [
 		}).Info("Error Retrieving Fact: ", err)
 		return
 	}
-	val := fact.([]interface{})
+	val, _ := fact.([]interface{}) // NOTE: null is an empty list
 	for _, v := range val {
-		result = append(result, v.(string))
+		if str, ok := v.(string); ok {
+			result = append(result, str)
+		}
 	}
 	return result
 }
 
+// getFactBool : Return a boolean from a fact, default false
+func getFactBool(server puppetdb.Inventory, factPath string) (result bool) {
+	fact, err := getFact(server.Facts, factPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"certname": server.Certname,
+			"factPath": factPath,
+		}).Info("Error Retrieving Fact: ", err)
+		return false
+	}
+	result, _ = fact.(bool)
+	return
+}
+
+// getFactsTime : Return the time the facts were submitted (zero if unknown)
+func getFactsTime(server puppetdb.Inventory) time.Time {
+	t, err := time.Parse(time.RFC3339, server.Timestamp)
+	if err != nil {
+		log.WithField("certname", server.Certname).Info("Error parsing facts timestamp: ", err)
+		return time.Time{}
+	}
+	return t
+}
+
 // getFactInt : Return an integer from a fact, default 0
 func getFactInt(server puppetdb.Inventory, factPath string) (result int) {
 	fact, err := getFact(server.Facts, factPath)
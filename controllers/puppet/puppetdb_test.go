@@ -0,0 +1,130 @@
+package puppet
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// TestMain hides the (info) log messages for missing facts
+func TestMain(m *testing.M) {
+	log.SetLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+// loadInventoryFixture returns the (recorded) PuppetDB inventory response from testdata
+func loadInventoryFixture(t *testing.T, name string) []puppetdb.Inventory {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []puppetdb.Inventory
+	if err = json.Unmarshal(b, &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestParseServerResult(t *testing.T) {
+	windows := loadInventoryFixture(t, "inventory-windows.json")[0]
+	linux := puppetdb.Inventory{
+		Certname:  "rhel8-app01.example.com",
+		Timestamp: "2023-06-13T14:02:11.532Z",
+		Facts: map[string]interface{}{
+			"kernelrelease": "4.18.0-477.13.1.el8_8.x86_64",
+			"os":            map[string]interface{}{"name": "RedHat", "family": "RedHat"},
+			"pe_patch": map[string]interface{}{
+				"patch_group":          "Week3",
+				"package_update_count": 1.0,
+				"package_updates":      []interface{}{"openssl"},
+			},
+		},
+	}
+	p := &models.PuppetServer{FactName: "pe_patch.patch_group"}
+	p.ID = 1
+	tests := []struct {
+		name        string
+		item        puppetdb.Inventory
+		wantWindows bool
+		wantURL     string
+		wantUpdates int
+		wantKBs     []string
+		wantParams  map[string]interface{}
+	}{
+		{
+			name:        "windows fixture",
+			item:        windows,
+			wantWindows: true,
+			wantURL:     "rdp://win2019-app01.example.com",
+			wantUpdates: 3,
+			wantKBs:     []string{"KB5027222", "KB5027538", "KB2267602"},
+			wantParams:  map[string]interface{}{"reboot": "patched"},
+		},
+		{
+			name:        "linux",
+			item:        linux,
+			wantWindows: false,
+			wantURL:     "ssh://rhel8-app01.example.com",
+			wantUpdates: 1,
+			wantParams:  map[string]interface{}{"reboot": "smart"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &models.Server{Name: tt.item.Certname}
+			parseServerResult(s, tt.item, p)
+			if s.PuppetServerID != p.ID || s.PatchWindow != "Week3" {
+				t.Errorf("PuppetServerID = %d, PatchWindow = %q", s.PuppetServerID, s.PatchWindow)
+			}
+			if s.FactsAt.IsZero() {
+				t.Error("FactsAt not parsed")
+			}
+			if got := s.IsWindows(); got != tt.wantWindows {
+				t.Errorf("IsWindows() = %v, want %v (OSFamily %q)", got, tt.wantWindows, s.OSFamily)
+			}
+			if got := s.GetRemoteURL(); got != tt.wantURL {
+				t.Errorf("GetRemoteURL() = %q, want %q", got, tt.wantURL)
+			}
+			if s.PackageUpdates != tt.wantUpdates {
+				t.Errorf("PackageUpdates = %d, want %d", s.PackageUpdates, tt.wantUpdates)
+			}
+			if len(s.UpdateKBs) != len(tt.wantKBs) || (len(tt.wantKBs) > 0 && !reflect.DeepEqual(s.UpdateKBs, tt.wantKBs)) {
+				t.Errorf("UpdateKBs = %v, want %v", s.UpdateKBs, tt.wantKBs)
+			}
+			if got := defaultPatchParams(s.IsWindows()); !reflect.DeepEqual(got, tt.wantParams) {
+				t.Errorf("defaultPatchParams() = %v, want %v", got, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestWindowsUpdateCategories(t *testing.T) {
+	s := &models.Server{Name: "win2019-app01.example.com"}
+	parseServerResult(s, loadInventoryFixture(t, "inventory-windows.json")[0], &models.PuppetServer{FactName: "pe_patch.patch_group"})
+	want := map[string]models.PackageUpdate{
+		"KB5027222": {Type: models.PackageUpdateSecurity, Category: models.WindowsUpdateCumulative},
+		"KB5027538": {Type: models.PackageUpdateSecurity, Category: models.WindowsUpdateCumulative},
+		"KB2267602": {Type: models.PackageUpdateNormal, Category: models.WindowsUpdateDefinition},
+	}
+	packages := s.GetPackageUpdates("")
+	if len(packages) != len(want) {
+		t.Fatalf("GetPackageUpdates() = %d packages, want %d", len(packages), len(want))
+	}
+	for _, pkg := range packages {
+		w, ok := want[pkg.KB]
+		if !ok || pkg.Type != w.Type || pkg.Category != w.Category {
+			t.Errorf("%s: KB %q, Type %q, Category %q", pkg.Name, pkg.KB, pkg.Type, pkg.Category)
+		}
+	}
+	categories := s.GetWindowsUpdateCategories()
+	if categories[models.WindowsUpdateCumulative] != 2 || categories[models.WindowsUpdateDefinition] != 1 {
+		t.Errorf("GetWindowsUpdateCategories() = %v", categories)
+	}
+}
@@ -0,0 +1,258 @@
+package puppet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/functions"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// certnameBatchSize is the maximum number of certnames in a single PuppetDB query (URL length)
+const certnameBatchSize = 100
+
+var (
+	errNodeSelectorEmpty = errors.New("a patch window or query is required to select nodes")
+	errInvalidASTQuery   = errors.New("invalid AST query (must be a JSON array)")
+)
+
+// NodeCount is the number of nodes matching a NodeSelector on a PuppetServer
+type NodeCount struct {
+	PuppetServerID uint   `json:"puppet_server_id"`
+	PuppetServer   string `json:"puppet_server"`
+	Count          int    `json:"count"`
+	Error          string `json:"error,omitempty"`
+}
+
+// CountNodes will return the number of nodes matching the selector on each enabled PuppetServer
+func CountNodes(selector models.NodeSelector) (counts []NodeCount, total int) {
+	counts = make([]NodeCount, 0)
+	for _, ps := range models.GetEnabledPuppetServers() {
+		nc := NodeCount{PuppetServerID: ps.ID, PuppetServer: ps.Name}
+		count, err := CountPuppetDBInventory(ps, selector)
+		if err != nil {
+			nc.Error = err.Error()
+		}
+		nc.Count = count
+		total += count
+		counts = append(counts, nc)
+	}
+	return
+}
+
+// CountPuppetDBInventory will return the number of nodes matching the selector
+func CountPuppetDBInventory(p *models.PuppetServer, selector models.NodeSelector) (count int, err error) {
+	client, err := getPDBClient(p)
+	if err != nil {
+		return
+	}
+	queries, err := buildInventoryQueries(p, selector)
+	if err != nil {
+		return
+	}
+	for _, query := range queries {
+		pagination := puppetdb.Pagination{
+			Limit:        1,
+			IncludeTotal: true,
+		}
+		_, err = client.Inventory(query, &pagination, nil)
+		if err != nil {
+			log.Error("Error querying puppetDB: " + err.Error())
+			return 0, err
+		}
+		count += pagination.Total
+	}
+	return count, nil
+}
+
+// buildInventoryQueries will build the AST queries for the inventory endpoint from the selector
+// NOTE: A PQL query is expanded to its certnames, in batches of certnameBatchSize (one query per batch),
+// so there are no queries when the PQL query did not return any nodes (there is nothing to query)
+func buildInventoryQueries(p *models.PuppetServer, selector models.NodeSelector) (queries []string, err error) {
+	if selector.IsEmpty() {
+		return nil, errNodeSelectorEmpty
+	}
+	and := []interface{}{"and"}
+
+	// Patch Windows (regex on FactName)
+	if windows := selector.GetPatchWindows(); len(windows) > 0 {
+		and = append(and, matchAny("~", "facts."+p.FactName, windows))
+	}
+
+	// Fact Filters
+	if families := selector.GetOSFamilies(); len(families) > 0 {
+		and = append(and, matchAny("=", "facts.os.family", families))
+	}
+	if environments := selector.GetPuppetEnvironments(); len(environments) > 0 {
+		and = append(and, matchAny("=", "environment", environments))
+	}
+	if globs := selector.GetCertnameFilters(); len(globs) > 0 {
+		regexes := make([]string, 0, len(globs))
+		for _, glob := range globs {
+			regexes = append(regexes, globToRegex(glob))
+		}
+		and = append(and, matchAny("~", "certname", regexes))
+	}
+
+	// Advanced Query (PQL or AST)
+	if strings.TrimSpace(selector.Query) != "" {
+		if selector.IsPQL() {
+			var certnames []string
+			certnames, err = queryPQLCertnames(p, selector.Query)
+			if err != nil {
+				return
+			}
+			return inventoryBatchQueries(and, certnames)
+		}
+		var ast []interface{}
+		err = json.Unmarshal([]byte(selector.Query), &ast)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidASTQuery, err.Error())
+		}
+		and = append(and, ast)
+	}
+
+	query, err := marshalQuery(andQuery(and))
+	if err != nil {
+		return
+	}
+	return []string{query}, nil
+}
+
+// inventoryBatchQueries returns one AST query per batch of certnames, each combined with the other conditions
+func inventoryBatchQueries(and []interface{}, certnames []string) (queries []string, err error) {
+	for _, inCertnames := range inCertnameBatches(certnames) {
+		conditions := append(append([]interface{}{}, and...), inCertnames)
+		var query string
+		query, err = marshalQuery(andQuery(conditions))
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return
+}
+
+// andQuery returns the "and" AST query, or the single condition (no need for "and" with a single condition)
+func andQuery(and []interface{}) interface{} {
+	if len(and) == 2 {
+		return and[1]
+	}
+	return and
+}
+
+// matchAny returns an AST query where the field matches (op) any of the values
+func matchAny(op, field string, values []string) []interface{} {
+	if len(values) == 1 {
+		return []interface{}{op, field, values[0]}
+	}
+	or := []interface{}{"or"}
+	for _, value := range values {
+		or = append(or, []interface{}{op, field, value})
+	}
+	return or
+}
+
+// groupServersByPuppetServer returns the servers indexed by PuppetServer ID
+func groupServersByPuppetServer(servers models.Servers) (serverList map[uint]models.Servers) {
+	serverList = make(map[uint]models.Servers)
+	for _, server := range servers {
+		serverList[server.PuppetServerID] = append(serverList[server.PuppetServerID], server)
+	}
+	return
+}
+
+// certnameBatches returns AST queries matching the server certnames, in batches of certnameBatchSize
+func certnameBatches(servers models.Servers) (batches [][]interface{}) {
+	certnames := make([]string, 0, len(servers))
+	for _, server := range servers {
+		certnames = append(certnames, server.Name)
+	}
+	return inCertnameBatches(certnames)
+}
+
+// inCertnameBatches returns AST queries matching the certnames, in batches of certnameBatchSize
+func inCertnameBatches(certnames []string) (batches [][]interface{}) {
+	for start := 0; start < len(certnames); start += certnameBatchSize {
+		end := start + certnameBatchSize
+		if end > len(certnames) {
+			end = len(certnames)
+		}
+		array := make([]interface{}, 0, end-start)
+		for _, certname := range certnames[start:end] {
+			array = append(array, certname)
+		}
+		batches = append(batches, []interface{}{"in", "certname", []interface{}{"array", array}})
+	}
+	return
+}
+
+// marshalQuery returns the AST query as a string
+func marshalQuery(q interface{}) (query string, err error) {
+	b, err := json.Marshal(q)
+	return string(b), err
+}
+
+// globToRegex converts a glob (i.e. web*.example.com) to an anchored regex
+func globToRegex(glob string) string {
+	regex := regexp.QuoteMeta(glob)
+	regex = strings.ReplaceAll(regex, `\*`, ".*")
+	regex = strings.ReplaceAll(regex, `\?`, ".")
+	return "^" + regex + "$"
+}
+
+// queryPQLCertnames will run the PQL query and return the certnames from the results
+// NOTE: The go-pe-client root query forces paging parameters, which are not supported with PQL, so this is a direct request.
+func queryPQLCertnames(p *models.PuppetServer, pql string) (certnames []string, err error) {
+	err = ensureToken(p)
+	if err != nil {
+		return
+	}
+	token, err := p.Token.Resolve()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.GetAPITimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.GetPuppetDBUrl()+"/pdb/query/v4?query="+url.QueryEscape(pql), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Authentication", token)
+	client := functions.NewHTTPClient(functions.GetTLSConfig(p.CACert, p.SSLSkipVerify), p.GetAPITimeout(), p.APIRetries)
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("PQL query returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var results []map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	if err != nil {
+		return
+	}
+	found := make(map[string]bool)
+	for _, result := range results {
+		if certname, ok := result["certname"].(string); ok && !found[certname] {
+			found[certname] = true
+			certnames = append(certnames, certname)
+		}
+	}
+	if len(results) > 0 && len(certnames) == 0 {
+		err = fmt.Errorf("PQL query must return certname (i.e. inventory[certname] { ... })")
+	}
+	return
+}
@@ -0,0 +1,63 @@
+package puppet
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestInventoryBatchQueries(t *testing.T) {
+	certnames := make([]string, 0, certnameBatchSize*2+1)
+	for i := 0; i < cap(certnames); i++ {
+		certnames = append(certnames, fmt.Sprintf("node%03d.example.com", i))
+	}
+	tests := []struct {
+		name        string
+		and         []interface{}
+		certnames   []string
+		wantQueries int
+		wantAnd     bool
+	}{
+		{"no certnames", []interface{}{"and"}, nil, 0, false},
+		{"single batch", []interface{}{"and"}, certnames[:3], 1, false},
+		{"single batch with conditions", []interface{}{"and", []interface{}{"=", "facts.os.family", "RedHat"}}, certnames[:3], 1, true},
+		{"multiple batches", []interface{}{"and"}, certnames, 3, false},
+		{"multiple batches with conditions", []interface{}{"and", []interface{}{"=", "environment", "production"}}, certnames, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries, err := inventoryBatchQueries(tt.and, tt.certnames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(queries) != tt.wantQueries {
+				t.Fatalf("got %d queries, want %d", len(queries), tt.wantQueries)
+			}
+			total := 0
+			for _, query := range queries {
+				var q []interface{}
+				if err = json.Unmarshal([]byte(query), &q); err != nil {
+					t.Fatal(err)
+				}
+				in := q
+				if tt.wantAnd {
+					if q[0] != "and" || len(q) != 3 {
+						t.Fatalf("query %s: want the conditions and the certnames", query)
+					}
+					in = q[2].([]interface{})
+				}
+				if in[0] != "in" || in[1] != "certname" {
+					t.Fatalf("query %s: want an in certname query", query)
+				}
+				array := in[2].([]interface{})[1].([]interface{})
+				if len(array) > certnameBatchSize {
+					t.Errorf("query has %d certnames, want at most %d", len(array), certnameBatchSize)
+				}
+				total += len(array)
+			}
+			if total != len(tt.certnames) {
+				t.Errorf("got %d certnames, want %d", total, len(tt.certnames))
+			}
+		})
+	}
+}
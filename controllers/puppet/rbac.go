@@ -0,0 +1,184 @@
+package puppet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/functions"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// rbacTokenLabel identifies tokens created by this application (in the PE console)
+const rbacTokenLabel = "patching-automation"
+
+// RBAC token renewal backoff (after a failed renewal, ensureToken waits before trying again)
+const (
+	rbacMinBackoff = 30 * time.Second
+	rbacMaxBackoff = 10 * time.Minute
+)
+
+// rbacMutex prevents concurrent token requests (and protects rbacFailures)
+var rbacMutex sync.Mutex
+
+// rbacFailures are the last failed token renewals, by PuppetServer ID
+var rbacFailures = make(map[uint]*rbacFailure)
+
+// rbacFailure is a failed token renewal, the next renewal is not attempted until the backoff has passed
+type rbacFailure struct {
+	at      time.Time
+	backoff time.Duration
+	err     error
+}
+
+// rbacTokenRequest is the body of a /rbac-api/v1/auth/token request
+type rbacTokenRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Lifetime string `json:"lifetime"`
+	Label    string `json:"label"`
+}
+
+// rbacTokenResponse is the response from /rbac-api/v1/auth/token (or an error)
+type rbacTokenResponse struct {
+	Token string `json:"token"`
+	Kind  string `json:"kind"`
+	Msg   string `json:"msg"`
+}
+
+// RenewToken will request a new token from the PE RBAC API, using the RBAC service account
+// NOTE: This is not subject to the backoff of ensureToken (i.e. renewing from the WebUI)
+func RenewToken(p *models.PuppetServer) (err error) {
+	if !p.UsesRBACToken() {
+		return fmt.Errorf("puppet server %s does not have an RBAC service account (RBACUsername)", p.Name)
+	}
+	rbacMutex.Lock()
+	defer rbacMutex.Unlock()
+	return renewToken(p)
+}
+
+// renewToken will request a new token and record the result (rbacMutex must be held)
+func renewToken(p *models.PuppetServer) (err error) {
+	token, expiration, tokenErr := requestRBACToken(p)
+	if tokenErr != nil {
+		log.WithFields(log.Fields{
+			"puppetServer": p.Name,
+			"rbacUsername": p.RBACUsername,
+		}).Error("Error requesting RBAC token: ", tokenErr)
+		recordRBACFailure(p.ID, tokenErr)
+	} else {
+		log.WithFields(log.Fields{
+			"puppetServer": p.Name,
+			"expiration":   expiration,
+		}).Info("RBAC token renewed")
+		delete(rbacFailures, p.ID)
+	}
+	err = p.SetRBACToken(token, expiration, tokenErr)
+	if err != nil {
+		log.Error("Error saving RBAC token: ", err)
+		return
+	}
+	return tokenErr
+}
+
+// recordRBACFailure records a failed renewal, doubling the backoff of the previous failure (rbacMutex must be held)
+func recordRBACFailure(puppetServerID uint, err error) {
+	backoff := rbacMinBackoff
+	if last, ok := rbacFailures[puppetServerID]; ok {
+		backoff = last.backoff * 2
+		if backoff > rbacMaxBackoff {
+			backoff = rbacMaxBackoff
+		}
+	}
+	rbacFailures[puppetServerID] = &rbacFailure{at: time.Now(), backoff: backoff, err: err}
+}
+
+// ensureToken will renew the RBAC token if it is missing or will expire soon
+// NOTE: If renewal fails, but the existing token has not expired, the existing token is used.
+// After a failed renewal, the renewal is not attempted again until the backoff has passed.
+func ensureToken(p *models.PuppetServer) (err error) {
+	if !p.TokenNeedsRenewal() {
+		return
+	}
+	rbacMutex.Lock()
+	defer rbacMutex.Unlock()
+
+	// Another request may have renewed the token while waiting for the lock
+	err = p.ReloadToken()
+	if err != nil {
+		return
+	}
+	if !p.TokenNeedsRenewal() {
+		return
+	}
+	if last, ok := rbacFailures[p.ID]; ok && time.Since(last.at) < last.backoff {
+		err = fmt.Errorf("RBAC token renewal failed %s ago (retrying after %s): %w",
+			time.Since(last.at).Round(time.Second), last.backoff, last.err)
+	} else {
+		err = renewToken(p)
+	}
+	if err != nil && p.Token != "" && time.Now().Before(p.TokenExpiration) {
+		log.WithField("puppetServer", p.Name).Warn("Using existing RBAC token until it expires")
+		err = nil
+	}
+	return
+}
+
+// requestRBACToken POSTs to /rbac-api/v1/auth/token
+func requestRBACToken(p *models.PuppetServer) (token string, expiration time.Time, err error) {
+	password, err := p.RBACPassword.Resolve()
+	if err != nil {
+		return
+	}
+	lifetime := p.GetRBACTokenLifetime()
+	body, err := json.Marshal(rbacTokenRequest{
+		Login:    p.RBACUsername,
+		Password: password,
+		Lifetime: fmt.Sprintf("%dh", p.RBACTokenLifetime),
+		Label:    rbacTokenLabel,
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.GetAPITimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.GetRBACURL()+"/rbac-api/v1/auth/token", bytes.NewBuffer(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// NOTE: POST requests are not retried
+	client := functions.NewHTTPClient(functions.GetTLSConfig(p.CACert, p.SSLSkipVerify), p.GetAPITimeout(), 0)
+	requested := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var result rbacTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK {
+		if err == nil && result.Msg != "" {
+			err = fmt.Errorf("RBAC API returned %s: %s (%s)", resp.Status, result.Msg, result.Kind)
+		} else {
+			err = fmt.Errorf("RBAC API returned %s", resp.Status)
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	if result.Token == "" {
+		err = fmt.Errorf("RBAC API did not return a token")
+		return
+	}
+	return result.Token, requested.Add(lifetime), nil
+}
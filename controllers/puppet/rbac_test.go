@@ -0,0 +1,28 @@
+package puppet
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecordRBACFailure(t *testing.T) {
+	defer delete(rbacFailures, 99)
+	tokenErr := errors.New("RBAC API returned 401 Unauthorized")
+	want := []time.Duration{rbacMinBackoff, 2 * rbacMinBackoff, 4 * rbacMinBackoff}
+	for i, backoff := range want {
+		recordRBACFailure(99, tokenErr)
+		if got := rbacFailures[99].backoff; got != backoff {
+			t.Errorf("failure %d: backoff = %s, want %s", i+1, got, backoff)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		recordRBACFailure(99, tokenErr)
+	}
+	if got := rbacFailures[99].backoff; got != rbacMaxBackoff {
+		t.Errorf("backoff = %s, want the maximum %s", got, rbacMaxBackoff)
+	}
+	if !errors.Is(rbacFailures[99].err, tokenErr) {
+		t.Errorf("err = %v, want %v", rbacFailures[99].err, tokenErr)
+	}
+}
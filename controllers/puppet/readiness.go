@@ -0,0 +1,122 @@
+package puppet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/functions"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// CheckPatchRunReadiness will check every Server in the patch run is ready for patching (from the PuppetDB nodes and reports)
+// - failed: the last puppet run failed
+// - unreported: no puppet report for longer than the UnreportedThreshold
+// - noop: the last puppet run was in noop mode
+func CheckPatchRunReadiness(patchRun *models.PatchRun) (servers models.Servers, errs []error) {
+	servers = patchRun.GetAllServers()
+	now := time.Now()
+	threshold := config.GetArgs().UnreportedThreshold
+	for psid, list := range groupServersByPuppetServer(servers) {
+		p, err := models.GetPuppetServerByID(psid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PuppetServer %v: %w", psid, err))
+			continue
+		}
+		nodes, failures, err := getNodeReports(p, list)
+		if err != nil {
+			log.Error("Error checking readiness on PuppetServer: ", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		for _, server := range list {
+			server.ReadinessStatus, server.ReadinessMessage = checkReadiness(nodes[server.Name], failures[server.Name], threshold, now)
+			server.ReadinessCheckedAt = now
+			server.Save()
+		}
+	}
+	log.WithFields(log.Fields{"patchRun": patchRun.ID, "servers": len(servers)}).Info("Checked patch run readiness")
+	return
+}
+
+// checkReadiness returns the readiness status and message for a node
+func checkReadiness(node *puppetdb.Node, failure string, threshold time.Duration, now time.Time) (status string, message string) {
+	if node == nil {
+		return models.ReadinessUnknown, "Not found in PuppetDB (or deactivated)"
+	}
+	if node.LatestReportStatus == "failed" {
+		if failure != "" {
+			return models.ReadinessFailed, "Last puppet run failed: " + failure
+		}
+		return models.ReadinessFailed, "Last puppet run failed"
+	}
+	if node.ReportTimestamp == "" {
+		return models.ReadinessUnreported, "No puppet reports"
+	}
+	lastReport, err := time.Parse(time.RFC3339, node.ReportTimestamp)
+	if err != nil {
+		return models.ReadinessUnreported, "Invalid report timestamp: " + node.ReportTimestamp
+	}
+	if threshold > 0 && now.Sub(lastReport) > threshold {
+		return models.ReadinessUnreported, "No puppet report since " + functions.FormatAsISO8601(lastReport)
+	}
+	if node.LatestReportNoop {
+		return models.ReadinessNoop, "Last puppet run was in noop mode"
+	}
+	return models.ReadinessReady, ""
+}
+
+// getNodeReports will query PuppetDB for the (active) nodes and the first error of the latest report of failed nodes
+func getNodeReports(p *models.PuppetServer, servers models.Servers) (nodes map[string]*puppetdb.Node, failures map[string]string, err error) {
+	client, err := getPDBClient(p)
+	if err != nil {
+		return
+	}
+	nodes = make(map[string]*puppetdb.Node)
+	failures = make(map[string]string)
+	for _, inCertnames := range certnameBatches(servers) {
+		var query string
+		query, err = marshalQuery(inCertnames)
+		if err != nil {
+			return
+		}
+		var list []puppetdb.Node
+		list, err = client.Nodes(query, nil, nil)
+		if err != nil {
+			return
+		}
+		failed := make([]string, 0)
+		for i := range list {
+			nodes[list[i].Certname] = &list[i]
+			if list[i].LatestReportStatus == "failed" {
+				failed = append(failed, list[i].Certname)
+			}
+		}
+		if len(failed) == 0 {
+			continue
+		}
+
+		// Latest reports of the failed nodes (for the error message)
+		query, err = marshalQuery([]interface{}{"and", []interface{}{"=", "latest_report?", true}, matchAny("=", "certname", failed)})
+		if err != nil {
+			return
+		}
+		var reports []puppetdb.Report
+		reports, err = client.Reports(query, nil, nil)
+		if err != nil {
+			return
+		}
+		for _, report := range reports {
+			for _, entry := range report.Logs.Data {
+				if entry.Level == "err" {
+					failures[report.Certname] = entry.Message
+					break
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,142 @@
+package puppet
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// rebootTolerance allows for clock skew and rounding when comparing boot times
+const rebootTolerance = time.Minute
+
+// VerifyPatchResults will re-read the facts for every Server in the patch run (not excluded) and compare them to the pre-patch fact snapshot
+// NOTE: Servers that still need patches or did not reboot (when required) are flagged
+func VerifyPatchResults(patchRun *models.PatchRun) (servers models.Servers, errs []error) {
+	servers = patchRun.GetAllServers().GetIncluded()
+	now := time.Now()
+	for psid, list := range groupServersByPuppetServer(servers) {
+		p, err := models.GetPuppetServerByID(psid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PuppetServer %v: %w", psid, err))
+			continue
+		}
+		items, err := getInventoryForServers(p, list)
+		if err != nil {
+			log.Error("Error verifying patch results on PuppetServer: ", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		for _, server := range list {
+			item, ok := items[server.Name]
+			if ok {
+				var pre *models.FactSnapshot
+				pre, err = models.GetFactSnapshot(patchRun.ID, server.Name, models.SnapshotStagePre)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", server.Name, err))
+					continue
+				}
+				server.PatchResult = checkPatchResult(pre, item, p)
+				err = saveFactSnapshot(p, patchRun.ID, models.SnapshotStagePost, item)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", server.Name, err))
+				}
+			} else {
+				server.PatchResult = models.PatchResult{Status: models.PatchResultUnknown, Message: "Facts not found in PuppetDB"}
+			}
+			server.PatchResult.VerifiedAt = now
+			server.Save()
+		}
+	}
+	log.WithFields(log.Fields{"patchRun": patchRun.ID, "servers": len(servers)}).Info("Verified patch run results")
+	return
+}
+
+// checkPatchResult compares the fresh facts (item) to the pre-patch fact snapshot (pre, ID 0 if not taken)
+// NOTE: The Server row is not used, it is overwritten by every PuppetDB query of the patch run
+func checkPatchResult(pre *models.FactSnapshot, item puppetdb.Inventory, p *models.PuppetServer) (result models.PatchResult) {
+	post := getPatchFacts(item, p)
+	result.PackageUpdates = post.PackageUpdates
+	result.SecurityUpdates = post.SecurityUpdates
+	result.Kernel = post.Kernel
+	result.Uptime = post.Uptime
+	result.RebootRequired = post.RebootRequired
+
+	if pre.ID == 0 {
+		result.Message = fmt.Sprintf("Updates: %d, Security: %d (no pre-patch fact snapshot, run the readiness check before patching)",
+			result.PackageUpdates, result.SecurityUpdates)
+		if result.PackageUpdates > 0 || result.SecurityUpdates > 0 {
+			result.Status = models.PatchResultNeedsPatches
+		} else {
+			result.Status = models.PatchResultUnknown
+		}
+		return
+	}
+	before := pre.PatchFacts
+
+	// Rebooted if the server booted after the pre-patch facts were submitted (unknown without both timestamps)
+	rebootKnown := !before.FactsAt.IsZero() && !post.FactsAt.IsZero()
+	if rebootKnown {
+		preBoot := before.FactsAt.Add(-time.Duration(before.Uptime) * time.Second)
+		postBoot := post.FactsAt.Add(-time.Duration(post.Uptime) * time.Second)
+		result.Rebooted = postBoot.After(preBoot.Add(rebootTolerance))
+	}
+
+	changes := []string{
+		fmt.Sprintf("Updates: %d → %d", before.PackageUpdates, result.PackageUpdates),
+		fmt.Sprintf("Security: %d → %d", before.SecurityUpdates, result.SecurityUpdates),
+	}
+	if result.Kernel != before.Kernel {
+		changes = append(changes, fmt.Sprintf("Kernel: %s → %s", before.Kernel, result.Kernel))
+	}
+	switch {
+	case !rebootKnown:
+		changes = append(changes, "Rebooted: unknown")
+	case result.Rebooted:
+		changes = append(changes, "Rebooted")
+	}
+	result.Message = strings.Join(changes, ", ")
+
+	switch {
+	case result.PackageUpdates > 0 || result.SecurityUpdates > 0:
+		result.Status = models.PatchResultNeedsPatches
+	case result.RebootRequired:
+		result.Status = models.PatchResultNotRebooted
+	case before.RebootRequired && !rebootKnown:
+		result.Status = models.PatchResultUnknown
+	case before.RebootRequired && !result.Rebooted:
+		result.Status = models.PatchResultNotRebooted
+	default:
+		result.Status = models.PatchResultPatched
+	}
+	return
+}
+
+// getInventoryForServers will query the PuppetDB inventory for the servers, indexed by certname
+func getInventoryForServers(p *models.PuppetServer, servers models.Servers) (items map[string]puppetdb.Inventory, err error) {
+	client, err := getPDBClient(p)
+	if err != nil {
+		return
+	}
+	items = make(map[string]puppetdb.Inventory)
+	for _, inCertnames := range certnameBatches(servers) {
+		var query string
+		query, err = marshalQuery(inCertnames)
+		if err != nil {
+			return
+		}
+		var list []puppetdb.Inventory
+		list, err = client.Inventory(query, nil, nil)
+		if err != nil {
+			return
+		}
+		for _, item := range list {
+			items[item.Certname] = item
+		}
+	}
+	return
+}
@@ -0,0 +1,73 @@
+package puppet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// TakeFactSnapshots will snapshot the facts for every Server in the patch run (not excluded) at the stage
+// NOTE: Existing snapshots are only replaced if replace is true, otherwise only the missing snapshots are taken
+func TakeFactSnapshots(patchRun *models.PatchRun, stage string, replace bool) (count int, errs []error) {
+	servers := patchRun.GetAllServers().GetIncluded()
+	if !replace {
+		taken := models.GetFactSnapshotCertnames(patchRun.ID, stage)
+		missing := make(models.Servers, 0, len(servers))
+		for _, server := range servers {
+			if !taken[server.Name] {
+				missing = append(missing, server)
+			}
+		}
+		servers = missing
+	}
+	for psid, list := range groupServersByPuppetServer(servers) {
+		p, err := models.GetPuppetServerByID(psid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PuppetServer %v: %w", psid, err))
+			continue
+		}
+		items, err := getInventoryForServers(p, list)
+		if err != nil {
+			log.Error("Error taking fact snapshots on PuppetServer: ", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		for _, item := range items {
+			err = saveFactSnapshot(p, patchRun.ID, stage, item)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", item.Certname, err))
+				continue
+			}
+			count++
+		}
+	}
+	log.WithFields(log.Fields{"patchRun": patchRun.ID, "stage": stage, "snapshots": count}).Info("Took fact snapshots")
+	return
+}
+
+// saveFactSnapshot will save the snapshot facts (configured on the PuppetServer) and the patch facts from the inventory item
+func saveFactSnapshot(p *models.PuppetServer, patchRunID uint, stage string, item puppetdb.Inventory) (err error) {
+	facts := make(map[string]interface{})
+	for _, factPath := range p.GetSnapshotFacts() {
+		if fact, err := getFact(item.Facts, factPath); err == nil { // skip facts that are not found
+			facts[factPath] = fact
+		}
+	}
+	return models.SaveFactSnapshot(patchRunID, item.Certname, stage, facts, getPatchFacts(item, p))
+}
+
+// getPatchFacts returns the facts used to verify the patch results from the inventory item
+func getPatchFacts(item puppetdb.Inventory, p *models.PuppetServer) (facts models.PatchFacts) {
+	patchingFact := strings.Split(p.FactName, ".")
+	facts.PackageUpdates = getFactInt(item, patchingFact[0]+".package_update_count")
+	facts.SecurityUpdates = getFactInt(item, patchingFact[0]+".security_package_update_count")
+	facts.Kernel = getFactString(item, "kernelrelease")
+	facts.Uptime = getFactInt(item, "system_uptime.seconds")
+	facts.RebootRequired = getFactBool(item, patchingFact[0]+".reboots.reboot_required")
+	facts.FactsAt = getFactsTime(item)
+	return
+}
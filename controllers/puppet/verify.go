@@ -0,0 +1,170 @@
+package puppet
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/functions"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// nodeDetails is what PuppetDB knows about a node (certname)
+type nodeDetails struct {
+	node        *puppetdb.Node
+	patchWindow interface{}
+	renamedTo   string
+}
+
+// VerifyPatchRun will re-check every Server in the patch run against PuppetDB (exists, active, same patch window, last report)
+// NOTE: Servers that have drifted are excluded from patching when autoExclude is true
+func VerifyPatchRun(patchRun *models.PatchRun, autoExclude bool) (servers models.Servers, errs []error) {
+	servers = patchRun.GetAllServers()
+	now := time.Now()
+	threshold := config.GetArgs().StaleNodeThreshold
+	for psid, list := range groupServersByPuppetServer(servers) {
+		p, err := models.GetPuppetServerByID(psid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PuppetServer %v: %w", psid, err))
+			continue
+		}
+		details, err := getNodeDetails(p, list)
+		if err != nil {
+			log.Error("Error verifying nodes on PuppetServer: ", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		for _, server := range list {
+			server.DriftStatus, server.DriftMessage = checkDrift(server, details[server.Name], threshold, now)
+			if d := details[server.Name]; d.node != nil {
+				server.LastReport, _ = time.Parse(time.RFC3339, d.node.ReportTimestamp)
+			}
+			server.VerifiedAt = now
+			if autoExclude && server.HasDrift() && !server.Excluded {
+				server.Excluded = true
+				server.ExcludedReason = server.DriftMessage
+			}
+			server.Save()
+		}
+	}
+	log.WithFields(log.Fields{"patchRun": patchRun.ID, "servers": len(servers), "autoExclude": autoExclude}).Info("Verified patch run servers against PuppetDB")
+	return
+}
+
+// checkDrift returns the drift status and message for a server from the PuppetDB node details
+func checkDrift(server *models.Server, d nodeDetails, threshold time.Duration, now time.Time) (status string, message string) {
+	if d.node == nil {
+		if d.renamedTo != "" {
+			return models.DriftStatusMissing, fmt.Sprintf("Not found in PuppetDB, renamed to %s?", d.renamedTo)
+		}
+		return models.DriftStatusMissing, "Not found in PuppetDB"
+	}
+	if d.node.Deactivated != nil {
+		return models.DriftStatusDeactivated, fmt.Sprintf("Deactivated in PuppetDB at %v", d.node.Deactivated)
+	}
+	if d.node.Expired != nil {
+		return models.DriftStatusDeactivated, fmt.Sprintf("Expired in PuppetDB at %v", d.node.Expired)
+	}
+	window := "UNSET" // same default as getFactString
+	if d.patchWindow != nil {
+		window = fmt.Sprint(d.patchWindow)
+	}
+	if window != server.PatchWindow {
+		return models.DriftStatusMoved, fmt.Sprintf("Patch window changed from %s to %s", server.PatchWindow, window)
+	}
+	if d.node.ReportTimestamp == "" {
+		return models.DriftStatusStale, "No puppet reports"
+	}
+	lastReport, err := time.Parse(time.RFC3339, d.node.ReportTimestamp)
+	if err != nil {
+		return models.DriftStatusStale, "Invalid report timestamp: " + d.node.ReportTimestamp
+	}
+	if threshold > 0 && now.Sub(lastReport) > threshold {
+		return models.DriftStatusStale, "No puppet report since " + functions.FormatAsISO8601(lastReport)
+	}
+	return models.DriftStatusOK, ""
+}
+
+// getNodeDetails will query PuppetDB for the nodes (including deactivated and expired), their patch window and renamed nodes (by UUID)
+func getNodeDetails(p *models.PuppetServer, servers models.Servers) (details map[string]nodeDetails, err error) {
+	client, err := getPDBClient(p)
+	if err != nil {
+		return
+	}
+	details = make(map[string]nodeDetails)
+	for _, inCertnames := range certnameBatches(servers) {
+		// Nodes (mentioning node_state includes deactivated and expired nodes)
+		var query string
+		query, err = marshalQuery([]interface{}{"and", inCertnames,
+			[]interface{}{"or", []interface{}{"=", "node_state", "active"}, []interface{}{"=", "node_state", "inactive"}}})
+		if err != nil {
+			return
+		}
+		var nodes []puppetdb.Node
+		nodes, err = client.Nodes(query, nil, nil)
+		if err != nil {
+			return
+		}
+		for i := range nodes {
+			d := details[nodes[i].Certname]
+			d.node = &nodes[i]
+			details[nodes[i].Certname] = d
+		}
+
+		// Patch Window fact
+		var path interface{}
+		err = json.Unmarshal([]byte(p.GetFactNamePath()), &path)
+		if err != nil {
+			return
+		}
+		query, err = marshalQuery([]interface{}{"and", []interface{}{"=", "path", path}, inCertnames})
+		if err != nil {
+			return
+		}
+		var facts []puppetdb.Fact
+		facts, err = client.FactContents(query, nil, nil)
+		if err != nil {
+			return
+		}
+		for _, fact := range facts {
+			d := details[fact.Certname]
+			d.patchWindow = fact.Value
+			details[fact.Certname] = d
+		}
+	}
+
+	// Look for renamed nodes (missing nodes with the same UUID under another certname)
+	uuids := make(map[string]string)
+	for _, server := range servers {
+		if details[server.Name].node == nil && server.UUID != "" && server.UUID != "UNSET" && server.UUID != "NULL" {
+			uuids[server.UUID] = server.Name
+		}
+	}
+	if len(uuids) == 0 {
+		return
+	}
+	values := make([]string, 0, len(uuids))
+	for uuid := range uuids {
+		values = append(values, uuid)
+	}
+	query, err := marshalQuery(matchAny("=", "facts.dmi.product.uuid", values))
+	if err != nil {
+		return
+	}
+	items, err := client.Inventory(query, nil, nil)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		if name, ok := uuids[getFactString(item, "dmi.product.uuid")]; ok && item.Certname != name {
+			d := details[name]
+			d.renamedTo = item.Certname
+			details[name] = d
+		}
+	}
+	return
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/controllers/puppet"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// GetPuppetServerImportTasks endpoint (GET) lists the tasks of an environment for the bulk import
+// - PathParams: id (PuppetServerID)
+// - QueryParams: environment (default: production), filter (module globs, comma separated, i.e. mymod::*)
+func GetPuppetServerImportTasks(c *gin.Context) {
+	showPuppetServerImport(c, "tasks")
+}
+
+// GetPuppetServerImportPlans endpoint (GET) lists the plans of an environment for the bulk import
+// - PathParams: id (PuppetServerID)
+// - QueryParams: environment (default: production), filter (module globs, comma separated, i.e. mymod::*)
+func GetPuppetServerImportPlans(c *gin.Context) {
+	showPuppetServerImport(c, "plans")
+}
+
+// ImportPuppetServerTasks endpoint (POST) creates (or associates) the selected tasks
+// - PathParams: id (PuppetServerID)
+// - FormParams: Environment, Names (multiple)
+func ImportPuppetServerTasks(c *gin.Context) {
+	puppetServer, err := getPuppetServer(c)
+	if err != nil {
+		return
+	}
+	env := c.DefaultPostForm("Environment", "production")
+	names := c.PostFormArray("Names")
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "no tasks selected"})
+		return
+	}
+	tasks, errs := puppet.ImportTasks(puppetServer, env, names)
+	if len(tasks) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Error importing tasks", "errors": errs})
+		return
+	}
+	data := gin.H{"status": "success", "tasks": tasks, "errors": errs, "puppet_server": puppetServer}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "puppetTask-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// ImportPuppetServerPlans endpoint (POST) creates (or associates) the selected plans
+// - PathParams: id (PuppetServerID)
+// - FormParams: Environment, Names (multiple)
+func ImportPuppetServerPlans(c *gin.Context) {
+	puppetServer, err := getPuppetServer(c)
+	if err != nil {
+		return
+	}
+	env := c.DefaultPostForm("Environment", "production")
+	names := c.PostFormArray("Names")
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "no plans selected"})
+		return
+	}
+	plans, errs := puppet.ImportPlans(puppetServer, env, names)
+	if len(plans) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Error importing plans", "errors": errs})
+		return
+	}
+	data := gin.H{"status": "success", "plans": plans, "errors": errs, "puppet_server": puppetServer}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "puppetPlan-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// SyncPuppetServerCatalog endpoint (POST) re-syncs the tasks and plans associated to the PuppetServer
+// - PathParams: id (PuppetServerID)
+func SyncPuppetServerCatalog(c *gin.Context) {
+	puppetServer, err := getPuppetServer(c)
+	if err != nil {
+		return
+	}
+	tasks, err := puppetServer.GetTasks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	plans, err := puppetServer.GetPlans()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	result := puppet.SyncCatalog(tasks, plans)
+	data := gin.H{"status": "success", "result": result, "puppet_server": puppetServer}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "puppetserver-catalogSync.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, puppetServer.GetBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// StartCatalogSync will re-sync all tasks and plans periodically (CatalogSyncInterval), if enabled
+func StartCatalogSync() {
+	interval := config.GetArgs().CatalogSyncInterval
+	if interval <= 0 {
+		return
+	}
+	log.WithField("interval", interval).Info("Starting periodic catalog sync")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			result := puppet.SyncCatalog(models.GetPuppetTasks(), models.GetPuppetPlans())
+			if len(result.Removed) > 0 || len(result.Errors) > 0 {
+				log.WithFields(log.Fields{
+					"removed": result.Removed,
+					"errors":  result.Errors,
+				}).Warn("Catalog sync found removed tasks/plans or errors")
+			}
+		}
+	}()
+}
+
+// showPuppetServerImport will render the tasks or plans (kind) of an environment for the bulk import
+func showPuppetServerImport(c *gin.Context, kind string) {
+	puppetServer, err := getPuppetServer(c)
+	if err != nil {
+		return
+	}
+	env := c.DefaultQuery("environment", "production")
+	filter := c.Query("filter")
+	var items []*puppet.CatalogItem
+	if kind == "tasks" {
+		items, err = puppet.GetTaskCatalog(puppetServer, env, filter)
+	} else {
+		items, err = puppet.GetPlanCatalog(puppetServer, env, filter)
+	}
+	if err != nil {
+		log.WithField("puppetServerID", puppetServer.ID).Error("ERROR retrieving the catalog from API: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	breadcrumbs := models.PuppetTasks{}.GetBreadCrumbs(puppetServer)
+	if kind == "plans" {
+		breadcrumbs = models.PuppetPlans{}.GetBreadCrumbs(puppetServer)
+	}
+	data := gin.H{
+		"status":        "success",
+		"kind":          kind,
+		"items":         items,
+		"environment":   env,
+		"filter":        filter,
+		"puppet_server": puppetServer,
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "puppetserver-import.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, breadcrumbs, data),
+		Offered:  formatAllSupported,
+	})
+}
@@ -62,12 +62,21 @@ func UpdatePuppetPlan(c *gin.Context) {
 	if c.PostForm("IsForApplication") == "" {
 		puppetPlan.IsForApplication = false
 	}
+	if c.PostForm("IsForEnvironment") == "" {
+		puppetPlan.IsForEnvironment = false
+	}
 	if c.PostForm("IsForComponent") == "" {
 		puppetPlan.IsForComponent = false
 	}
 	if c.PostForm("IsForServer") == "" {
 		puppetPlan.IsForServer = false
 	}
+	err = puppetPlan.ValidateParamTemplates()
+	if err != nil {
+		log.Error("ERROR validating puppetPlan param templates: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ERROR validating puppetPlan param templates: " + err.Error()})
+		return
+	}
 	err = puppetPlan.Save()
 	if err != nil {
 		log.Error("Error saving puppetPlan: ", err)
@@ -114,13 +123,30 @@ func UpdatePuppetPlanFromAPI(c *gin.Context) {
 		return // error has already been logged
 	}
 	puppetServer := puppetServers[0] // TODO: Decide whether to check multiple servers, which server or all? use first server for now
+
+	// Metadata on every associated PuppetServer for each (code) environment (synced before or submitted)
+	// NOTE: Synced first, so the params of the plan on the other PuppetServers are kept (UpdatePlanDetails)
+	syncErrors := make([]string, 0)
+	environments := getSyncEnvironments(c, puppetPlan.GetEnvironments(0))
+	for _, ps := range puppetServers {
+		for _, env := range environments {
+			if ps.ID == puppetServer.ID && env == puppetPlan.GetEnvironment() {
+				continue // synced by UpdatePlanDetails
+			}
+			err = puppet.SyncPlanMetadata(ps, puppetPlan, env)
+			if err != nil {
+				log.Warn("Error syncing plan metadata: ", err)
+				syncErrors = append(syncErrors, err.Error())
+			}
+		}
+	}
 	err = puppet.UpdatePlanDetails(puppetServer, puppetPlan)
 	if err != nil {
 		log.Error("Error updating DB PuppetPlan from API: " + err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Error updating DB PuppetPlan from API: " + err.Error()})
 		return
 	}
-	data := gin.H{"status": "success", "plan": puppetPlan}
+	data := gin.H{"status": "success", "plan": puppetPlan, "environments": environments, "syncErrors": syncErrors}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "puppetPlan-success-redirect.gohtml",
 		Data:     data,
@@ -128,6 +154,23 @@ func UpdatePuppetPlanFromAPI(c *gin.Context) {
 	})
 }
 
+// GetPuppetPlanMetadata endpoint (GET) compares the plan params per PuppetServer and (code) environment
+// - PathParams: id
+func GetPuppetPlanMetadata(c *gin.Context) {
+	puppetPlan, err := getPuppetPlan(c)
+	if err != nil {
+		return // error has already been logged
+	}
+	diff := puppetPlan.GetMetadataDiff()
+	data := gin.H{"status": "success", "plan": puppetPlan, "diff": diff}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "puppetPlan-metadata.gohtml",
+		HTMLData: getHTMLData(c, puppetPlan.GetMetadataBreadCrumbs(), data),
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
 // ------------------------- STANDARD PATTERN HELPERS ---------------------------------
 
 // getPuppetPlan will get the id from context and return job
@@ -51,6 +51,12 @@ func UpdatePuppetPlanParam(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ERROR binding puppetPlanParam: " + err.Error()})
 		return
 	}
+	err = puppetPlanParam.ValidateTemplate()
+	if err != nil {
+		log.Error("ERROR validating puppetPlanParam template: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ERROR validating puppetPlanParam template: " + err.Error()})
+		return
+	}
 	err = puppetPlanParam.Save()
 	if err != nil {
 		log.Error("ERROR SAVING puppetPlanParam: ", err)
@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/controllers/puppet"
+	"github.com/tjm/puppet-patching-automation/functions"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// runPuppetTaskOnTarget runs a PuppetTask against the target (POST), preview a run (GET)
+// Path Params:
+// - taskID - puppetTask.ID
+func runPuppetTaskOnTarget(c *gin.Context, puppetServer *models.PuppetServer, target *runTarget) {
+	var htmlTemplate string
+	var data gin.H
+
+	// PuppetTask
+	taskID, err := validateID(c, "taskID")
+	if err != nil {
+		return
+	}
+	puppetTask, err := getPuppetTaskByID(c, taskID)
+	if err != nil {
+		return
+	}
+	err = validateRunTarget(c, "task "+puppetTask.Name, puppetTask.IsFor(target.Type), puppetServer.HasPuppetTask(puppetTask), target)
+	if err != nil {
+		return
+	}
+
+	// (code) environment, the metadata (param types) can differ per PuppetServer and environment
+	environments := puppetTask.GetEnvironments(puppetServer.ID)
+	env, err := getRunEnvironment(c, environments, puppetTask.GetEnvironment())
+	if err != nil {
+		return
+	}
+	metadata := puppetTask.GetMetadata(puppetServer.ID, env) // nil if not synced
+	sensitive := append(puppetTask.GetSensitiveParamNames(), metadata.GetSensitiveParamNames()...)
+
+	// params (of the task on the PuppetServer for the environment)
+	params, err := puppetTask.GetParamValues(target.Data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	metadata.RemoveUnknownParams(params)
+
+	if c.Request.Method == "POST" { // BUILD
+		// Verify Job is Enabled
+		if !puppetTask.Enabled {
+			err = errors.New("attempted too run task that is disabled")
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		// Tasks require nodes (plans may not)
+		if len(target.Nodes) == 0 {
+			err = fmt.Errorf("no servers on puppetServer %s for %s %s", puppetServer.Name, target.Type, target.Name)
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		// Process any submitted params (overrides)
+		// NOTE: Sensitive params are not shown in the preview, an empty value keeps the template value
+		submittedParams := c.PostFormMap("Params")
+		for k, v := range submittedParams {
+			if v == "" && functions.Contains(sensitive, k) {
+				continue
+			}
+			params[k] = v
+		}
+
+		// Verify the params match their Puppet data types (and required params are set)
+		violations, err := puppet.GetTaskParamViolations(puppetServer, puppetTask, env, params)
+		if err == nil {
+			err = violations.Err()
+		}
+		if err != nil {
+			log.Error("Error in task params: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		baseURL := location.Get(c).String() + target.Path
+		job, err := puppet.RunPuppetTask(puppetServer, puppetTask, env, target.Nodes, params, baseURL, isDryRun(c))
+		if err != nil {
+			log.Error("Error in RunPuppetTask: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		job.InitiatorID = target.ID
+		job.InitiatorType = target.Type
+		err = job.Save()
+		if err != nil {
+			log.Error("Error saving job: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		if job.DryRun {
+			showDryRun(c, []*models.PuppetJob{job})
+			return
+		}
+
+		htmlTemplate = "common-success-redirect.gohtml"
+		data = gin.H{
+			"status":       "success",
+			"redirectURL":  target.RedirectURL,
+			"params":       models.MaskSensitiveParams(params, sensitive, models.SensitiveMask),
+			"puppetTask":   puppetTask,
+			"puppetServer": puppetServer.Name,
+			"environment":  env,
+			"job":          job,
+		}
+	} else { // PREVIEW
+		violations, err := puppet.GetTaskParamViolations(puppetServer, puppetTask, env, params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		puppetTask.Params = puppetTask.GetParamsFor(puppetServer.ID, env)
+		htmlTemplate = "puppetTask-preview.gohtml"
+		data = gin.H{
+			"status":       "preview",
+			"params":       models.MaskSensitiveParams(params, sensitive, ""),
+			"violations":   violations,
+			"puppetTask":   puppetTask,
+			"puppetServer": puppetServer.Name,
+			"target":       target,
+			"environment":  env,
+			"environments": environments,
+		}
+		if puppetTask.IsNotOnServer {
+			data["warning"] = fmt.Sprintf("The task %s is not on (one of) its Puppet Servers anymore (catalog sync), the run may fail.", puppetTask.Name)
+		}
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: htmlTemplate,
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// runPuppetPlanOnTarget runs a PuppetPlan against the target (POST), preview a run (GET)
+// Path Params:
+// - planID - puppetPlan.ID
+func runPuppetPlanOnTarget(c *gin.Context, puppetServer *models.PuppetServer, target *runTarget) {
+	var htmlTemplate string
+	var data gin.H
+
+	// PuppetPlan
+	planID, err := validateID(c, "planID")
+	if err != nil {
+		return
+	}
+	puppetPlan, err := getPuppetPlanByID(c, planID)
+	if err != nil {
+		return
+	}
+	err = validateRunTarget(c, "plan "+puppetPlan.Name, puppetPlan.IsFor(target.Type), puppetServer.HasPuppetPlan(puppetPlan), target)
+	if err != nil {
+		return
+	}
+
+	// (code) environment, the metadata (param types) can differ per PuppetServer and environment
+	environments := puppetPlan.GetEnvironments(puppetServer.ID)
+	env, err := getRunEnvironment(c, environments, puppetPlan.GetEnvironment())
+	if err != nil {
+		return
+	}
+	metadata := puppetPlan.GetMetadata(puppetServer.ID, env) // nil if not synced
+	sensitive := append(puppetPlan.GetSensitiveParamNames(), metadata.GetSensitiveParamNames()...)
+
+	// params (of the plan on the PuppetServer for the environment)
+	params, err := puppetPlan.GetParamValues(target.Data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	metadata.RemoveUnknownParams(params)
+
+	if c.Request.Method == "POST" { // BUILD
+		// Verify Job is Enabled
+		if !puppetPlan.Enabled {
+			err = errors.New("attempted too run plan that is disabled")
+			log.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		// Process any submitted params (overrides)
+		// NOTE: Sensitive params are not shown in the preview, an empty value keeps the template value
+		submittedParams := c.PostFormMap("Params")
+		for k, v := range submittedParams {
+			if v == "" && functions.Contains(sensitive, k) {
+				continue
+			}
+			params[k] = v
+		}
+
+		// Verify the params match their Puppet data types (and required params are set)
+		violations, err := puppet.GetPlanParamViolations(puppetServer, puppetPlan, env, params)
+		if err == nil {
+			err = violations.Err()
+		}
+		if err != nil {
+			log.Error("Error in plan params: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		baseURL := location.Get(c).String() + target.Path
+		job, err := puppet.RunPuppetPlan(puppetServer, puppetPlan, env, target.Nodes, params, baseURL, isDryRun(c))
+		if err != nil {
+			log.Error("Error in RunPuppetPlan: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		job.InitiatorID = target.ID
+		job.InitiatorType = target.Type
+		err = job.Save()
+		if err != nil {
+			log.Error("Error saving job: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		if job.DryRun {
+			showDryRun(c, []*models.PuppetJob{job})
+			return
+		}
+
+		htmlTemplate = "common-success-redirect.gohtml"
+		data = gin.H{
+			"status":       "success",
+			"redirectURL":  target.RedirectURL,
+			"params":       models.MaskSensitiveParams(params, sensitive, models.SensitiveMask),
+			"puppetPlan":   puppetPlan,
+			"puppetServer": puppetServer.Name,
+			"environment":  env,
+			"job":          job,
+		}
+	} else { // PREVIEW
+		violations, err := puppet.GetPlanParamViolations(puppetServer, puppetPlan, env, params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		puppetPlan.Params = puppetPlan.GetParamsFor(puppetServer.ID, env)
+		htmlTemplate = "puppetPlan-preview.gohtml"
+		data = gin.H{
+			"status":       "preview",
+			"params":       models.MaskSensitiveParams(params, sensitive, ""),
+			"violations":   violations,
+			"puppetPlan":   puppetPlan,
+			"puppetServer": puppetServer.Name,
+			"target":       target,
+			"environment":  env,
+			"environments": environments,
+		}
+		if puppetPlan.IsNotOnServer {
+			data["warning"] = fmt.Sprintf("The plan %s is not on (one of) its Puppet Servers anymore (catalog sync), the run may fail.", puppetPlan.Name)
+		}
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: htmlTemplate,
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
+// getRunPuppetServer returns the PuppetServer from the "puppetServerID" path param
+func getRunPuppetServer(c *gin.Context) (puppetServer *models.PuppetServer, err error) {
+	puppetServerID, err := validateID(c, "puppetServerID")
+	if err != nil {
+		return
+	}
+	return getPuppetServerByID(c, puppetServerID)
+}
+
+// getRunEnvironment returns the (code) environment to run in, "Environment" (POST) or "environment" (GET) or the default
+// NOTE: Only the environments synced for the task/plan on the PuppetServer (and the default) are allowed
+func getRunEnvironment(c *gin.Context, environments []string, def string) (env string, err error) {
+	env = c.PostForm("Environment")
+	if env == "" {
+		env = c.Query("environment")
+	}
+	if env == "" {
+		return def, nil
+	}
+	if !functions.Contains(environments, env) {
+		err = fmt.Errorf("environment %q is not synced on this puppetServer, update from API first", env)
+		log.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+	}
+	return
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -54,15 +55,32 @@ func UpdatePuppetServer(c *gin.Context) {
 		return
 	}
 	token := puppetServer.Token
+	rbacUsername := puppetServer.RBACUsername
+	rbacPassword := puppetServer.RBACPassword
 	err = c.Bind(puppetServer)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
-	// Handle not updating token
-	if puppetServer.Token == "" {
-		puppetServer.Token = token
+	// Handle not updating token (or RBAC password)
+	keepSecret(&puppetServer.Token, token)
+	keepSecret(&puppetServer.RBACPassword, rbacPassword)
+	if validateSecretReferences(c, puppetServer.Token, puppetServer.RBACPassword) != nil {
+		return
+	}
+	if puppetServer.Token == "" && !puppetServer.UsesRBACToken() {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errPuppetCredentialsRequired.Error()})
+		return
+	}
+	if puppetServer.UsesRBACToken() && puppetServer.RBACPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errRBACPasswordRequired.Error()})
+		return
 	}
+	if err = validatePatchingActions(puppetServer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	rbacChanged := puppetServer.RBACUsername != rbacUsername || puppetServer.RBACPassword != rbacPassword
 	// Handle DISABLE (Enable not checked)
 	if c.PostForm("Enabled") == "" {
 		puppetServer.Enabled = false
@@ -76,6 +94,10 @@ func UpdatePuppetServer(c *gin.Context) {
 		puppetServer.SSLSkipVerify = false
 	}
 	puppetServer.Save()
+	// Request a new token with the new service account credentials (errors are shown in the token status)
+	if puppetServer.UsesRBACToken() && rbacChanged {
+		_ = puppet.RenewToken(puppetServer)
+	}
 	censorPuppetServerFields(puppetServer)
 	data := gin.H{"status": "success", "puppet_server": puppetServer}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
@@ -86,6 +108,31 @@ func UpdatePuppetServer(c *gin.Context) {
 	})
 }
 
+// RenewPuppetServerToken endpoint (POST)
+// - PathParams: id
+func RenewPuppetServerToken(c *gin.Context) {
+	puppetServer, err := getPuppetServer(c)
+	if err != nil {
+		return
+	}
+	err = puppet.RenewToken(puppetServer)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"status": "error", "message": "Error renewing token: " + err.Error()})
+		return
+	}
+	data := gin.H{
+		"status":           "success",
+		"puppet_server_id": puppetServer.ID,
+		"tokenStatus":      puppetServer.GetTokenStatus(),
+		"tokenExpiration":  puppetServer.TokenExpiration,
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "success-redirect-puppetserver.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
 // DeletePuppetServer endpoint (DELETE)
 // - PathParams: id
 func DeletePuppetServer(c *gin.Context) {
@@ -540,9 +587,44 @@ func getPuppetServerByID(c *gin.Context, id uint) (puppetServer *models.PuppetSe
 	return // success
 }
 
+// validatePatchingActions makes sure the tasks/plans bound to the patching actions exist and are associated to the PuppetServer
+func validatePatchingActions(puppetServer *models.PuppetServer) (err error) {
+	actions := []struct {
+		name string
+		id   uint
+	}{{"PatchTaskID", puppetServer.PatchTaskID}, {"TestTaskID", puppetServer.TestTaskID}}
+	for _, action := range actions {
+		if action.id == 0 {
+			continue // built-in default
+		}
+		var task *models.PuppetTask
+		task, err = models.GetPuppetTaskByID(action.id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", action.name, err)
+		}
+		if !puppetServer.HasPuppetTask(task) {
+			return fmt.Errorf("%s %w", action.name, errNotAssociated)
+		}
+	}
+	if puppetServer.PatchPlanID != 0 {
+		var plan *models.PuppetPlan
+		plan, err = models.GetPuppetPlanByID(puppetServer.PatchPlanID)
+		if err != nil {
+			return fmt.Errorf("PatchPlanID: %w", err)
+		}
+		if !puppetServer.HasPuppetPlan(plan) {
+			return fmt.Errorf("PatchPlanID %w", errNotAssociated)
+		}
+	}
+	return
+}
+
 func censorPuppetServerFields(puppetServer *models.PuppetServer) {
-	// Censor Token parameter (sensitive)
-	if puppetServer.Token != "" {
-		puppetServer.Token = "[censored]"
+	// Censor Token parameter (sensitive), references (env:, file:, vault:) are not secret
+	if puppetServer.Token != "" && !puppetServer.Token.IsReference() {
+		puppetServer.Token = censoredValue
+	}
+	if puppetServer.RBACPassword != "" && !puppetServer.RBACPassword.IsReference() {
+		puppetServer.RBACPassword = censoredValue
 	}
 }
@@ -62,12 +62,21 @@ func UpdatePuppetTask(c *gin.Context) {
 	if c.PostForm("IsForApplication") == "" {
 		puppetTask.IsForApplication = false
 	}
+	if c.PostForm("IsForEnvironment") == "" {
+		puppetTask.IsForEnvironment = false
+	}
 	if c.PostForm("IsForComponent") == "" {
 		puppetTask.IsForComponent = false
 	}
 	if c.PostForm("IsForServer") == "" {
 		puppetTask.IsForServer = false
 	}
+	err = puppetTask.ValidateParamTemplates()
+	if err != nil {
+		log.Error("ERROR validating puppetTask param templates: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ERROR validating puppetTask param templates: " + err.Error()})
+		return
+	}
 	err = puppetTask.Save()
 	if err != nil {
 		log.Error("Error saving puppetTask: ", err)
@@ -114,13 +123,30 @@ func UpdatePuppetTaskFromAPI(c *gin.Context) {
 		return // error has already been logged
 	}
 	puppetServer := puppetServers[0] // TODO: Decide whether to check multiple servers, which server or all? use first server for now
+
+	// Metadata on every associated PuppetServer for each (code) environment (synced before or submitted)
+	// NOTE: Synced first, so the params of the task on the other PuppetServers are kept (UpdateTaskDetails)
+	syncErrors := make([]string, 0)
+	environments := getSyncEnvironments(c, puppetTask.GetEnvironments(0))
+	for _, ps := range puppetServers {
+		for _, env := range environments {
+			if ps.ID == puppetServer.ID && env == puppetTask.GetEnvironment() {
+				continue // synced by UpdateTaskDetails
+			}
+			err = puppet.SyncTaskMetadata(ps, puppetTask, env)
+			if err != nil {
+				log.Warn("Error syncing task metadata: ", err)
+				syncErrors = append(syncErrors, err.Error())
+			}
+		}
+	}
 	err = puppet.UpdateTaskDetails(puppetServer, puppetTask)
 	if err != nil {
 		log.Error("Error updating DB PuppetTask from API: " + err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Error updating DB PuppetTask from API: " + err.Error()})
 		return
 	}
-	data := gin.H{"status": "success", "task": puppetTask}
+	data := gin.H{"status": "success", "task": puppetTask, "environments": environments, "syncErrors": syncErrors}
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		HTMLName: "puppetTask-success-redirect.gohtml",
 		Data:     data,
@@ -128,6 +154,23 @@ func UpdatePuppetTaskFromAPI(c *gin.Context) {
 	})
 }
 
+// GetPuppetTaskMetadata endpoint (GET) compares the task params per PuppetServer and (code) environment
+// - PathParams: id
+func GetPuppetTaskMetadata(c *gin.Context) {
+	puppetTask, err := getPuppetTask(c)
+	if err != nil {
+		return // error has already been logged
+	}
+	diff := puppetTask.GetMetadataDiff()
+	data := gin.H{"status": "success", "task": puppetTask, "diff": diff}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "puppetTask-metadata.gohtml",
+		HTMLData: getHTMLData(c, puppetTask.GetMetadataBreadCrumbs(), data),
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
+
 // ------------------------- STANDARD PATTERN HELPERS ---------------------------------
 
 // getPuppetTask will get the id from context and return job
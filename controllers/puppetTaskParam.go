@@ -51,6 +51,12 @@ func UpdatePuppetTaskParam(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ERROR binding puppetTaskParam: " + err.Error()})
 		return
 	}
+	err = puppetTaskParam.ValidateTemplate()
+	if err != nil {
+		log.Error("ERROR validating puppetTaskParam template: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "ERROR validating puppetTaskParam template: " + err.Error()})
+		return
+	}
 	err = puppetTaskParam.Save()
 	if err != nil {
 		log.Error("ERROR SAVING puppetTaskParam: ", err)
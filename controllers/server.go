@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-contrib/location"
@@ -39,21 +40,40 @@ func GetServer(c *gin.Context) {
 	if err != nil {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "success", "server": server})
+	data := gin.H{
+		"status": "success",
+		"server": server,
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "server-show.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, server.GetBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
 }
 
 // ServerRunPatching endpoint (POST)
 // PathParams: id
+// FormParams: test (run the test task), dryRun
 func ServerRunPatching(c *gin.Context) {
 	server, err := getServer(c)
 	if err != nil {
 		return
 	}
-	job, err := puppet.PatchServer(server, location.Get(c).String(), false)
+	if server.Excluded {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": errServerExcluded.Error()})
+		return
+	}
+	test := c.Query("test") == "true" || c.PostForm("test") == "true"
+	job, err := puppet.PatchServer(server, location.Get(c).String(), test, isDryRun(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error PatchServer: " + err.Error()})
 		return
 	}
+	if job.DryRun {
+		showDryRun(c, []*models.PuppetJob{job})
+		return
+	}
 	data := gin.H{
 		"status":  "success",
 		"message": "Started Task on Puppet Server, see link for details.",
@@ -68,6 +88,66 @@ func ServerRunPatching(c *gin.Context) {
 	// })
 }
 
+// ServerRunPuppetTask runs a PuppetTask against a Server (POST), preview a run (GET)
+// Path Params:
+// - id - Server.ID
+// - taskID - puppetTask.ID
+func ServerRunPuppetTask(c *gin.Context) {
+	server, puppetServer, err := getServerOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetTaskOnTarget(c, puppetServer, getServerRunTarget(server))
+}
+
+// ServerRunPuppetPlan runs a PuppetPlan against a Server (POST), preview a run (GET)
+// Path Params:
+// - id - Server.ID
+// - planID - puppetPlan.ID
+func ServerRunPuppetPlan(c *gin.Context) {
+	server, puppetServer, err := getServerOnPuppetServer(c)
+	if err != nil {
+		return
+	}
+	runPuppetPlanOnTarget(c, puppetServer, getServerRunTarget(server))
+}
+
+// ServerBuildJenkinsJob builds a JenkinsJob for a Server (POST), preview a build (GET)
+// Path Params:
+// - id - Server.ID
+// - jobID - JenkinsJob.ID
+func ServerBuildJenkinsJob(c *gin.Context) {
+	server, err := getServer(c)
+	if err != nil {
+		return
+	}
+	buildJenkinsJobOnTarget(c, &runTarget{
+		Type:        "Server",
+		ID:          server.ID,
+		Name:        server.Name,
+		Data:        server,
+		Path:        fmt.Sprintf("/server/%v", server.ID),
+		RedirectURL: fmt.Sprintf("/server/%v", server.ID),
+	})
+}
+
+// GetServerPackages endpoint (GET) will list the package updates of the server
+// - PathParams: id
+// - QueryParams: package (search)
+func GetServerPackages(c *gin.Context) {
+	server, err := getServer(c)
+	if err != nil {
+		return
+	}
+	data := gin.H{"status": "success", "server": server, "search": c.Query("package"), "packages": server.GetPackageUpdates(c.Query("package"))}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "server-packages.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, server.GetPackagesBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
 // GetServerFacts endpoint (GET)
 // PathParams: id
 func GetServerFacts(c *gin.Context) {
@@ -120,3 +200,44 @@ func getServerByID(c *gin.Context, id uint) (server *models.Server, err error) {
 	}
 	return // success
 }
+
+// getServerOnPuppetServer returns the server (with its facts) and its puppet server
+// NOTE: The server must not be excluded from patching to run (POST), the facts are blank when PuppetDB can not be queried.
+// The PuppetServer is not set on the server, it is rendered by the param templates. The task/plan is checked
+// (IsForServer and associated to the PuppetServer) by runPuppetTaskOnTarget/runPuppetPlanOnTarget.
+func getServerOnPuppetServer(c *gin.Context) (server *models.ServerScope, puppetServer *models.PuppetServer, err error) {
+	s, err := getServer(c)
+	if err != nil {
+		return
+	}
+	if s.Excluded && c.Request.Method == "POST" {
+		err = errServerExcluded
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	puppetServer, err = getPuppetServerByID(c, s.PuppetServerID)
+	if err != nil {
+		return
+	}
+	server = &models.ServerScope{Server: s, Facts: make(map[string]interface{})}
+	inventory, factsErr := puppet.GetFacts(s)
+	if factsErr != nil {
+		log.WithField("server", s.Name).Warn("Unable to retrieve facts for param templates: ", factsErr)
+	} else if len(inventory) > 0 {
+		server.Facts = inventory[0].Facts
+	}
+	return
+}
+
+// getServerRunTarget returns the server as the target of a PuppetTask/PuppetPlan run
+func getServerRunTarget(server *models.ServerScope) *runTarget {
+	return &runTarget{
+		Type:        "Server",
+		ID:          server.ID,
+		Name:        server.Name,
+		Data:        server,
+		Nodes:       []string{server.Name},
+		Path:        fmt.Sprintf("/server/%v", server.ID),
+		RedirectURL: fmt.Sprintf("/server/%v", server.ID),
+	}
+}
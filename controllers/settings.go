@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/controllers/trelloapi"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// GetSettings endpoint (GET)
+// NOTE: Setting values are secrets (write-only), only whether they are set is returned
+func GetSettings(c *gin.Context) {
+	data := gin.H{
+		"status":            "success",
+		"trelloTokenSet":    models.IsSettingSet(models.SettingTrelloToken),
+		"encryptionEnabled": models.IsSecretEncryptionEnabled(),
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "settings-show.gohtml",
+		Data:     data,
+		HTMLData: getHTMLData(c, models.Settings{}.GetBreadCrumbs(), data),
+		Offered:  formatAllSupported,
+	})
+}
+
+// UpdateSettings endpoint (PUT/POST)
+// - FormParams: TrelloToken (blank keeps existing)
+func UpdateSettings(c *gin.Context) {
+	if token := c.PostForm("TrelloToken"); token != "" && token != censoredValue {
+		err := models.SetSetting(models.SettingTrelloToken, token)
+		if err != nil {
+			log.Error("Error saving Trello Token setting: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		trelloapi.ResetTrelloClient()
+		log.WithField("user", c.GetString("user")).Info("AUDIT: Trello Token updated.")
+	}
+	data := gin.H{"status": "success", "redirectURL": "/config/settings"}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		HTMLName: "common-success-redirect.gohtml",
+		Data:     data,
+		Offered:  formatAllSupported,
+	})
+}
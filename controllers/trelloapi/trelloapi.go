@@ -1,6 +1,7 @@
 package trelloapi
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -11,10 +12,11 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/functions"
 	"github.com/tjm/puppet-patching-automation/models"
 )
 
-var trelloClient *trello.Client
+var errTrelloNotConfigured = errors.New("trello AppKey and Token are not configured")
 
 // CreateTrelloBoard Trello board via API
 // Params:
@@ -168,7 +170,7 @@ func populateTrelloBoard(tb *models.TrelloBoard, board *trello.Board, baseURL st
 				checklistCount++
 				fmt.Printf("#") // Trello Card Progress (new Checklist)
 
-				for _, server := range component.GetServers() {
+				for _, server := range component.GetIncludedServers() {
 					checked := strconv.FormatBool(server.PackageUpdates == 0)
 					itemArgs := trello.Arguments{
 						"pos":     "bottom",
@@ -176,9 +178,9 @@ func populateTrelloBoard(tb *models.TrelloBoard, board *trello.Board, baseURL st
 					}
 					var item *trello.CheckItem
 					if strings.Contains(server.Name, "cliqa") {
-						item, err = checklist.CreateCheckItem(fmt.Sprintf("%s (%s) - Updates: %v\nssh://%s [VMName: %s]", server.Name, server.IPAddress, server.PackageUpdates, server.Name, server.VMName), itemArgs)
+						item, err = checklist.CreateCheckItem(fmt.Sprintf("%s (%s) - Updates: %v\n%s [VMName: %s]", server.Name, server.IPAddress, server.PackageUpdates, server.GetRemoteURL(), server.VMName), itemArgs)
 					} else {
-						item, err = checklist.CreateCheckItem(fmt.Sprintf("%s (%s) - Updates: %v\nssh://%s", server.Name, server.IPAddress, server.PackageUpdates, server.Name), itemArgs)
+						item, err = checklist.CreateCheckItem(fmt.Sprintf("%s (%s) - Updates: %v\n%s", server.Name, server.IPAddress, server.PackageUpdates, server.GetRemoteURL()), itemArgs)
 					}
 					if err != nil {
 						log.Error(err)
@@ -200,41 +202,78 @@ func populateTrelloBoard(tb *models.TrelloBoard, board *trello.Board, baseURL st
 	return nil
 } // func CreateTrelloBoard
 
-// getTrelloClient will return the trelloClient logged in
+// getTrelloClient will return the (cached) trelloClient logged in
 func getTrelloClient() *trello.Client {
-	if trelloClient == nil {
-		// Get Credentials
-		appKey := config.GetArgs().TrelloAppKey
-		token := config.GetArgs().TrelloToken
-		if appKey == "" || token == "" {
-			// Removed interactive prompt for WebUI
-			invalidTrelloToken()
-			return nil
-		}
-		trelloClient = trello.NewClient(appKey, token)
+	// Get Credentials
+	appKey := config.GetArgs().TrelloAppKey
+	token := getTrelloToken()
+	if appKey == "" || token == "" {
+		// Removed interactive prompt for WebUI
+		invalidTrelloToken()
+		return nil
+	}
+	client, err := models.GetClient(models.ClientKindTrello, 0, models.GetTrelloConfigHash(appKey, token), func() (client *trello.Client, err error) {
+		client = newTrelloClient(appKey, token)
 		// Verify client is working, as the above command just creates the object
-		user, err := trelloClient.GetMember("me")
+		user, err := client.GetMember("me")
 		if err != nil {
-			if trello.IsPermissionDenied(err) {
-				invalidTrelloToken() // Catch expired tokens
-			}
-			log.Error("There was a problem using the trello client: ", err)
-			return nil
+			return
 		}
 		log.Info("Logged into Trello (token) as: " + user.FullName)
+		return
+	})
+	if err != nil {
+		if trello.IsPermissionDenied(err) {
+			invalidTrelloToken() // Catch expired tokens
+		}
+		log.Error("There was a problem using the trello client: ", err)
+		return nil
 	}
-	return trelloClient
+	return client
+}
+
+// newTrelloClient returns a trello.Client with the configured timeout and retries
+func newTrelloClient(appKey, token string) (client *trello.Client) {
+	args := config.GetArgs()
+	client = trello.NewClient(appKey, token)
+	client.Client = functions.NewHTTPClient(nil, args.TrelloTimeout, args.TrelloRetries)
+	return
+}
+
+// CheckConnection will verify the Trello AppKey/Token with a simple query
+func CheckConnection() (err error) {
+	appKey := config.GetArgs().TrelloAppKey
+	token := getTrelloToken()
+	if appKey == "" || token == "" {
+		return errTrelloNotConfigured
+	}
+	_, err = newTrelloClient(appKey, token).GetMember("me")
+	return
+}
+
+// ResetTrelloClient will force the trelloClient to be recreated (i.e. after the token is updated)
+func ResetTrelloClient() {
+	models.InvalidateClients(0, models.ClientKindTrello)
+}
+
+// getTrelloToken returns the Trello Token (stored encrypted in the database settings)
+func getTrelloToken() (token string) {
+	token, err := models.GetSetting(models.SettingTrelloToken)
+	if err != nil {
+		log.Error("Error retrieving Trello Token setting: ", err)
+	}
+	return
 }
 
 func invalidTrelloToken() {
 	appKey := config.GetArgs().TrelloAppKey
-	token := config.GetArgs().TrelloToken
+	token := getTrelloToken()
 	if appKey == "" {
 		log.Error("Trello APPKEY cannot be blank!")
 		log.Error("You should set your Trello AppKey using --trelloappkey or use the TRELLO_APPKEY environment variable. (see --help for details)")
 	} else if token == "" {
 		log.Error("Trello TOKEN cannot be blank!")
-		log.Error("You should set your Trello token using --trellotoken or use the TRELLO_TOKEN environment variable. (see --help for details)")
+		log.Error("You should set your Trello token in the WebUI (/config/settings), using --trellotoken or use the TRELLO_TOKEN environment variable. (see --help for details)")
 	} else {
 		log.Error(" *** Trello AppKey/Token combination was invalid (or expired). ***")
 	}
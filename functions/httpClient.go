@@ -0,0 +1,106 @@
+package functions
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retryBackoff is the delay before the first retry, doubled for each retry after that
+var retryBackoff = 500 * time.Millisecond
+
+// GetTLSConfig returns a tls.Config that trusts the system CAs and the (optional) PEM cacert
+func GetTLSConfig(cacert string, SSLSkipVerify bool) (config *tls.Config) {
+	// Get the SystemCertPool, continue with an empty pool on error
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		log.Error("Error getting SystemCertPool:" + err.Error())
+		// continue
+	}
+	if rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if cacert != "" {
+		// Append our cert to the system pool
+		if ok := rootCAs.AppendCertsFromPEM([]byte(cacert)); !ok {
+			log.Error("No CA certs appended")
+			// continue
+		}
+	}
+
+	// Trust the augmented cert pool in our client
+
+	/* #nosec G402 - SSLSkipVerify defaults to false, users are warned when switching it on. */
+	config = &tls.Config{
+		RootCAs:            rootCAs,
+		InsecureSkipVerify: SSLSkipVerify,
+	}
+	return
+}
+
+// NewHTTPClient returns an http.Client with a timeout, that retries idempotent requests
+func NewHTTPClient(tlsConfig *tls.Config, timeout time.Duration, retries uint) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: NewRetryTransport(transport, retries),
+	}
+}
+
+// NewRetryTransport wraps the transport to retry idempotent (GET/HEAD) requests
+// on connection errors and 502, 503 or 504 responses
+func NewRetryTransport(transport http.RoundTripper, retries uint) http.RoundTripper {
+	if retries == 0 {
+		return transport
+	}
+	return &retryTransport{transport: transport, retries: retries}
+}
+
+// retryTransport is an http.RoundTripper that retries idempotent requests
+type retryTransport struct {
+	transport http.RoundTripper
+	retries   uint
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.transport.RoundTrip(req)
+	}
+	backoff := retryBackoff
+	for attempt := uint(0); ; attempt++ {
+		resp, err = t.transport.RoundTrip(req)
+		if attempt >= t.retries || !isRetryable(resp, err) {
+			return
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		log.WithFields(log.Fields{
+			"host":    req.URL.Host,
+			"attempt": attempt + 1,
+		}).Warn("Retrying request")
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable returns true for connection errors and 502, 503 or 504 responses
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Join will join a list ([]string or any other slice) with sep, i.e. {{ .GetServerList | join "," }}
+func Join(sep string, list interface{}) string {
+	switch l := list.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(l, sep)
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(list)
+	}
+	items := make([]string, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(items, sep)
+}
+
+// ToJSON will return the JSON encoding of v, i.e. {{ .GetServerList | toJSON }}
+func ToJSON(v interface{}) (string, error) {
+	out, err := json.Marshal(v)
+	return string(out), err
+}
+
+// AddTime will add the duration (i.e. "2h", "-30m" or "1d") to t, i.e. {{ addTime "-1h" .StartTime }}
+func AddTime(duration string, t time.Time) (time.Time, error) {
+	d, err := ParseDuration(duration)
+	return t.Add(d), err
+}
+
+// ParseDuration parses a duration like time.ParseDuration, with support for days (i.e. "1d" or "-2d")
+func ParseDuration(duration string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(duration, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", duration)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(duration)
+}
+
+// Default will return value, or def if the value is empty, i.e. {{ .Notes | default "none" }}
+func Default(def interface{}, value interface{}) interface{} {
+	if IsEmpty(value) {
+		return def
+	}
+	return value
+}
+
+// Required will return value, or an error with the message if the value is empty, i.e. {{ .VMName | required "VMName is required" }}
+func Required(message string, value interface{}) (interface{}, error) {
+	if IsEmpty(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+// Fact will look up a fact by its path (i.e. "os.family") in the facts, returns nil if not found
+func Fact(path string, facts map[string]interface{}) interface{} {
+	var value interface{} = facts
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value, ok = m[key]
+		if !ok {
+			return nil
+		}
+	}
+	return value
+}
+
+// IsEmpty returns true if v is nil or the zero value (or an empty slice or map)
+func IsEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
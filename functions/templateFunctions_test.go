@@ -0,0 +1,155 @@
+package functions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		name string
+		list interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"strings", []string{"a", "b", "c"}, "a,b,c"},
+		{"empty", []string{}, ""},
+		{"ints", []int{1, 2}, "1,2"},
+		{"interfaces", []interface{}{"a", 1, true}, "a,1,true"},
+		{"array", [2]string{"x", "y"}, "x,y"},
+		{"not a list", "single", "single"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Join(",", tt.list); got != tt.want {
+				t.Errorf("Join(%v) = %q, want %q", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		duration string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"1d", 24 * time.Hour, false},
+		{"-2d", -48 * time.Hour, false},
+		{"0d", 0, false},
+		{"2h", 2 * time.Hour, false},
+		{"-30m", -30 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"xd", 0, true},
+		{"1w", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.duration, func(t *testing.T) {
+			got, err := ParseDuration(tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDuration(%q) error = %v, wantErr %v", tt.duration, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, want %v", tt.duration, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddTime(t *testing.T) {
+	start := time.Date(2023, 6, 13, 22, 0, 0, 0, time.UTC)
+	got, err := AddTime("-1d", start)
+	if err != nil || !got.Equal(start.Add(-24*time.Hour)) {
+		t.Errorf("AddTime(-1d) = %v, %v", got, err)
+	}
+}
+
+func TestFact(t *testing.T) {
+	facts := map[string]interface{}{
+		"kernel": "Linux",
+		"os": map[string]interface{}{
+			"family":  "RedHat",
+			"release": map[string]interface{}{"major": "8"},
+		},
+		"is_virtual": false,
+	}
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"kernel", "Linux"},
+		{"os.family", "RedHat"},
+		{"os.release.major", "8"},
+		{"is_virtual", false},
+		{"missing", nil},
+		{"os.missing", nil},
+		{"kernel.release", nil}, // not a hash
+		{"os.release.major.minor", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := Fact(tt.path, facts); got != tt.want {
+				t.Errorf("Fact(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+	if got := Fact("os", facts); got == nil {
+		t.Error("Fact(os) = nil, want the os hash")
+	}
+	if got := Fact("os.family", nil); got != nil {
+		t.Errorf("Fact(os.family, nil) = %v, want nil", got)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	var nilPointer *time.Time
+	var nilMap map[string]interface{}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  bool
+	}{
+		{"nil", nil, true},
+		{"empty string", "", true},
+		{"string", "a", false},
+		{"zero int", 0, true},
+		{"int", 1, false},
+		{"false", false, true},
+		{"true", true, false},
+		{"empty slice", []string{}, true},
+		{"slice", []string{"a"}, false},
+		{"nil map", nilMap, true},
+		{"empty map", map[string]interface{}{}, true},
+		{"map", map[string]interface{}{"a": 1}, false},
+		{"nil pointer", nilPointer, true},
+		{"pointer", &time.Time{}, false},
+		{"zero time", time.Time{}, true},
+		{"time", time.Now(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEmpty(tt.value); got != tt.want {
+				t.Errorf("IsEmpty(%#v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRequired(t *testing.T) {
+	if got := Default("none", ""); got != "none" {
+		t.Errorf("Default(none, \"\") = %v", got)
+	}
+	if got := Default("none", "notes"); got != "notes" {
+		t.Errorf("Default(none, notes) = %v", got)
+	}
+	if _, err := Required("VMName is required", ""); err == nil || err.Error() != "VMName is required" {
+		t.Errorf("Required(\"\") error = %v", err)
+	}
+	if got, err := Required("VMName is required", "vm01"); err != nil || got != "vm01" {
+		t.Errorf("Required(vm01) = %v, %v", got, err)
+	}
+}
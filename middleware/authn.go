@@ -1,25 +1,36 @@
 package middleware
 
 import (
-	"net/url"
+	"errors"
 
-	oidcauth "github.com/TJM/gin-gonic-oidcauth"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/tjm/puppet-patching-automation/config"
 )
 
-var globalAuth *oidcauth.OidcAuth
-var redirectPath string
+// authUserKey stores the authenticated user's login in this context key (matches oidcauth.AuthUserKey)
+const authUserKey = "user"
+
+// Authenticator is the interface implemented by each authentication type (oidc, local, header)
+type Authenticator interface {
+	// SetupRoutes adds the routes necessary for authentication (login, logout, callbacks)
+	SetupRoutes(router *gin.Engine)
+	// AuthRequired returns a gin.HandlerFunc that requires an authenticated user
+	AuthRequired() gin.HandlerFunc
+}
+
+var globalAuth Authenticator
+
+var (
+	errInvalidLogin     = errors.New("invalid username or password")
+	errUntrustedProxy   = errors.New("request did not come from a trusted proxy")
+	errMissingLoginUser = errors.New("authentication header not found")
+)
 
 // SetupAuthentication will setup the gin.Engine (router) with the necessary routes for authentication
 func SetupAuthentication(router *gin.Engine) {
-	auth := getAuth()
-
-	router.GET("/login", auth.Login) // Unnecessary, as requesting a "AuthRequired" resource will initiate login, but potentially convenient
-	router.GET(redirectPath, auth.AuthCallback)
-	router.GET("/logout", auth.Logout)
+	getAuth().SetupRoutes(router)
 }
 
 // Authenticate will reutrn a gin.HandlerFunc to authenticate users
@@ -27,30 +38,22 @@ func Authenticate() gin.HandlerFunc {
 	return getAuth().AuthRequired()
 }
 
-// createAuth will configure a new authentication object and configure it
-func createAuth() *oidcauth.OidcAuth {
-	log.Info("Create Authentication Configuration")
+// createAuth will create the authentication object based on the configured AuthType
+func createAuth() Authenticator {
 	args := config.GetArgs()
-	// NOTE: DefaultConfig uses Google Accounts
-	// - See https://github.com/coreos/go-oidc/blob/v3/example/README.md
-	authConfig := oidcauth.DefaultConfig() // Supply OIDC Params via env
-	auth, err := authConfig.GetOidcAuth()
-	if err != nil {
-		panic("AUTH setup failed: " + err.Error())
-	}
-	if args.DebugAuth {
-		auth.Debug = true
-	}
-	redirectURL, err := url.Parse(authConfig.RedirectURL)
-	if err != nil {
-		panic("RedirectURL is INVALID: " + err.Error())
+	log.WithField("authType", args.AuthType).Info("Create Authentication Configuration")
+	switch args.AuthType {
+	case "local":
+		return createLocalAuth()
+	case "header":
+		return createHeaderAuth()
+	default:
+		return createOidcAuth()
 	}
-	redirectPath = redirectURL.Path
-	return auth
 }
 
-// getAuth will return the active oidcAuth object (or create one then return it)
-func getAuth() *oidcauth.OidcAuth {
+// getAuth will return the active Authenticator (or create one then return it)
+func getAuth() Authenticator {
 	if globalAuth == nil {
 		globalAuth = createAuth()
 	}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+)
+
+// headerAuth trusts a header (i.e. X-Forwarded-User) set by an authenticating reverse proxy
+// NOTE: The header is only trusted when the request comes directly from one of the TrustedProxies.
+type headerAuth struct {
+	header         string
+	nameHeader     string
+	trustedProxies []*net.IPNet
+}
+
+// SetupRoutes adds /login and /logout (authentication is handled by the proxy)
+func (h *headerAuth) SetupRoutes(router *gin.Engine) {
+	router.GET("/login", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/")
+	})
+	router.GET("/logout", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Clear()
+		_ = session.Save()
+		c.Redirect(http.StatusFound, "/")
+	})
+}
+
+// AuthRequired requires the login header from a trusted proxy
+func (h *headerAuth) AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		remoteIP := net.ParseIP(c.RemoteIP())
+		if !h.isTrustedProxy(remoteIP) {
+			log.WithField("remoteIP", c.RemoteIP()).Warn(errUntrustedProxy)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "message": errUntrustedProxy.Error()})
+			return
+		}
+		login := strings.TrimSpace(c.GetHeader(h.header))
+		if login == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "message": errMissingLoginUser.Error()})
+			return
+		}
+		// Keep the display name in the session for the templates (navbar)
+		name := login
+		if h.nameHeader != "" && c.GetHeader(h.nameHeader) != "" {
+			name = c.GetHeader(h.nameHeader)
+		}
+		session := sessions.Default(c)
+		if session.Get("name") != name {
+			session.Set("name", name)
+			err := session.Save()
+			if err != nil {
+				log.Error("Error saving session: ", err)
+			}
+		}
+		c.Set(authUserKey, login)
+		c.Next()
+	}
+}
+
+// isTrustedProxy returns true if ip is in one of the trusted proxy networks
+func (h *headerAuth) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// createHeaderAuth will create the header authentication object
+func createHeaderAuth() *headerAuth {
+	args := config.GetArgs()
+	h := &headerAuth{
+		header:     args.AuthHeader,
+		nameHeader: args.AuthNameHeader,
+	}
+	for _, proxy := range args.TrustedProxies {
+		network, err := parseIPNet(proxy)
+		if err != nil {
+			log.WithField("proxy", proxy).Error("Invalid TrustedProxies entry: ", err)
+			continue
+		}
+		h.trustedProxies = append(h.trustedProxies, network)
+	}
+	if len(h.trustedProxies) == 0 {
+		panic("AUTH setup failed: AuthType header requires valid TrustedProxies")
+	}
+	return h
+}
+
+// parseIPNet will parse an IP address or CIDR into a *net.IPNet
+func parseIPNet(s string) (network *net.IPNet, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: s}
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err = net.ParseCIDR(s)
+	return
+}
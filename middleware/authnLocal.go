@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+const (
+	// localLoginSessionKey is the session key to hold the "login" (username)
+	localLoginSessionKey = "localauth:login"
+
+	// localExpirationSessionKey is when the session is expired (in unixtime)
+	localExpirationSessionKey = "localauth:sessionExpiration"
+
+	// localPreviousURLSessionKey will temporarily hold the URL path that the user was at before login
+	localPreviousURLSessionKey = "localauth:PreviousURL"
+
+	// localSessionLifetime is how long a local login is valid
+	localSessionLifetime = 12 * time.Hour
+)
+
+// localAuth authenticates users against the local user store (models.User)
+// NOTE: HTTP Basic Authentication is also accepted, to allow API access without a browser session.
+type localAuth struct{}
+
+// SetupRoutes adds /login (GET form and POST) and /logout
+func (l *localAuth) SetupRoutes(router *gin.Engine) {
+	router.GET("/login", l.loginForm)
+	router.POST("/login", l.login)
+	router.GET("/logout", l.logout)
+}
+
+// AuthRequired requires a local session (or valid basic auth credentials)
+func (l *localAuth) AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// API clients may use basic auth
+		if username, password, ok := c.Request.BasicAuth(); ok {
+			user, err := checkLocalUser(username, password)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Basic realm="PatchingAutomation"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "message": err.Error()})
+				return
+			}
+			c.Set(authUserKey, user.Username)
+			c.Next()
+			return
+		}
+
+		session := sessions.Default(c)
+		login, _ := session.Get(localLoginSessionKey).(string)
+		exp, _ := session.Get(localExpirationSessionKey).(int64)
+		if login == "" || time.Now().After(time.Unix(exp, 0)) {
+			if login != "" {
+				log.WithField("login", login).Info("Session Expired")
+			}
+			if c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), gin.MIMEHTML) {
+				session.Set(localPreviousURLSessionKey, c.Request.RequestURI)
+				_ = session.Save()
+				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
+				return
+			}
+			c.Header("WWW-Authenticate", `Basic realm="PatchingAutomation"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "authentication required"})
+			return
+		}
+		c.Set(authUserKey, login)
+		c.Next()
+	}
+}
+
+// loginForm will display the login form
+func (l *localAuth) loginForm(c *gin.Context) {
+	c.HTML(http.StatusOK, "login-form.gohtml", loginHTMLData(c, ""))
+}
+
+// login will validate the submitted credentials and start a session
+func (l *localAuth) login(c *gin.Context) {
+	user, err := checkLocalUser(c.PostForm("username"), c.PostForm("password"))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"username": c.PostForm("username"),
+			"clientIP": c.ClientIP(),
+		}).Warn("Local login failed")
+		c.HTML(http.StatusUnauthorized, "login-form.gohtml", loginHTMLData(c, err.Error()))
+		return
+	}
+	session := sessions.Default(c)
+	session.Set(localLoginSessionKey, user.Username)
+	session.Set(localExpirationSessionKey, time.Now().Add(localSessionLifetime).Unix())
+	session.Set("name", user.GetDisplayName())
+	redirectURL := "/"
+	if u, ok := session.Get(localPreviousURLSessionKey).(string); ok && strings.HasPrefix(u, "/") {
+		redirectURL = u
+		session.Delete(localPreviousURLSessionKey)
+	}
+	err = session.Save()
+	if err != nil {
+		log.Error("Error saving session: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// logout will clear the session
+func (l *localAuth) logout(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Clear()
+	err := session.Save()
+	if err != nil {
+		log.Error("Error saving session: ", err)
+	}
+	c.Redirect(http.StatusFound, "/")
+}
+
+// checkLocalUser will return the user if the username and password are valid
+func checkLocalUser(username, password string) (user *models.User, err error) {
+	user, err = models.GetUserByUsername(username)
+	if err != nil {
+		// Still compare a password to avoid leaking which usernames exist (timing)
+		_ = models.CheckDummyPassword(password)
+		err = errInvalidLogin
+		return
+	}
+	err = user.CheckPassword(password)
+	return
+}
+
+// loginHTMLData returns the data needed by the login-form template (header/navbar)
+func loginHTMLData(c *gin.Context, message string) gin.H {
+	breadcrumbs := append(models.GetDefaultBreadCrumbs(), &models.BreadCrumb{Name: "Login", URL: "/login", Active: true})
+	return gin.H{
+		"session":     sessions.Default(c),
+		"breadcrumbs": breadcrumbs,
+		"title":       "Login",
+		"message":     message,
+	}
+}
+
+// createLocalAuth will create the local authentication object and initialize LocalUsers
+func createLocalAuth() *localAuth {
+	args := config.GetArgs()
+	for _, entry := range args.LocalUsers {
+		username, password, found := strings.Cut(entry, ":")
+		if !found || username == "" || password == "" {
+			log.WithField("username", username).Error("Invalid LocalUsers entry, expected username:password")
+			continue
+		}
+		user, err := models.GetOrCreateUser(username)
+		if err != nil {
+			log.WithField("username", username).Error("Error creating local user: ", err)
+			continue
+		}
+		if user.IsPasswordUnchanged(password) {
+			continue
+		}
+		err = user.SetPassword(password)
+		if err != nil {
+			log.WithField("username", username).Error("Error setting password for local user: ", err)
+			continue
+		}
+		err = user.Save()
+		if err != nil {
+			log.WithField("username", username).Error("Error saving local user: ", err)
+			continue
+		}
+		log.WithField("username", user.Username).Info("Local user initialized")
+	}
+	return new(localAuth)
+}
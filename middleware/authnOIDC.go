@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/url"
+
+	oidcauth "github.com/TJM/gin-gonic-oidcauth"
+	"github.com/gin-gonic/gin"
+
+	"github.com/tjm/puppet-patching-automation/config"
+)
+
+// oidcAuth authenticates users against an OIDC Identity Provider
+type oidcAuth struct {
+	auth         *oidcauth.OidcAuth
+	redirectPath string
+}
+
+// SetupRoutes adds /login, /logout and the OIDC callback (redirect) path
+func (o *oidcAuth) SetupRoutes(router *gin.Engine) {
+	router.GET("/login", o.auth.Login) // Unnecessary, as requesting a "AuthRequired" resource will initiate login, but potentially convenient
+	router.GET(o.redirectPath, o.auth.AuthCallback)
+	router.GET("/logout", o.auth.Logout)
+}
+
+// AuthRequired returns the oidcauth handler
+func (o *oidcAuth) AuthRequired() gin.HandlerFunc {
+	return o.auth.AuthRequired()
+}
+
+// createOidcAuth will configure a new OIDC authentication object
+func createOidcAuth() *oidcAuth {
+	args := config.GetArgs()
+	// NOTE: DefaultConfig uses Google Accounts
+	// - See https://github.com/coreos/go-oidc/blob/v3/example/README.md
+	authConfig := oidcauth.DefaultConfig() // Supply OIDC Params via env
+	auth, err := authConfig.GetOidcAuth()
+	if err != nil {
+		panic("AUTH setup failed: " + err.Error())
+	}
+	if args.DebugAuth {
+		auth.Debug = true
+	}
+	redirectURL, err := url.Parse(authConfig.RedirectURL)
+	if err != nil {
+		panic("RedirectURL is INVALID: " + err.Error())
+	}
+	return &oidcAuth{
+		auth:         auth,
+		redirectPath: redirectURL.Path,
+	}
+}
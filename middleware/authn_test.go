@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+	"github.com/tjm/puppet-patching-automation/models"
+)
+
+// TestMain runs the tests against a temporary sqlite database (db/test.db in a temporary directory)
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetLevel(log.WarnLevel)
+	dir, err := os.MkdirTemp("", "authn-test")
+	if err != nil {
+		panic(err)
+	}
+	err = os.Chdir(dir)
+	if err == nil {
+		err = os.Mkdir("db", 0o700)
+	}
+	if err != nil {
+		panic(err)
+	}
+	config.SetArgs(&config.Arguments{
+		DBType:         "sqlite3",
+		DBName:         "test",
+		SessionName:    "test",
+		SessionAuthKey: "0123456789abcdef0123456789abcdef",
+		SessionEncKey:  "0123456789abcdef0123456789abcdef",
+		AuthType:       "local",
+		AuthHeader:     "X-Forwarded-User",
+	})
+	models.Connect()
+	code := m.Run()
+	_ = os.Chdir(os.TempDir())
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestRouter returns a router with sessions, the authentication routes and a protected /whoami
+func newTestRouter(auth Authenticator) *gin.Engine {
+	router := gin.New()
+	router.Use(HandleSession())
+	router.SetHTMLTemplate(template.Must(template.New("login-form.gohtml").Parse("{{ .message }}")))
+	auth.SetupRoutes(router)
+	router.GET("/whoami", auth.AuthRequired(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(authUserKey))
+	})
+	return router
+}
+
+// setLocalUsers configures LocalUsers and (re-)creates the local authentication
+func setLocalUsers(t *testing.T, users ...string) *localAuth {
+	t.Helper()
+	config.GetArgs().LocalUsers = users
+	return createLocalAuth()
+}
+
+func getTestUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	user, err := models.GetUserByUsername(username)
+	if err != nil {
+		t.Fatalf("user %s: %v", username, err)
+	}
+	return user
+}
+
+func TestCheckLocalUser(t *testing.T) {
+	setLocalUsers(t, "alice:secret1", "bob:secret2")
+	bob := getTestUser(t, "bob")
+	bob.Enabled = false
+	if err := bob.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{"valid", "alice", "secret1", false},
+		{"username is case insensitive", "ALICE", "secret1", false},
+		{"wrong password", "alice", "secret2", true},
+		{"empty password", "alice", "", true},
+		{"unknown user", "mallory", "secret1", true},
+		{"disabled user", "bob", "secret2", true},
+		{"hash is not a password", "alice", getTestUser(t, "alice").PasswordHash, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := checkLocalUser(tt.username, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkLocalUser(%q) error = %v, wantErr %v", tt.username, err, tt.wantErr)
+			}
+			if !tt.wantErr && user.Username != strings.ToLower(tt.username) {
+				t.Errorf("checkLocalUser(%q) user = %q", tt.username, user.Username)
+			}
+		})
+	}
+}
+
+func TestCreateLocalAuthKeepsPasswordHash(t *testing.T) {
+	const hash = "$2a$10$LcWSZoMpk1IRXiKamixB7uos.WKMGwgbirsiA7CSrG8Dm4iG1CBcq"
+	setLocalUsers(t, "carol:secret3", "dave:"+hash)
+	carol := getTestUser(t, "carol")
+	if carol.PasswordHash == "secret3" || carol.PasswordHash == "" {
+		t.Fatalf("password not hashed: %q", carol.PasswordHash)
+	}
+	if dave := getTestUser(t, "dave"); dave.PasswordHash != hash {
+		t.Errorf("bcrypt hash not stored as is: %q", dave.PasswordHash)
+	}
+
+	// disabled users are not re-hashed either
+	carol.Enabled = false
+	if err := carol.Save(); err != nil {
+		t.Fatal(err)
+	}
+	setLocalUsers(t, "carol:secret3", "dave:"+hash)
+	if got := getTestUser(t, "carol"); got.PasswordHash != carol.PasswordHash || got.Enabled {
+		t.Errorf("restart changed carol: hash %q -> %q, enabled %v", carol.PasswordHash, got.PasswordHash, got.Enabled)
+	}
+
+	// a changed password is re-hashed
+	setLocalUsers(t, "carol:changed")
+	got := getTestUser(t, "carol")
+	if got.PasswordHash == carol.PasswordHash || !got.IsPasswordUnchanged("changed") {
+		t.Errorf("password change not applied: %q", got.PasswordHash)
+	}
+}
+
+func TestLocalAuthRequired(t *testing.T) {
+	router := newTestRouter(setLocalUsers(t, "erin:secret4"))
+	tests := []struct {
+		name       string
+		user       string
+		password   string
+		accept     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"basic auth", "erin", "secret4", "", http.StatusOK, "erin"},
+		{"basic auth wrong password", "erin", "wrong", "", http.StatusUnauthorized, ""},
+		{"no credentials (API)", "", "", "application/json", http.StatusUnauthorized, ""},
+		{"no credentials (browser)", "", "", "text/html", http.StatusFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLocalLoginSession(t *testing.T) {
+	router := newTestRouter(setLocalUsers(t, "frank:secret5"))
+
+	login := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"frank"}, "password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := login("wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status = %d", w.Code)
+	}
+	w := login("secret5")
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status = %d (%s)", w.Code, w.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "frank" {
+		t.Errorf("session: status = %d, body = %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHeaderAuthRequired(t *testing.T) {
+	config.GetArgs().TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+	router := newTestRouter(createHeaderAuth())
+	tests := []struct {
+		name       string
+		remoteAddr string
+		user       string
+		wantStatus int
+	}{
+		{"trusted network", "10.1.2.3:1234", "grace", http.StatusOK},
+		{"trusted address", "192.0.2.1:1234", "grace", http.StatusOK},
+		{"untrusted address", "192.0.2.2:1234", "grace", http.StatusUnauthorized},
+		{"missing header", "10.1.2.3:1234", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.user != "" {
+				req.Header.Set("X-Forwarded-User", tt.user)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.user {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.user)
+			}
+		})
+	}
+}
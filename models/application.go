@@ -15,6 +15,7 @@ type Application struct {
 	PatchingProcedure string         `json:"patching_procedure"`
 	PatchRunID        uint           `gorm:"index"`
 	Environments      []*Environment `json:"environments"`
+	patchRun          *PatchRun      // GetPatchRun (param templates)
 }
 
 // Applications - List of Application
@@ -127,7 +128,7 @@ func (a *Application) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
 		return
 	}
 	breadcrumbs = append(breadcrumbs, Applications{}.GetBreadCrumbs(patchRun)...)                                                     // Application List
-	breadcrumbs = append(breadcrumbs, createBreadCrumb(fmt.Sprintf("Application: %s", a.Name), fmt.Sprintf("/application/%v", a.ID))) // We don't navigate here
+	breadcrumbs = append(breadcrumbs, createBreadCrumb(fmt.Sprintf("Application: %s", a.Name), fmt.Sprintf("/application/%v", a.ID))) // SELF
 	return
 }
 
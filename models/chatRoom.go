@@ -11,7 +11,7 @@ type ChatRoom struct {
 	gorm.Model
 	Name        string `binding:"required"`
 	Description string
-	WebhookURL  string `binding:"required,url"`
+	WebhookURL  SecretString `binding:"omitempty,url"` // required on create, blank keeps existing
 	Enabled     bool
 }
 
@@ -41,6 +41,7 @@ func (r *ChatRoom) Delete(cascade bool) (err error) {
 	// if cascade {
 	// 	// no child objects (yet)
 	// }
+	_ = DeleteHealthChecksForTarget(HealthTargetChatRoom, r.ID)
 	err = GetDB().Delete(r).Error
 	return
 }
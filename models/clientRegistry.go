@@ -0,0 +1,97 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tjm/puppet-patching-automation/config"
+)
+
+// ***** NOTICE: API clients are cached in a central registry, keyed by kind and ID (i.e. puppetdb, PuppetServer.ID).
+// *****         Each entry records a hash of the configuration that created it, so a client is rebuilt when
+// *****         the configuration (hostname, CA cert, token, ...) changes, or after ClientCacheTTL (to pick
+// *****         up changes to external secret references). Save and Delete also invalidate the clients.
+
+// Client Kinds
+const (
+	ClientKindOrch     = "orchestrator"
+	ClientKindPuppetDB = "puppetdb"
+	ClientKindPE       = "pe"
+	ClientKindJenkins  = "jenkins"
+	ClientKindTrello   = "trello"
+)
+
+// clientKey identifies a cached client
+type clientKey struct {
+	kind string
+	id   uint
+}
+
+// cachedClient is an entry in the client registry
+type cachedClient struct {
+	hash    string
+	client  interface{}
+	created time.Time
+}
+
+var clientRegistry = struct {
+	sync.Mutex
+	clients map[clientKey]*cachedClient
+}{clients: make(map[clientKey]*cachedClient)}
+
+// GetClient returns the cached client for kind and id, calling create if there is no cached client,
+// the config hash has changed, or the cached client is older than ClientCacheTTL
+func GetClient[T any](kind string, id uint, hash string, create func() (T, error)) (client T, err error) {
+	key := clientKey{kind: kind, id: id}
+	clientRegistry.Lock()
+	entry, found := clientRegistry.clients[key]
+	clientRegistry.Unlock()
+	if found && entry.hash == hash && !isClientExpired(entry) {
+		if client, ok := entry.client.(T); ok {
+			return client, nil
+		}
+	}
+
+	// NOTE: create is called without the lock held, as it may make API calls
+	client, err = create()
+	if err != nil {
+		return
+	}
+	clientRegistry.Lock()
+	clientRegistry.clients[key] = &cachedClient{hash: hash, client: client, created: time.Now()}
+	clientRegistry.Unlock()
+	return
+}
+
+// InvalidateClients removes the cached clients of the kinds for id
+func InvalidateClients(id uint, kinds ...string) {
+	clientRegistry.Lock()
+	defer clientRegistry.Unlock()
+	for _, kind := range kinds {
+		delete(clientRegistry.clients, clientKey{kind: kind, id: id})
+	}
+}
+
+// isClientExpired returns true if the client is older than ClientCacheTTL
+func isClientExpired(entry *cachedClient) bool {
+	ttl := config.GetArgs().ClientCacheTTL
+	return ttl > 0 && time.Since(entry.created) > ttl
+}
+
+// hashConfig returns a hash of the values (used to detect configuration changes)
+func hashConfig(values ...interface{}) string {
+	h := sha256.New()
+	for _, v := range values {
+		fmt.Fprintf(h, "%v\x00", v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GetTrelloConfigHash returns a hash of the Trello client configuration
+func GetTrelloConfigHash(appKey, token string) string {
+	args := config.GetArgs()
+	return hashConfig(appKey, token, args.TrelloTimeout, args.TrelloRetries)
+}
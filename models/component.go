@@ -19,6 +19,8 @@ type Component struct {
 	TrelloChecklistID string  `json:"trello_checklist_id"`
 	EnvironmentID     uint    `json:"environment_id"`
 	//Environment       *Environment
+
+	patchRun *PatchRun // GetPatchRun (param templates)
 }
 
 // Components - List of Components
@@ -83,9 +85,10 @@ func (c *Component) GetServer(name string) (server *Server) {
 }
 
 // GetServerList : Return list of servers, sorted by name
+// NOTE: Excluded servers are not included in the list (targets)
 func (c *Component) GetServerList() (names []string) {
 	names = make([]string, 0, len(c.Servers))
-	for _, server := range c.GetServers() {
+	for _, server := range c.GetIncludedServers() {
 		names = append(names, server.Name)
 	}
 	sort.Strings(names)
@@ -102,6 +105,16 @@ func (c *Component) GetServers() (servers Servers) {
 	return c.Servers
 }
 
+// GetIncludedServers : Return Servers that are not excluded from patching, sorted by name
+func (c *Component) GetIncludedServers() (servers Servers) {
+	return c.GetServers().GetIncluded()
+}
+
+// GetReadiness returns the readiness roll-up of the servers (not excluded)
+func (c *Component) GetReadiness() Readiness {
+	return c.GetServers().GetReadiness()
+}
+
 // GetServersOnPuppetServer : Return Servers Associated to puppetServer sorted by name
 func (c *Component) GetServersOnPuppetServer(puppetServerID uint) (servers Servers) {
 	servers = make(Servers, 0)
@@ -111,22 +124,12 @@ func (c *Component) GetServersOnPuppetServer(puppetServerID uint) (servers Serve
 
 // GetPuppetTasks returns a list of puppet tasks for this component
 func (c *Component) GetPuppetTasks(puppetServerID uint) (tasks PuppetTasks) {
-	tasks = make(PuppetTasks, 0)
-	err := GetDB().Model(&PuppetServer{Model: gorm.Model{ID: puppetServerID}}).Where(&PuppetTask{Enabled: true, IsForComponent: true}).Distinct().Order("name").Association("PuppetTasks").Find(&tasks)
-	if err != nil {
-		log.WithField("componentID", c.ID).Error("Error Retrieving PuppetTasks from Component")
-	}
-	return
+	return getPuppetTasks(puppetServerID, &PuppetTask{Enabled: true, IsForComponent: true})
 }
 
 // GetPuppetPlans returns a list of puppet plans for this component
 func (c *Component) GetPuppetPlans(puppetServerID uint) (plans PuppetPlans) {
-	plans = make(PuppetPlans, 0)
-	err := GetDB().Model(&PuppetServer{Model: gorm.Model{ID: puppetServerID}}).Where(&PuppetPlan{Enabled: true, IsForComponent: true}).Distinct().Order("name").Association("PuppetPlans").Find(&plans)
-	if err != nil {
-		log.WithField("componentID", c.ID).Error("Error Retrieving PuppetPlans from Component", err)
-	}
-	return
+	return getPuppetPlans(puppetServerID, &PuppetPlan{Enabled: true, IsForComponent: true})
 }
 
 // GetPuppetServers returns a list of PuppetServers from the component's servers
@@ -141,9 +144,7 @@ func (c *Component) GetPuppetServers() (puppetServers PuppetServers) {
 
 // GetPuppetJobs returns a list of PuppetJobs for this component
 func (c *Component) GetPuppetJobs(puppetServerID uint, kind string) (jobs []*PuppetJob) {
-	jobs = make([]*PuppetJob, 0)
-	GetDB().Where(&PuppetJob{PuppetServerID: puppetServerID, InitiatorID: c.ID, InitiatorType: "Component", PuppetParentType: kind}).Find(&jobs)
-	return
+	return getPuppetJobs(puppetServerID, "Component", c.ID, kind)
 }
 
 // GetBreadCrumbs returns a list of bread crumbs for navigation
@@ -70,23 +70,33 @@ func Connect() {
 		&Environment{},
 		&Component{},
 		&Server{},
+		&FactSnapshot{},
 		&TrelloBoard{},
 		&PatchRun{},
+		&PatchWindow{},
 		&PuppetServer{},
 		&PuppetTask{},
 		&PuppetTaskParam{},
 		&PuppetPlan{},
 		&PuppetPlanParam{},
 		&PuppetJob{},
+		&PuppetMetadata{},
 		&JenkinsServer{},
 		&JenkinsJob{},
 		&JenkinsJobParam{},
 		&JenkinsBuild{},
 		ChatRoom{},
+		&User{},
+		&Setting{},
+		&HealthCheck{},
 	)
 	if err != nil {
 		panic("failed to migrate database: " + err.Error())
 	}
+
+	// Encrypt (or rotate) secrets and store settings from config
+	migrateSecrets()
+	initSettings()
 }
 
 // GetDB returns a handle to the DB object
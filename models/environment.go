@@ -17,6 +17,7 @@ type Environment struct {
 	TrelloCardID      string     `json:"trello_card_id"`
 	TrelloCardURL     string     `json:"trello_card_url"`
 	ApplicationID     uint
+	patchRun          *PatchRun // GetPatchRun (param templates)
 	//Application       *Application
 }
 
@@ -95,8 +96,8 @@ func (e *Environment) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
 		log.Error("Error getting breadcrumbs: " + err.Error())
 		return
 	}
-	breadcrumbs = append(breadcrumbs, createBreadCrumb(fmt.Sprintf("App: %s", app.Name), fmt.Sprintf("/application/%v", app.ID)))
-	breadcrumbs = append(breadcrumbs, app.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, Environments{}.GetBreadCrumbs(app)...)                                                          // Environment List
+	breadcrumbs = append(breadcrumbs, createBreadCrumb(fmt.Sprintf("Environment: %s", e.Name), fmt.Sprintf("/environment/%v", e.ID))) // SELF
 	return
 }
 
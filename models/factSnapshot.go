@@ -0,0 +1,216 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Fact Snapshot Stages
+const (
+	SnapshotStageInventory = "inventory" // PuppetDB query for the patch run
+	SnapshotStagePre       = "pre"       // before patching (readiness check)
+	SnapshotStagePost      = "post"      // after patching (verify results)
+)
+
+// SnapshotStages is the list of fact snapshot stages (in order)
+var SnapshotStages = []string{SnapshotStageInventory, SnapshotStagePre, SnapshotStagePost}
+
+// FactSnapshot is a snapshot of the (raw) facts of a server at a stage of a patch run
+// NOTE: Snapshots are by Certname, not Server, because servers are recreated by each PuppetDB query.
+type FactSnapshot struct {
+	gorm.Model
+	PatchRunID uint   `gorm:"index"`
+	Certname   string `gorm:"index"`
+	Stage      string
+	Facts      string `gorm:"type:text"` // JSON object (fact path: value)
+	TakenAt    time.Time
+	PatchFacts PatchFacts `gorm:"embedded;embeddedPrefix:patch_"`
+}
+
+// PatchFacts are the facts used to verify the patch results (always snapshotted, not only the configured facts)
+type PatchFacts struct {
+	PackageUpdates  int       `json:"package_updates"`
+	SecurityUpdates int       `json:"security_updates"`
+	Kernel          string    `json:"kernel"`
+	Uptime          int       `json:"uptime"` // seconds
+	RebootRequired  bool      `json:"reboot_required"`
+	FactsAt         time.Time `json:"facts_at"` // when the facts were submitted to PuppetDB (zero if unknown)
+}
+
+// FactSnapshots is a list of FactSnapshot
+type FactSnapshots []*FactSnapshot
+
+// FactDiff is the value of a fact at each stage of a patch run
+type FactDiff struct {
+	Certname string            `json:"certname"`
+	Fact     string            `json:"fact"`
+	Values   map[string]string `json:"values"` // by stage
+	Changed  bool              `json:"changed"`
+}
+
+// SaveFactSnapshot will save (replace) the fact snapshot for the certname at the stage of the patch run
+func SaveFactSnapshot(patchRunID uint, certname string, stage string, facts map[string]interface{}, patchFacts PatchFacts) (err error) {
+	b, err := json.Marshal(facts)
+	if err != nil {
+		return
+	}
+	snapshot := new(FactSnapshot)
+	err = GetDB().Where(&FactSnapshot{PatchRunID: patchRunID, Certname: certname, Stage: stage}).FirstOrInit(snapshot).Error
+	if err != nil {
+		return
+	}
+	snapshot.Facts = string(b)
+	snapshot.PatchFacts = patchFacts
+	snapshot.TakenAt = time.Now()
+	return GetDB().Save(snapshot).Error
+}
+
+// GetFactSnapshots returns the fact snapshots for a patch run (and certname, if not blank)
+func GetFactSnapshots(patchRunID uint, certname string) (snapshots FactSnapshots) {
+	snapshots = make(FactSnapshots, 0)
+	err := GetDB().Where(&FactSnapshot{PatchRunID: patchRunID, Certname: certname}).Order("certname").Find(&snapshots).Error
+	if err != nil {
+		log.Error("Error retrieving fact snapshots: ", err)
+	}
+	return
+}
+
+// GetFactSnapshot returns the fact snapshot for the certname at the stage of the patch run (ID 0 if not found)
+func GetFactSnapshot(patchRunID uint, certname string, stage string) (snapshot *FactSnapshot, err error) {
+	snapshot = new(FactSnapshot)
+	err = GetDB().Where(&FactSnapshot{PatchRunID: patchRunID, Certname: certname, Stage: stage}).Limit(1).Find(snapshot).Error
+	return
+}
+
+// GetFactSnapshotCertnames returns the certnames with a fact snapshot at the stage of the patch run
+func GetFactSnapshotCertnames(patchRunID uint, stage string) (certnames map[string]bool) {
+	certnames = make(map[string]bool)
+	var list []string
+	err := GetDB().Model(&FactSnapshot{}).Where(&FactSnapshot{PatchRunID: patchRunID, Stage: stage}).Pluck("certname", &list).Error
+	if err != nil {
+		log.Error("Error retrieving fact snapshots: ", err)
+	}
+	for _, certname := range list {
+		certnames[certname] = true
+	}
+	return
+}
+
+// DeleteFactSnapshots will delete the fact snapshots for a patch run
+func DeleteFactSnapshots(patchRunID uint) (err error) {
+	return GetDB().Where(&FactSnapshot{PatchRunID: patchRunID}).Delete(&FactSnapshot{}).Error
+}
+
+// GetFacts returns the facts from the snapshot
+func (s *FactSnapshot) GetFacts() (facts map[string]interface{}) {
+	facts = make(map[string]interface{})
+	err := json.Unmarshal([]byte(s.Facts), &facts)
+	if err != nil {
+		log.WithField("factSnapshot", s.ID).Error("Error parsing fact snapshot: ", err)
+	}
+	return
+}
+
+// GetDiffs returns the value of each fact at each stage, sorted by certname and fact
+// NOTE: The uptime facts (system_uptime) always increase, so they only changed if they decreased (rebooted)
+func (snapshots FactSnapshots) GetDiffs() (diffs []*FactDiff) {
+	diffs = make([]*FactDiff, 0)
+	index := make(map[string]*FactDiff)
+	raw := make(map[*FactDiff]map[string]interface{}) // values by stage (not formatted)
+	for _, snapshot := range snapshots {
+		for fact, value := range snapshot.GetFacts() {
+			key := snapshot.Certname + "\x00" + fact
+			diff, ok := index[key]
+			if !ok {
+				diff = &FactDiff{Certname: snapshot.Certname, Fact: fact, Values: make(map[string]string)}
+				index[key] = diff
+				raw[diff] = make(map[string]interface{})
+				diffs = append(diffs, diff)
+			}
+			diff.Values[snapshot.Stage] = formatFactValue(value)
+			raw[diff][snapshot.Stage] = value
+		}
+	}
+	for _, diff := range diffs {
+		uptime := isUptimeFact(diff.Fact)
+		first := true
+		var previous string
+		var previousRaw interface{}
+		for _, stage := range SnapshotStages {
+			value, ok := diff.Values[stage]
+			if !ok {
+				continue
+			}
+			switch {
+			case first:
+			case uptime:
+				if isUptimeDecreased(previousRaw, raw[diff][stage]) {
+					diff.Changed = true
+				}
+			case value != previous:
+				diff.Changed = true
+			}
+			first, previous, previousRaw = false, value, raw[diff][stage]
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Certname != diffs[j].Certname {
+			return diffs[i].Certname < diffs[j].Certname
+		}
+		return diffs[i].Fact < diffs[j].Fact
+	})
+	return
+}
+
+// GetStages returns the stages (in order) with a snapshot
+func (snapshots FactSnapshots) GetStages() (stages []string) {
+	found := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		found[snapshot.Stage] = true
+	}
+	for _, stage := range SnapshotStages {
+		if found[stage] {
+			stages = append(stages, stage)
+		}
+	}
+	return
+}
+
+// isUptimeFact returns true for the uptime fact (system_uptime) and its sub-facts
+func isUptimeFact(fact string) bool {
+	return fact == "system_uptime" || strings.HasPrefix(fact, "system_uptime.")
+}
+
+// isUptimeDecreased returns true if the uptime (seconds, or the "seconds" of the system_uptime hash) decreased
+// NOTE: Values that are not numbers (i.e. system_uptime.uptime "2:03 hours") are never changed
+func isUptimeDecreased(before, after interface{}) bool {
+	if m, ok := before.(map[string]interface{}); ok {
+		before = m["seconds"]
+	}
+	if m, ok := after.(map[string]interface{}); ok {
+		after = m["seconds"]
+	}
+	b, ok := before.(float64)
+	if !ok {
+		return false
+	}
+	a, ok := after.(float64)
+	return ok && a < b
+}
+
+// formatFactValue returns a fact value as a string (strings are not quoted)
+func formatFactValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Health Check Target Types
+const (
+	HealthTargetPuppetServer  = "puppetServer"
+	HealthTargetJenkinsServer = "jenkinsServer"
+	HealthTargetChatRoom      = "chatRoom"
+	HealthTargetTrello        = "trello"
+)
+
+// Health Check Components (a target can have more than one, i.e. a PuppetServer has puppetdb, orchestrator and pe)
+const (
+	HealthComponentPuppetDB     = "puppetdb"
+	HealthComponentOrchestrator = "orchestrator"
+	HealthComponentPE           = "pe"
+	HealthComponentJenkins      = "jenkins"
+	HealthComponentChatRoom     = "webhook"
+	HealthComponentTrello       = "api"
+)
+
+// HealthCheck records the result of the last connection test for an integration
+type HealthCheck struct {
+	gorm.Model
+	TargetType string `gorm:"uniqueIndex:idx_health_target"`
+	TargetID   uint   `gorm:"uniqueIndex:idx_health_target"`
+	Component  string `gorm:"uniqueIndex:idx_health_target"`
+	Name       string
+	OK         bool
+	Latency    time.Duration
+	Error      string
+	CheckedAt  time.Time
+}
+
+// HealthChecks is a list of HealthCheck objects
+type HealthChecks []*HealthCheck
+
+// NewHealthCheck returns a HealthCheck for the target (existing, or new)
+func NewHealthCheck(targetType string, targetID uint, component string) (h *HealthCheck) {
+	h = new(HealthCheck)
+	GetDB().Where(&HealthCheck{TargetType: targetType, TargetID: targetID, Component: component}).FirstOrInit(h)
+	return
+}
+
+// Save : Save HealthCheck object
+func (h *HealthCheck) Save() error {
+	return GetDB().Save(h).Error
+}
+
+// Record will record the result of a check
+func (h *HealthCheck) Record(name string, latency time.Duration, err error) {
+	h.Name = name
+	h.Latency = latency
+	h.CheckedAt = time.Now()
+	h.OK = err == nil
+	h.Error = ""
+	if err != nil {
+		h.Error = err.Error()
+	}
+}
+
+// GetLatencyString returns the latency rounded to milliseconds
+func (h *HealthCheck) GetLatencyString() string {
+	return h.Latency.Round(time.Millisecond).String()
+}
+
+// GetTargetURL returns the URL of the configuration page of the target
+func (h *HealthCheck) GetTargetURL() string {
+	switch h.TargetType {
+	case HealthTargetPuppetServer:
+		return fmt.Sprintf("/config/puppetServer/%v", h.TargetID)
+	case HealthTargetJenkinsServer:
+		return fmt.Sprintf("/config/jenkinsServer/%v", h.TargetID)
+	case HealthTargetChatRoom:
+		return fmt.Sprintf("/config/ChatRoom/%v", h.TargetID)
+	default:
+		return "/config/settings"
+	}
+}
+
+// GetHealthChecks returns a list of all HealthChecks
+func GetHealthChecks() (checks HealthChecks) {
+	checks = make(HealthChecks, 0)
+	GetDB().Order("target_type, name, component").Find(&checks)
+	return
+}
+
+// GetHealthChecksForTarget returns the HealthChecks for a target
+func GetHealthChecksForTarget(targetType string, targetID uint) (checks HealthChecks) {
+	checks = make(HealthChecks, 0)
+	GetDB().Where(&HealthCheck{TargetType: targetType, TargetID: targetID}).Order("component").Find(&checks)
+	return
+}
+
+// DeleteHealthChecksForTarget removes the HealthChecks for a target (i.e. when the target is deleted)
+func DeleteHealthChecksForTarget(targetType string, targetID uint) error {
+	return GetDB().Unscoped().Where(&HealthCheck{TargetType: targetType, TargetID: targetID}).Delete(&HealthCheck{}).Error
+}
+
+// GetFailed returns the HealthChecks that are not OK
+func (checks HealthChecks) GetFailed() (failed HealthChecks) {
+	for _, check := range checks {
+		if !check.OK {
+			failed = append(failed, check)
+		}
+	}
+	return
+}
+
+// GetBreadCrumbs returns a list of bread crumbs for navigation
+func (checks HealthChecks) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, GetDefaultBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Health", "/config/health"))
+	return
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// JenkinsActions are the Jenkins jobs (and their builds) available for an Application, Environment, Component or Server
+type JenkinsActions struct {
+	Path   string // path of the object, i.e. /application/1
+	Jobs   JenkinsJobs
+	Builds []*JenkinsBuild
+}
+
+// GetJenkinsActions returns the Jenkins jobs for the application (nil if there are none)
+func (a *Application) GetJenkinsActions() *JenkinsActions {
+	return getJenkinsActions(fmt.Sprintf("/application/%v", a.ID), "Application", a.ID, &JenkinsJob{IsForApplication: true})
+}
+
+// GetJenkinsActions returns the Jenkins jobs for the environment (nil if there are none)
+func (e *Environment) GetJenkinsActions() *JenkinsActions {
+	return getJenkinsActions(fmt.Sprintf("/environment/%v", e.ID), "Environment", e.ID, &JenkinsJob{IsForEnvironment: true})
+}
+
+// GetJenkinsActions returns the Jenkins jobs for the component (nil if there are none)
+func (c *Component) GetJenkinsActions() *JenkinsActions {
+	return getJenkinsActions(fmt.Sprintf("/component/%v", c.ID), "Component", c.ID, &JenkinsJob{IsForComponent: true})
+}
+
+// GetJenkinsActions returns the Jenkins jobs for the server (nil if there are none)
+func (s *Server) GetJenkinsActions() *JenkinsActions {
+	return getJenkinsActions(fmt.Sprintf("/server/%v", s.ID), "Server", s.ID, &JenkinsJob{IsForServer: true})
+}
+
+// getJenkinsActions returns the Jenkins jobs matching the filter and the builds started from the initiator
+func getJenkinsActions(path string, initiatorType string, initiatorID uint, filter *JenkinsJob) *JenkinsActions {
+	a := &JenkinsActions{Path: path, Jobs: make(JenkinsJobs, 0), Builds: make([]*JenkinsBuild, 0)}
+	err := GetDB().Where(filter).Order("name").Find(&a.Jobs).Error
+	if err != nil {
+		log.WithField("initiatorType", initiatorType).Error("Error Retrieving JenkinsJobs: ", err)
+	}
+	if len(a.Jobs) == 0 {
+		return nil
+	}
+	err = GetDB().Where(&JenkinsBuild{InitiatorType: initiatorType, InitiatorID: initiatorID}).Preload("JenkinsJob").Find(&a.Builds).Error
+	if err != nil {
+		log.WithField("initiatorType", initiatorType).Error("Error Retrieving JenkinsBuilds: ", err)
+	}
+	return a
+}
+
+// GetPatchRunID returns the ID of the patch run of the environment
+func (e *Environment) GetPatchRunID() uint {
+	app, err := GetApplicationByID(e.ApplicationID)
+	if err != nil {
+		log.Error("Error in GetPatchRunID: ", err)
+		return 0
+	}
+	return app.PatchRunID
+}
+
+// GetPatchRunID returns the ID of the patch run of the component
+func (c *Component) GetPatchRunID() uint {
+	env, err := GetEnvironmentByID(c.EnvironmentID)
+	if err != nil {
+		log.Error("Error in GetPatchRunID: ", err)
+		return 0
+	}
+	return env.GetPatchRunID()
+}
+
+// GetPatchRunID returns the ID of the patch run of the server
+func (s *Server) GetPatchRunID() uint {
+	component, err := GetComponentByID(s.ComponentID)
+	if err != nil {
+		log.Error("Error in GetPatchRunID: ", err)
+		return 0
+	}
+	return component.GetPatchRunID()
+}
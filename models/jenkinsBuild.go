@@ -4,19 +4,26 @@ import (
 	"gorm.io/gorm"
 )
 
+// JenkinsBuildStatusDryRun is the status of a dry run build that was not sent to Jenkins
+const JenkinsBuildStatusDryRun = "dry-run"
+
 // JenkinsBuild defines a Jenkins Job
 type JenkinsBuild struct {
 	gorm.Model
 	Name            string
 	Status          string
 	URL             string
-	APIBuildID      int64          // Used by gojenkins
-	QueueID         int64          //used by gojenkins
-	PatchRunID      uint           // Parent Patch Run ID
-	JenkinsJobID    uint           // Parent Jenkins Job ID
-	JenkinsServerID uint           // Parent Jenkins Server ID
-	JenkinsServer   *JenkinsServer `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Jenkins Server
-	JenkinsJob      *JenkinsJob    `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Jenkins Build
+	APIBuildID      int64             // Used by gojenkins
+	QueueID         int64             //used by gojenkins
+	PatchRunID      uint              // Parent Patch Run ID
+	InitiatorID     uint              // ID of the object the build was started from
+	InitiatorType   string            // PatchRun, Application, Environment, Component or Server
+	JenkinsJobID    uint              // Parent Jenkins Job ID
+	JenkinsServerID uint              // Parent Jenkins Server ID
+	Params          map[string]string `gorm:"serializer:json"`
+	DryRun          bool              // Dry run (not sent to Jenkins)
+	JenkinsServer   *JenkinsServer    `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Jenkins Server
+	JenkinsJob      *JenkinsJob       `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Jenkins Build
 }
 
 // NewJenkinsBuild returns a new JenkinsBuild object
@@ -17,6 +17,8 @@ type JenkinsJob struct {
 	Enabled          bool
 	IsForPatchRun    bool
 	IsForApplication bool
+	IsForEnvironment bool
+	IsForComponent   bool
 	IsForServer      bool
 	JenkinsServerID  uint               // Parent Jenkins Server ID
 	JenkinsServer    *JenkinsServer     `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Jenkins Server ID
@@ -78,6 +80,48 @@ func (j *JenkinsJob) GetParams() (params []*JenkinsJobParam, err error) {
 	return
 }
 
+// IsFor returns true if the JenkinsJob is available on the level (PatchRun, Application, Environment, Component or Server)
+func (j *JenkinsJob) IsFor(level string) bool {
+	return isForLevel(level, j.IsForPatchRun, j.IsForApplication, j.IsForEnvironment, j.IsForComponent, j.IsForServer)
+}
+
+// ValidateParamTemplates validates the param templates against a sample object
+// for each level (PatchRun, Application, ...) the jenkins job is available on (the IsFor* fields, not saved yet)
+func (j *JenkinsJob) ValidateParamTemplates() error {
+	params, err := j.GetParams()
+	if err != nil {
+		return err
+	}
+	return validateParamTemplates(params, getParamTemplateSamples(j.IsForPatchRun, j.IsForApplication, j.IsForEnvironment, j.IsForComponent, j.IsForServer, false))
+}
+
+// GetParamValues will execute the param templates (with data, i.e. a PatchRun, Application or Server) and return the param values
+// NOTE: Params without a TemplateValue get their default value, template errors are returned (with the param name)
+func (j *JenkinsJob) GetParamValues(data interface{}) (buildParams map[string]string, err error) {
+	jobParams, err := j.GetParams()
+	if err != nil {
+		log.Error("Error retrieving jenkinsJob params: ", err)
+		return
+	}
+	return getParamValues(j.Name, jobParams, data, true)
+}
+
+// GetSensitiveParamNames returns the names of the sensitive (password and credentials) params
+func (j *JenkinsJob) GetSensitiveParamNames() (names []string) {
+	names = make([]string, 0)
+	jobParams, err := j.GetParams()
+	if err != nil {
+		log.Error("Error retrieving jobParams: ", err)
+		return
+	}
+	for _, jobParam := range jobParams {
+		if jobParam.IsSensitive() {
+			names = append(names, jobParam.Name)
+		}
+	}
+	return
+}
+
 // GetParamByName : Get JenkinsParam by Name for this job
 func (j *JenkinsJob) GetParamByName(paramName string) (param *JenkinsJobParam, err error) {
 	err = GetDB().Model(j).Association("Params").Find(&param, &JenkinsJobParam{Name: paramName})
@@ -8,8 +8,6 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
-
-	"github.com/tjm/puppet-patching-automation/functions"
 )
 
 // JenkinsJobParam defines JenkinsJobParamParams
@@ -61,6 +59,11 @@ func (j *JenkinsJobParam) Delete(cascade bool) (err error) {
 	return GetDB().Delete(j).Error
 }
 
+// getTemplateInfo returns the ID, Name and TemplateValue of the param (templateParam)
+func (j *JenkinsJobParam) getTemplateInfo() (uint, string, string) {
+	return j.ID, j.Name, j.TemplateValue
+}
+
 // GetTemplate : Returns Template for Param
 func (j *JenkinsJobParam) GetTemplate() (tpl *template.Template, err error) {
 	if j.template == nil {
@@ -72,6 +75,17 @@ func (j *JenkinsJobParam) GetTemplate() (tpl *template.Template, err error) {
 	return j.template, nil
 }
 
+// Sensitive Jenkins parameter types (the values are masked in the preview and the recorded builds)
+var sensitiveJenkinsParamTypes = map[string]bool{
+	"PasswordParameterDefinition":    true,
+	"CredentialsParameterDefinition": true,
+}
+
+// IsSensitive returns true for the password and credentials params
+func (j *JenkinsJobParam) IsSensitive() bool {
+	return sensitiveJenkinsParamTypes[j.Type]
+}
+
 // SetDefaultValue will set the appropriate Default value type
 func (j *JenkinsJobParam) SetDefaultValue(value interface{}) (err error) {
 	switch j.Type {
@@ -102,13 +116,24 @@ func (j *JenkinsJobParam) GetDefaultValue() (value string, err error) {
 	return
 }
 
+// ValidateTemplate parses the template and executes it against a sample object
+// for each level (PatchRun, Application, ...) the jenkins job is available on
+func (j *JenkinsJobParam) ValidateTemplate() error {
+	err := j.buildTemplate()
+	if err != nil {
+		return err
+	}
+	job, err := GetJenkinsJobByID(j.JenkinsJobID)
+	if err != nil {
+		return err
+	}
+	return validateParamTemplate(j.template, getParamTemplateSamples(job.IsForPatchRun, job.IsForApplication, job.IsForEnvironment, job.IsForComponent, job.IsForServer, false))
+}
+
 // buildTemplate : Builds Template
 func (j *JenkinsJobParam) buildTemplate() (err error) {
 	templateName := fmt.Sprintf("JobParamID-%v", j.ID) // I am not even sure where this us used.
-	tpl, err := template.New(templateName).Funcs(template.FuncMap{
-		"FormatAsDateTimeLocal": functions.FormatAsDateTimeLocal,
-		"FormatAsISO8601":       functions.FormatAsISO8601,
-	}).Parse(j.TemplateValue)
+	tpl, err := parseParamTemplate(templateName, j.TemplateValue)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"ID":        j.ID,
@@ -2,8 +2,8 @@ package models
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/bndr/gojenkins"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -13,16 +13,17 @@ type JenkinsServer struct {
 	gorm.Model
 	Name          string `binding:"required"`
 	Description   string
-	Hostname      string `binding:"required,fqdn"`
-	Port          uint   `binding:"required,numeric,gte=1,lte=65535"`
-	Username      string `binding:"required"`
-	Token         string // `binding:"required"` - Do not make "required"
+	Hostname      string       `binding:"required,fqdn"`
+	Port          uint         `binding:"required,numeric,gte=1,lte=65535"`
+	Username      string       `binding:"required"`
+	Token         SecretString // `binding:"required"` - Do not make "required"
 	SSL           bool
 	SSLSkipVerify bool
 	CACert        string
 	Enabled       bool
-	Jobs          JenkinsJobs        `json:"-" yaml:"-" xml:"-" form:"-"`
-	APIClient     *gojenkins.Jenkins `gorm:"-" json:"-" yaml:"-" xml:"-" form:"-"`
+	APITimeout    uint        `binding:"omitempty,numeric,gte=1"` // seconds
+	APIRetries    uint        `binding:"omitempty,numeric,lte=10"`
+	Jobs          JenkinsJobs `json:"-" yaml:"-" xml:"-" form:"-"`
 }
 
 // JenkinsServers is a list of JenkinsServer
@@ -35,6 +36,8 @@ func NewJenkinsServer() (j *JenkinsServer) {
 	j.Port = 443
 	j.SSL = true
 	j.Enabled = true
+	j.APITimeout = 30
+	j.APIRetries = 2
 	return
 }
 
@@ -46,6 +49,7 @@ func (j *JenkinsServer) Init() {
 // Save : Save PatchRun object
 func (j *JenkinsServer) Save() {
 	GetDB().Save(j)
+	j.InvalidateClients()
 }
 
 // Delete : Delete PatchRun object
@@ -64,6 +68,8 @@ func (j *JenkinsServer) Delete(cascade bool) (err error) {
 			}
 		}
 	}
+	_ = DeleteHealthChecksForTarget(HealthTargetJenkinsServer, j.ID)
+	j.InvalidateClients()
 	err = GetDB().Delete(j).Error
 	return
 }
@@ -131,6 +137,24 @@ func (j *JenkinsServer) GetURL() (url string) {
 	return
 }
 
+// GetAPITimeout returns the timeout for API requests
+func (j *JenkinsServer) GetAPITimeout() time.Duration {
+	if j.APITimeout == 0 {
+		return time.Duration(NewJenkinsServer().APITimeout) * time.Second
+	}
+	return time.Duration(j.APITimeout) * time.Second
+}
+
+// GetConfigHash returns a hash of the configuration used to create the API client
+func (j *JenkinsServer) GetConfigHash() string {
+	return hashConfig(j.Hostname, j.Port, j.Username, j.Token, j.SSL, j.SSLSkipVerify, j.CACert, j.APITimeout, j.APIRetries)
+}
+
+// InvalidateClients removes the cached API client for this JenkinsServer
+func (j *JenkinsServer) InvalidateClients() {
+	InvalidateClients(j.ID, ClientKindJenkins)
+}
+
 // GetBreadCrumbs returns a list of bread crumbs for navigation
 func (j *JenkinsServer) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
 	breadcrumbs = append(breadcrumbs, JenkinsServers{}.GetBreadCrumbs()...) // Patch Run List
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Package Update Types
+const (
+	PackageUpdateNormal   = "update"
+	PackageUpdateSecurity = "security"
+)
+
+// Windows Update Categories (from the update title, the pe_patch facts only have the titles and the KBs)
+const (
+	WindowsUpdateDefinition     = "Definition Updates"
+	WindowsUpdateServicingStack = "Servicing Stack Updates"
+	WindowsUpdateCumulative     = "Cumulative Updates"
+	WindowsUpdateRollup         = "Update Rollups"
+	WindowsUpdateDriver         = "Drivers"
+	WindowsUpdateOther          = "Updates"
+)
+
+// windowsUpdateCategories maps the (lower case) title keywords to the category, in order (first match wins)
+var windowsUpdateCategories = []struct {
+	keyword  string
+	category string
+}{
+	{"security intelligence update", WindowsUpdateDefinition},
+	{"definition update", WindowsUpdateDefinition},
+	{"servicing stack update", WindowsUpdateServicingStack},
+	{"cumulative update", WindowsUpdateCumulative},
+	{"update rollup", WindowsUpdateRollup},
+	{"driver", WindowsUpdateDriver},
+}
+
+// kbPattern matches the KB number in a Windows update title, i.e. "... (KB5027222)"
+var kbPattern = regexp.MustCompile(`\bKB\d+\b`)
+
+// PackageUpdate is a package that will be updated on a server
+type PackageUpdate struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`               // update or security
+	KB       string `json:"kb,omitempty"`       // Windows only
+	Category string `json:"category,omitempty"` // Windows only
+}
+
+// PackageMatrixRow is a package and the servers (by ID) where it will be updated (with the update type)
+type PackageMatrixRow struct {
+	Name    string          `json:"name"`
+	Servers map[uint]string `json:"servers"`
+}
+
+// PackageMatrix is a package × server matrix of the package updates of a patch run
+type PackageMatrix struct {
+	Packages []*PackageMatrixRow `json:"packages"`
+	Servers  Servers             `json:"servers"`
+}
+
+// GetPackageUpdates returns the packages that will be updated on the server (matching search, if not blank), sorted by name
+// NOTE: Security updates are also in the (normal) package updates list
+func (s *Server) GetPackageUpdates(search string) (packages []*PackageUpdate) {
+	packages = make([]*PackageUpdate, 0)
+	security := make(map[string]bool)
+	for _, name := range s.SecurityPackages {
+		security[name] = true
+	}
+	seen := make(map[string]bool)
+	for _, name := range append(append([]string{}, s.UpdatePackages...), s.SecurityPackages...) {
+		if seen[name] || !matchPackage(name, search) {
+			continue
+		}
+		seen[name] = true
+		pkg := &PackageUpdate{Name: name, Type: PackageUpdateNormal}
+		if security[name] {
+			pkg.Type = PackageUpdateSecurity
+		}
+		if s.IsWindows() {
+			pkg.KB = kbPattern.FindString(name)
+			pkg.Category = getWindowsUpdateCategory(name)
+		}
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return
+}
+
+// GetWindowsUpdateCategories returns the number of updates by category (Windows only, empty otherwise)
+func (s *Server) GetWindowsUpdateCategories() (categories map[string]int) {
+	categories = make(map[string]int)
+	if !s.IsWindows() {
+		return
+	}
+	for _, pkg := range s.GetPackageUpdates("") {
+		categories[pkg.Category]++
+	}
+	return
+}
+
+// GetPackagesBreadCrumbs returns a list of bread crumbs for navigation (server package updates)
+func (s *Server) GetPackagesBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	component, err := GetComponentByID(s.ComponentID)
+	if err != nil {
+		breadcrumbs = append(breadcrumbs, GetDefaultBreadCrumbs()...)
+	} else {
+		breadcrumbs = append(breadcrumbs, component.GetBreadCrumbs()...)
+	}
+	breadcrumbs = append(breadcrumbs, createBreadCrumb(fmt.Sprintf("Packages: %s", s.Name), fmt.Sprintf("/server/%v/packages", s.ID)))
+	return
+}
+
+// GetPackageMatrix returns the package × server matrix of the servers in the patch run (matching search, if not blank)
+// NOTE: Only the servers with a matching package update are included
+func (p *PatchRun) GetPackageMatrix(search string) (matrix PackageMatrix) {
+	matrix.Packages = make([]*PackageMatrixRow, 0)
+	matrix.Servers = make(Servers, 0)
+	index := make(map[string]*PackageMatrixRow)
+	for _, server := range p.GetAllServers() {
+		packages := server.GetPackageUpdates(search)
+		if len(packages) == 0 {
+			continue
+		}
+		matrix.Servers = append(matrix.Servers, server)
+		for _, pkg := range packages {
+			row, ok := index[pkg.Name]
+			if !ok {
+				row = &PackageMatrixRow{Name: pkg.Name, Servers: make(map[uint]string)}
+				index[pkg.Name] = row
+				matrix.Packages = append(matrix.Packages, row)
+			}
+			row.Servers[server.ID] = pkg.Type
+		}
+	}
+	sort.Slice(matrix.Packages, func(i, j int) bool { return matrix.Packages[i].Name < matrix.Packages[j].Name })
+	sort.Slice(matrix.Servers, func(i, j int) bool { return matrix.Servers[i].Name < matrix.Servers[j].Name })
+	return
+}
+
+// GetPackagesBreadCrumbs returns a list of bread crumbs for navigation (package matrix)
+func (p *PatchRun) GetPackagesBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, p.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Packages", fmt.Sprintf("/patchRun/%v/packages", p.ID)))
+	return
+}
+
+// getWindowsUpdateCategory returns the category of a Windows update from its title
+func getWindowsUpdateCategory(title string) string {
+	title = strings.ToLower(title)
+	for _, c := range windowsUpdateCategories {
+		if strings.Contains(title, c.keyword) {
+			return c.category
+		}
+	}
+	return WindowsUpdateOther
+}
+
+// matchPackage returns true if the package name contains the search (case insensitive), or the search is blank
+func matchPackage(name string, search string) bool {
+	return search == "" || strings.Contains(strings.ToLower(name), strings.ToLower(search))
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/tjm/puppet-patching-automation/functions"
+)
+
+// paramTemplateSample is a sample object to validate the param templates for a level (PatchRun, Application, ...)
+type paramTemplateSample struct {
+	Level string
+	Data  interface{}
+}
+
+// templateParam is a param with a template value (PuppetTaskParam, PuppetPlanParam and JenkinsJobParam)
+type templateParam interface {
+	GetTemplate() (*template.Template, error)
+	GetDefaultValue() (string, error)
+	getTemplateInfo() (id uint, name string, templateValue string)
+}
+
+// getParamValues executes the param templates (with data) and returns the param values, template errors are returned
+// (with the param name). Params without a TemplateValue get their default value if useDefault (Jenkins), otherwise
+// they are empty (not sent, the orchestrator applies the default value).
+func getParamValues[P templateParam](owner string, params []P, data interface{}, useDefault bool) (values map[string]string, err error) {
+	values = make(map[string]string)
+	for _, param := range params {
+		id, name, templateValue := param.getTemplateInfo()
+		if templateValue == "" {
+			values[name] = ""
+			if useDefault {
+				values[name], err = param.GetDefaultValue()
+				if err != nil {
+					log.WithFields(log.Fields{"owner": owner, "paramName": name}).Error("Error retrieving default value: ", err)
+					err = nil // NOTE: the value will be ""
+				}
+			}
+			continue
+		}
+		var tpl *template.Template
+		tpl, err = param.GetTemplate()
+		if err != nil {
+			log.WithFields(log.Fields{"owner": owner, "paramID": id}).Error("Error getting template.")
+			return
+		}
+		out := new(strings.Builder)
+		err = tpl.Execute(out, data)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"owner":     owner,
+				"paramName": name,
+				"paramID":   id,
+			}).Error("Error Executing Template: ", err)
+			return values, fmt.Errorf("param %s: %w", name, err)
+		}
+		values[name] = out.String()
+	}
+	return
+}
+
+// paramTemplateFuncs returns the functions available in the param templates (PuppetTask, PuppetPlan and JenkinsJob)
+func paramTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"FormatAsDateTimeLocal": functions.FormatAsDateTimeLocal,
+		"FormatAsISO8601":       functions.FormatAsISO8601,
+		"join":                  functions.Join,
+		"toJSON":                functions.ToJSON,
+		"addTime":               functions.AddTime,
+		"now":                   time.Now,
+		"default":               functions.Default,
+		"required":              functions.Required,
+		"fact":                  functions.Fact,
+		"osFamily":              filterOSFamily,
+		"onPuppetServer":        filterPuppetServer,
+		"included":              Servers.GetIncluded,
+		"names":                 Servers.GetNames,
+	}
+}
+
+// parseParamTemplate parses the param template (value) with the param template functions
+func parseParamTemplate(name string, value string) (tpl *template.Template, err error) {
+	return template.New(name).Funcs(paramTemplateFuncs()).Parse(value)
+}
+
+// validateParamTemplate executes the param template against each sample and returns the first error
+// NOTE: "required" is not enforced, the samples do not have every value
+func validateParamTemplate(tpl *template.Template, samples []paramTemplateSample) (err error) {
+	tpl, err = tpl.Clone()
+	if err != nil {
+		return
+	}
+	tpl.Funcs(template.FuncMap{
+		"required": func(message string, value interface{}) (interface{}, error) { return value, nil },
+	})
+	for _, sample := range samples {
+		err = tpl.Execute(new(strings.Builder), sample.Data)
+		if err != nil {
+			return fmt.Errorf("template fails for %s: %w", sample.Level, err)
+		}
+	}
+	return
+}
+
+// validateParamTemplates validates the template of each param (with a TemplateValue) against the samples,
+// i.e. after the levels (IsFor*) of the PuppetTask, PuppetPlan or JenkinsJob changed
+func validateParamTemplates[P templateParam](params []P, samples []paramTemplateSample) error {
+	for _, param := range params {
+		_, name, templateValue := param.getTemplateInfo()
+		if templateValue == "" {
+			continue
+		}
+		tpl, err := param.GetTemplate()
+		if err == nil {
+			err = validateParamTemplate(tpl, samples)
+		}
+		if err != nil {
+			return fmt.Errorf("param %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// getParamTemplateSamples returns a sample object for each level the params are available on
+// NOTE: Puppet tasks and plans render against the scopes (PatchRunScope, ..., ServerScope with facts),
+// Jenkins jobs render against the objects
+func getParamTemplateSamples(patchRun, application, environment, component, server, puppet bool) (samples []paramTemplateSample) {
+	samples = make([]paramTemplateSample, 0)
+	servers := Servers{sampleServer()}
+	if patchRun {
+		if puppet {
+			samples = append(samples, paramTemplateSample{"PatchRun", &PatchRunScope{PatchRun: samplePatchRun(), Servers: servers}})
+		} else {
+			samples = append(samples, paramTemplateSample{"PatchRun", samplePatchRun()})
+		}
+	}
+	if application {
+		if puppet {
+			samples = append(samples, paramTemplateSample{"Application", &ApplicationScope{Application: sampleApplication(), Servers: servers}})
+		} else {
+			samples = append(samples, paramTemplateSample{"Application", sampleApplication()})
+		}
+	}
+	if environment {
+		if puppet {
+			samples = append(samples, paramTemplateSample{"Environment", &EnvironmentScope{Environment: sampleEnvironment(), Servers: servers}})
+		} else {
+			samples = append(samples, paramTemplateSample{"Environment", sampleEnvironment()})
+		}
+	}
+	if component {
+		samples = append(samples, paramTemplateSample{"Component", &Component{Name: "sample", HealthCheckScript: "/usr/local/bin/healthcheck", Servers: servers, patchRun: samplePatchRun()}})
+	}
+	if server {
+		if puppet {
+			samples = append(samples, paramTemplateSample{"Server", &ServerScope{Server: sampleServer(), Facts: sampleFacts()}})
+		} else {
+			samples = append(samples, paramTemplateSample{"Server", sampleServer()})
+		}
+	}
+	return
+}
+
+// sampleFacts returns sample facts for the ServerScope sample
+func sampleFacts() map[string]interface{} {
+	return map[string]interface{}{
+		"os":            map[string]interface{}{"family": "RedHat", "name": "RedHat", "release": map[string]interface{}{"major": "8", "full": "8.8"}},
+		"kernel":        "Linux",
+		"kernelrelease": "4.18.0",
+		"networking":    map[string]interface{}{"fqdn": "sample.example.com", "ip": "192.0.2.10"},
+		"is_virtual":    true,
+	}
+}
+
+// samplePatchRun returns a sample PatchRun (not saved)
+func samplePatchRun() *PatchRun {
+	start := time.Now().Truncate(time.Hour)
+	return &PatchRun{Name: "sample", StartTime: start, EndTime: start.Add(2 * time.Hour)}
+}
+
+// sampleServer returns a sample Server (not saved)
+func sampleServer() *Server {
+	return &Server{
+		Name:            "sample.example.com",
+		IPAddress:       "192.0.2.10",
+		VMName:          "sample",
+		OperatingSystem: "RedHat",
+		OSVersion:       "8",
+		OSFamily:        "RedHat",
+		PatchWindow:     "sample",
+		PuppetServerID:  1,
+		patchRun:        samplePatchRun(),
+	}
+}
+
+// sampleApplication returns a sample Application (not saved)
+func sampleApplication() *Application {
+	return &Application{Name: "sample", patchRun: samplePatchRun()}
+}
+
+// sampleEnvironment returns a sample Environment (not saved)
+func sampleEnvironment() *Environment {
+	return &Environment{Name: "sample", patchRun: samplePatchRun()}
+}
+
+// filterOSFamily returns the servers with the OS family (case insensitive), i.e. {{ osFamily "windows" .Servers | names }}
+func filterOSFamily(family string, servers Servers) (filtered Servers) {
+	filtered = make(Servers, 0, len(servers))
+	for _, server := range servers {
+		if strings.EqualFold(server.OSFamily, family) {
+			filtered = append(filtered, server)
+		}
+	}
+	return
+}
+
+// filterPuppetServer returns the servers on the PuppetServer (by ID or name), i.e. {{ onPuppetServer "pe-prod" .Servers | names }}
+func filterPuppetServer(puppetServer interface{}, servers Servers) (Servers, error) {
+	var id uint
+	switch ps := puppetServer.(type) {
+	case int:
+		id = uint(ps)
+	case uint:
+		id = ps
+	case string:
+		p := new(PuppetServer)
+		err := GetDB().Where(&PuppetServer{Name: ps}).First(p).Error
+		if err != nil {
+			return nil, fmt.Errorf("puppetServer %q not found", ps)
+		}
+		id = p.ID
+	default:
+		return nil, fmt.Errorf("puppetServer must be an ID or name, not %T", puppetServer)
+	}
+	return servers.OnPuppetServer(id), nil
+}
+
+// GetPatchRun returns the patch run itself, so {{ .GetPatchRun.StartTime }} works on every level
+func (p *PatchRun) GetPatchRun() *PatchRun {
+	return p
+}
+
+// GetPatchRun returns the patch run of the application (i.e. for {{ addTime "-1h" .GetPatchRun.StartTime }}), read once per application
+func (a *Application) GetPatchRun() *PatchRun {
+	if a.patchRun == nil {
+		a.patchRun = getPatchRunForTemplate(a.PatchRunID)
+	}
+	return a.patchRun
+}
+
+// GetPatchRun returns the patch run of the environment (i.e. for {{ addTime "-1h" .GetPatchRun.StartTime }}), read once per environment
+func (e *Environment) GetPatchRun() *PatchRun {
+	if e.patchRun == nil {
+		e.patchRun = getPatchRunForTemplate(e.GetPatchRunID())
+	}
+	return e.patchRun
+}
+
+// GetPatchRun returns the patch run of the component (i.e. for {{ addTime "-1h" .GetPatchRun.StartTime }}), read once per component
+func (c *Component) GetPatchRun() *PatchRun {
+	if c.patchRun == nil {
+		c.patchRun = getPatchRunForTemplate(c.GetPatchRunID())
+	}
+	return c.patchRun
+}
+
+// GetPatchRun returns the patch run of the server (i.e. for {{ addTime "-1h" .GetPatchRun.StartTime }}), read once per server
+func (s *Server) GetPatchRun() *PatchRun {
+	if s.patchRun == nil {
+		s.patchRun = getPatchRunForTemplate(s.GetPatchRunID())
+	}
+	return s.patchRun
+}
+
+// getPatchRunForTemplate returns the patch run by ID (an empty PatchRun if not found)
+func getPatchRunForTemplate(id uint) *PatchRun {
+	patchRun, err := GetPatchRunByID(id)
+	if err != nil {
+		log.WithField("patchRunID", id).Error("Error retrieving patchRun for template: ", err)
+		return &PatchRun{Model: gorm.Model{ID: id}}
+	}
+	return patchRun
+}
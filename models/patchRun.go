@@ -12,12 +12,22 @@ import (
 // PatchRun : PatchRun Type
 type PatchRun struct {
 	gorm.Model
-	Name        string    `json:"name" binding:"required"`
-	Description string    `json:"description"`
-	PatchWindow string    `json:"patch_window" binding:"required"`
-	StartTime   time.Time `binding:"required" time_format:"2006-01-02T15:04"`
-	EndTime     time.Time `binding:"required" time_format:"2006-01-02T15:04"`
-	ChatRooms   ChatRooms `json:"chat_roooms,omitempty" gorm:"many2many:patchrun_ChatRooms;"`
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	NodeSelector
+	StartTime time.Time `binding:"required" time_format:"2006-01-02T15:04"`
+	EndTime   time.Time `binding:"required" time_format:"2006-01-02T15:04"`
+	ChatRooms ChatRooms `json:"chat_roooms,omitempty" gorm:"many2many:patchrun_ChatRooms;"`
+}
+
+// NodeSelector selects the nodes (servers) for a PatchRun from PuppetDB
+// NOTE: Each of the selectors are optional (AND), at least one PatchWindow or a Query is required.
+type NodeSelector struct {
+	PatchWindow       string `json:"patch_window"`       // comma separated list, each is a regex on the PuppetServer FactName (OR)
+	Query             string `json:"query"`              // PQL (returning certname) or AST query on the inventory endpoint
+	OSFamily          string `json:"os_family"`          // comma separated list (OR)
+	PuppetEnvironment string `json:"puppet_environment"` // comma separated list (OR)
+	CertnameFilter    string `json:"certname_filter"`    // comma separated list of globs (OR)
 }
 
 // PatchRuns is a list of PatchRun object pointers
@@ -59,6 +69,10 @@ func (p *PatchRun) Delete(cascade bool) (err error) {
 				return
 			}
 		}
+		err = DeleteFactSnapshots(p.ID)
+		if err != nil {
+			return
+		}
 	}
 	return GetDB().Delete(p).Error
 }
@@ -146,6 +160,24 @@ func (p *PatchRun) GetServers() (servers []string) {
 	return
 }
 
+// GetAllServers returns all servers in the patchrun (including excluded servers)
+func (p *PatchRun) GetAllServers() (servers Servers) {
+	servers = make(Servers, 0)
+	for _, app := range p.GetApplications() {
+		for _, env := range app.GetEnvironments() {
+			for _, component := range env.GetComponents() {
+				servers = append(servers, component.GetServers()...)
+			}
+		}
+	}
+	return
+}
+
+// GetFactSnapshots returns the fact snapshots for the patchrun (and certname, if not blank)
+func (p *PatchRun) GetFactSnapshots(certname string) FactSnapshots {
+	return GetFactSnapshots(p.ID, certname)
+}
+
 // GetServersCommaSeparated returns a list of servers patchrun
 func (p *PatchRun) GetServersCommaSeparated() (servers string) {
 	return strings.Join(p.GetServers(), ",")
@@ -188,6 +220,37 @@ func GetLatestPatchRunID() (id uint, err error) {
 	return
 }
 
+// IsEmpty returns true if there is no PatchWindow or Query to select nodes
+func (s NodeSelector) IsEmpty() bool {
+	return len(s.GetPatchWindows()) == 0 && strings.TrimSpace(s.Query) == ""
+}
+
+// GetPatchWindows returns the list of patch windows (regexes)
+func (s NodeSelector) GetPatchWindows() []string {
+	return splitRegexList(s.PatchWindow)
+}
+
+// GetOSFamilies returns the list of OS families
+func (s NodeSelector) GetOSFamilies() []string {
+	return splitList(s.OSFamily)
+}
+
+// GetPuppetEnvironments returns the list of Puppet environments
+func (s NodeSelector) GetPuppetEnvironments() []string {
+	return splitList(s.PuppetEnvironment)
+}
+
+// GetCertnameFilters returns the list of certname globs
+func (s NodeSelector) GetCertnameFilters() []string {
+	return splitList(s.CertnameFilter)
+}
+
+// IsPQL returns true if the Query is PQL (AST queries are JSON arrays)
+func (s NodeSelector) IsPQL() bool {
+	query := strings.TrimSpace(s.Query)
+	return query != "" && !strings.HasPrefix(query, "[")
+}
+
 // GetBreadCrumbs returns a list of bread crumbs for navigation
 func (p *PatchRun) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
 	breadcrumbs = append(breadcrumbs, PatchRuns{}.GetBreadCrumbs()...) // Patch Run List
@@ -195,6 +258,41 @@ func (p *PatchRun) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
 	return
 }
 
+// GetVerifyBreadCrumbs returns a list of bread crumbs for navigation (verify page)
+func (p *PatchRun) GetVerifyBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, p.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Verify", fmt.Sprintf("/patchRun/%v/verify", p.ID)))
+	return
+}
+
+// GetReadinessBreadCrumbs returns a list of bread crumbs for navigation (readiness page)
+func (p *PatchRun) GetReadinessBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, p.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Readiness", fmt.Sprintf("/patchRun/%v/readiness", p.ID)))
+	return
+}
+
+// GetResultsBreadCrumbs returns a list of bread crumbs for navigation (results page)
+func (p *PatchRun) GetResultsBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, p.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Results", fmt.Sprintf("/patchRun/%v/results", p.ID)))
+	return
+}
+
+// GetSnapshotsBreadCrumbs returns a list of bread crumbs for navigation (fact snapshots page)
+func (p *PatchRun) GetSnapshotsBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, p.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Fact Snapshots", fmt.Sprintf("/patchRun/%v/snapshots", p.ID)))
+	return
+}
+
+// GetPinnedPackagesBreadCrumbs returns a list of bread crumbs for navigation (pinned packages report)
+func (p *PatchRun) GetPinnedPackagesBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, p.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Pinned Packages", fmt.Sprintf("/patchRun/%v/pinnedPackages", p.ID)))
+	return
+}
+
 // GetBreadCrumbs returns a list of bread crumbs for navigation
 func (patchRuns PatchRuns) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
 	breadcrumbs = append(breadcrumbs, GetDefaultBreadCrumbs()...)
@@ -202,6 +300,51 @@ func (patchRuns PatchRuns) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
 	return
 }
 
+// splitList splits a comma (or newline) separated list, removing empty entries
+func splitList(list string) (items []string) {
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// splitRegexList splits a list of regexes, removing empty entries. A list with newlines is only split on newlines,
+// otherwise on the commas that are not part of a regex (i.e. ^wk{1,2}$ or [a,b] are not split)
+func splitRegexList(list string) (items []string) {
+	var parts []string
+	if strings.ContainsAny(list, "\r\n") {
+		parts = strings.FieldsFunc(list, func(r rune) bool { return r == '\n' || r == '\r' })
+	} else {
+		depth, escaped, start := 0, false, 0
+		for i, r := range list {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '(' || r == '[' || r == '{':
+				depth++
+			case (r == ')' || r == ']' || r == '}') && depth > 0:
+				depth--
+			case r == ',' && depth == 0:
+				parts = append(parts, list[start:i])
+				start = i + 1
+			}
+		}
+		parts = append(parts, list[start:])
+	}
+	for _, item := range parts {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
 func generatePatchRunName() (name string) {
 	year, week := time.Now().ISOWeek()
 	name = fmt.Sprintf("Patching: %v-W%v", year, week)
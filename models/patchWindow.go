@@ -0,0 +1,234 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// patchWindowSlotFormat is the format of the PatchWindow StartAt (time of day)
+const patchWindowSlotFormat = "15:04"
+
+// PatchWindow defines a patch window in the catalog (the value of the patch window fact)
+// NOTE: Discovered patch windows (added by sync) are "unknown" until they are saved from the WebUI/API.
+type PatchWindow struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex" binding:"required"` // patch window fact value
+	Label       string
+	Description string
+	Team        string // owning team
+	// Recurring time slot (local time), i.e. the 2nd Saturday of each month at 22:00 for 4 hours
+	Weekday         time.Weekday `binding:"gte=0,lte=6"`
+	WeekOfMonth     uint         `binding:"lte=5"` // 0 is every week
+	StartAt         string       `binding:"omitempty,datetime=15:04"`
+	DurationMinutes uint
+	ChatRooms       ChatRooms `json:"chat_rooms,omitempty" gorm:"many2many:patchwindow_ChatRooms;" form:"-"`
+	// Sync (with patch window fact values)
+	Discovered bool      `form:"-"`
+	NodeCount  int       `form:"-"`
+	LastSeen   time.Time `form:"-"`
+	SyncedAt   time.Time `form:"-"`
+}
+
+// PatchWindows is a list of PatchWindow
+type PatchWindows []*PatchWindow
+
+// NewPatchWindow returns a new PatchWindow object
+func NewPatchWindow() (w *PatchWindow) {
+	w = new(PatchWindow)
+	// Defaults
+	w.Weekday = time.Saturday
+	w.StartAt = "22:00"
+	w.DurationMinutes = 240
+	return
+}
+
+// Init : Create new PatchWindow object in DB
+func (w *PatchWindow) Init() (err error) {
+	return GetDB().Create(w).Error
+}
+
+// Save : Save PatchWindow object
+func (w *PatchWindow) Save() (err error) {
+	return GetDB().Save(w).Error
+}
+
+// Delete : Delete PatchWindow object
+func (w *PatchWindow) Delete(cascade bool) (err error) {
+	err = GetDB().Model(w).Association("ChatRooms").Clear()
+	if err != nil {
+		return
+	}
+	// Permanently delete (Name is unique, so the patch window can be discovered or added again)
+	return GetDB().Unscoped().Delete(w).Error
+}
+
+// LinkChatRooms will replace the default ChatRooms
+func (w *PatchWindow) LinkChatRooms(rooms ChatRooms) (err error) {
+	return GetDB().Model(w).Association("ChatRooms").Replace(rooms)
+}
+
+// IsChatRoomLinked returns true if ChatRoom ID is linked
+func (w *PatchWindow) IsChatRoomLinked(id uint) (linked bool) {
+	for _, room := range w.ChatRooms {
+		if room.ID == id {
+			return true
+		}
+	}
+	return
+}
+
+// GetEnabledChatRooms returns a list of enabled ChatRooms (for the form)
+func (w *PatchWindow) GetEnabledChatRooms() (rooms ChatRooms) {
+	rooms, _ = GetEnabledChatRooms()
+	return
+}
+
+// GetDisplayName returns the Label (or the Name if there is no Label)
+func (w *PatchWindow) GetDisplayName() string {
+	if w.Label != "" {
+		return w.Label
+	}
+	return w.Name
+}
+
+// IsUnknown returns true if the patch window was discovered (by sync) but has not been added to the catalog
+func (w *PatchWindow) IsUnknown() bool {
+	return w.Discovered
+}
+
+// IsUnused returns true if no nodes were found with the patch window (at the last sync)
+func (w *PatchWindow) IsUnused() bool {
+	return !w.SyncedAt.IsZero() && w.NodeCount == 0
+}
+
+// HasSlot returns true if the recurring time slot is set
+func (w *PatchWindow) HasSlot() bool {
+	return w.StartAt != ""
+}
+
+// GetSlotString returns a description of the recurring time slot
+func (w *PatchWindow) GetSlotString() string {
+	if !w.HasSlot() {
+		return ""
+	}
+	duration := fmt.Sprintf("%dh", w.DurationMinutes/60)
+	if w.DurationMinutes%60 != 0 {
+		duration = fmt.Sprintf("%dh%02dm", w.DurationMinutes/60, w.DurationMinutes%60)
+	}
+	if w.WeekOfMonth == 0 {
+		return fmt.Sprintf("Every %s at %s (%s)", w.Weekday, w.StartAt, duration)
+	}
+	return fmt.Sprintf("%s %s of the month at %s (%s)", ordinal(w.WeekOfMonth), w.Weekday, w.StartAt, duration)
+}
+
+// NextOccurrence returns the start and end of the next time slot after the time
+// NOTE: ok is false if there is no time slot
+func (w *PatchWindow) NextOccurrence(after time.Time) (start, end time.Time, ok bool) {
+	if !w.HasSlot() {
+		return
+	}
+	at, err := time.Parse(patchWindowSlotFormat, w.StartAt)
+	if err != nil {
+		return
+	}
+	// NOTE: Not every month has a 5th Saturday, so look up to 16 weeks ahead
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, after.Location())
+	for i := 0; i <= 7*16; i++ {
+		d := day.AddDate(0, 0, i)
+		if d.Weekday() != w.Weekday || (w.WeekOfMonth != 0 && uint((d.Day()-1)/7+1) != w.WeekOfMonth) {
+			continue
+		}
+		start = time.Date(d.Year(), d.Month(), d.Day(), at.Hour(), at.Minute(), 0, 0, d.Location())
+		if start.After(after) {
+			end = start.Add(time.Duration(w.DurationMinutes) * time.Minute)
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// GetPatchWindowByID returns the PatchWindow by ID
+func GetPatchWindowByID(id uint) (w *PatchWindow, err error) {
+	w = new(PatchWindow)
+	err = GetDB().Preload("ChatRooms").First(w, id).Error
+	return
+}
+
+// GetPatchWindowByName returns the PatchWindow by Name (fact value)
+func GetPatchWindowByName(name string) (w *PatchWindow, err error) {
+	w = new(PatchWindow)
+	err = GetDB().Where(&PatchWindow{Name: name}).First(w).Error
+	return
+}
+
+// GetPatchWindows returns a list of all PatchWindows
+func GetPatchWindows() (windows PatchWindows) {
+	windows = make(PatchWindows, 0)
+	GetDB().Preload("ChatRooms").Order("name").Find(&windows)
+	return
+}
+
+// SyncPatchWindows will update the node counts from the discovered patch window fact values (counts)
+// NOTE: Unknown values are added to the catalog (Discovered)
+func SyncPatchWindows(counts map[string]int) (added int, err error) {
+	now := time.Now()
+	found := make(map[string]bool)
+	for _, w := range GetPatchWindows() {
+		found[w.Name] = true
+		w.NodeCount = counts[w.Name]
+		if w.NodeCount > 0 {
+			w.LastSeen = now
+		}
+		w.SyncedAt = now
+		err = GetDB().Model(w).UpdateColumns(map[string]interface{}{
+			"node_count": w.NodeCount,
+			"last_seen":  w.LastSeen,
+			"synced_at":  w.SyncedAt,
+		}).Error
+		if err != nil {
+			return
+		}
+	}
+	for name, count := range counts {
+		if found[name] {
+			continue
+		}
+		w := &PatchWindow{Name: name, Discovered: true, NodeCount: count, LastSeen: now, SyncedAt: now}
+		err = w.Init()
+		if err != nil {
+			return
+		}
+		added++
+	}
+	return
+}
+
+// GetBreadCrumbs returns a list of bread crumbs for navigation
+func (w *PatchWindow) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, PatchWindows{}.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb(fmt.Sprintf("Patch Window: %s", w.Name), fmt.Sprintf("/config/patchWindow/%v", w.ID)))
+	return
+}
+
+// GetBreadCrumbs returns a list of bread crumbs for navigation
+func (windows PatchWindows) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, GetDefaultBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Patch Windows", "/config/patchWindow"))
+	return
+}
+
+// ordinal returns 1st, 2nd, 3rd, 4th, 5th
+func ordinal(n uint) string {
+	switch n {
+	case 1:
+		return "1st"
+	case 2:
+		return "2nd"
+	case 3:
+		return "3rd"
+	default:
+		return fmt.Sprintf("%dth", n)
+	}
+}
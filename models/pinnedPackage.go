@@ -0,0 +1,75 @@
+package models
+
+import (
+	"sort"
+)
+
+// PinnedPackage is a package that is pinned (or blocked) on servers in a patch run
+type PinnedPackage struct {
+	Name    string                 `json:"name"`
+	Blocked bool                   `json:"blocked"` // blocked (true) or pinned (false)
+	Servers []*PinnedPackageServer `json:"servers"`
+}
+
+// PinnedPackageServer is a server where a package is pinned (or blocked)
+type PinnedPackageServer struct {
+	ServerID    uint   `json:"server_id"`
+	Server      string `json:"server"`
+	Application string `json:"application"`
+	Environment string `json:"environment"`
+	ComponentID uint   `json:"component_id"`
+	Component   string `json:"component"`
+	Excluded    bool   `json:"excluded"`
+}
+
+// PinnedPackages is a list of PinnedPackage
+type PinnedPackages []*PinnedPackage
+
+// GetPinnedPackages returns the packages that are pinned (or blocked) on the servers in the patch run, sorted by name
+func (p *PatchRun) GetPinnedPackages() (packages PinnedPackages) {
+	packages = make(PinnedPackages, 0)
+	index := make(map[string]*PinnedPackage)
+	add := func(name string, blocked bool, server *PinnedPackageServer) {
+		key := name
+		if blocked {
+			key = "blocked:" + name
+		}
+		pkg, ok := index[key]
+		if !ok {
+			pkg = &PinnedPackage{Name: name, Blocked: blocked}
+			index[key] = pkg
+			packages = append(packages, pkg)
+		}
+		pkg.Servers = append(pkg.Servers, server)
+	}
+	for _, app := range p.GetApplications() {
+		for _, env := range app.GetEnvironments() {
+			for _, component := range env.GetComponents() {
+				for _, server := range component.GetServers() {
+					pps := &PinnedPackageServer{
+						ServerID:    server.ID,
+						Server:      server.Name,
+						Application: app.Name,
+						Environment: env.Name,
+						ComponentID: component.ID,
+						Component:   component.Name,
+						Excluded:    server.Excluded,
+					}
+					for _, name := range server.PinnedPackages {
+						add(name, false, pps)
+					}
+					for _, name := range server.BlockedPackages {
+						add(name, true, pps)
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return !packages[i].Blocked && packages[j].Blocked
+	})
+	return
+}
@@ -2,23 +2,36 @@ package models
 
 import (
 	"gorm.io/gorm"
+
+	"github.com/tjm/puppet-patching-automation/functions"
 )
 
+// PuppetJobStatusDryRun is the status of a dry run job that was not sent to the orchestrator
+const PuppetJobStatusDryRun = "dry-run"
+
+// SensitiveMask replaces the value of a sensitive param (i.e. in the preview and the recorded job)
+const SensitiveMask = "********"
+
 // PuppetJob defines a Puppet Job - A Puppet Job is what is created when a puppet deploy, task, task_plan, etc is "run"
 type PuppetJob struct {
 	gorm.Model
 	Name             string
 	Status           string
-	ConsoleURL       string        // Puppet Console Link (manually generated)
-	APIJobID         string        // Orchestrator Job ID (Remote)
-	APIJobURL        string        // Orchestrator Job ID Link
-	InitiatorID      uint          // Patching Automation Initiator ID
-	InitiatorType    string        // Patching Automation Initator Type
-	PuppetTaskID     uint          // Parent Puppet Task ID
-	PuppetServerID   uint          // Parent Puppet Server ID
-	PuppetParentID   uint          // Puppet Parent ID
-	PuppetParentType string        // Puppet Parent Type (deploy, task or task_plan)
-	PuppetServer     *PuppetServer `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Puppet Server
+	ConsoleURL       string                 // Puppet Console Link (manually generated)
+	APIJobID         string                 // Orchestrator Job ID (Remote)
+	APIJobURL        string                 // Orchestrator Job ID Link
+	InitiatorID      uint                   // Patching Automation Initiator ID
+	InitiatorType    string                 // Patching Automation Initator Type
+	PuppetTaskID     uint                   // Parent Puppet Task ID
+	PuppetServerID   uint                   // Parent Puppet Server ID
+	PuppetParentID   uint                   // Puppet Parent ID
+	PuppetParentType string                 // Puppet Parent Type (deploy, task or task_plan)
+	Environment      string                 // Puppet (code) Environment
+	Nodes            []string               `gorm:"serializer:json"`
+	Params           map[string]interface{} `gorm:"serializer:json"`
+	DryRun           bool                   // Dry run (see Noop)
+	Noop             bool                   // Sent to the orchestrator in noop mode (task supports noop)
+	PuppetServer     *PuppetServer          `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Puppet Server
 	// PuppetParent     interface{}   `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Puppet Object
 }
 
@@ -54,9 +67,37 @@ func GetPuppetJobByID(id uint) (j *PuppetJob, err error) {
 	return
 }
 
+// IsRecordedOnly returns true if the job is a dry run that was not sent to the orchestrator
+func (j *PuppetJob) IsRecordedOnly() bool {
+	return j.DryRun && !j.Noop
+}
+
+// GetPuppetServerName returns the name of the (target) PuppetServer
+func (j *PuppetJob) GetPuppetServerName() string {
+	p, err := GetPuppetServerByID(j.PuppetServerID)
+	if err != nil {
+		return ""
+	}
+	return p.Name
+}
+
 // GetPuppetJobs returns a list of all PuppetJobs
 func GetPuppetJobs() (jobs []*PuppetJob) {
 	jobs = make([]*PuppetJob, 0)
 	GetDB().Preload("PuppetServer").Order("name").Find(&jobs)
 	return
 }
+
+// MaskSensitiveParams returns a copy of the params with the (non-empty) values of the sensitive params masked
+func MaskSensitiveParams[V any](params map[string]V, sensitive []string, mask V) map[string]V {
+	masked := make(map[string]V, len(params))
+	for k, v := range params {
+		masked[k] = v
+	}
+	for _, name := range sensitive {
+		if v, ok := masked[name]; ok && !functions.IsEmpty(v) {
+			masked[name] = mask
+		}
+	}
+	return masked
+}
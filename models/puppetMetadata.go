@@ -0,0 +1,434 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// DefaultPuppetEnvironment is the (code) environment of a task/plan without one (i.e. created before environments)
+const DefaultPuppetEnvironment = "production"
+
+// PuppetMetadata is the metadata of a PuppetTask or PuppetPlan on a PuppetServer for a (code) environment
+// NOTE: The same task/plan can differ between PuppetServers and environments, the params (templates) are
+// shared, the metadata is used to convert and check the params at launch.
+type PuppetMetadata struct {
+	gorm.Model
+	PuppetParentType string `gorm:"index:idx_puppet_metadata"` // Task or Plan
+	PuppetParentID   uint   `gorm:"index:idx_puppet_metadata"` // PuppetTask.ID or PuppetPlan.ID
+	PuppetServerID   uint   `gorm:"index:idx_puppet_metadata"`
+	Environment      string `gorm:"index:idx_puppet_metadata"`
+	Description      string
+	SupportsNoop     bool                            // tasks only
+	Params           map[string]*PuppetParamMetadata `gorm:"serializer:json"`
+	SyncedAt         time.Time
+	SyncError        string        // last sync error (i.e. the task does not exist in the environment)
+	PuppetServer     *PuppetServer `json:"-" yaml:"-" xml:"-" form:"-"` // Parent Puppet Server
+}
+
+// PuppetParamMetadata is the metadata of a task/plan param
+type PuppetParamMetadata struct {
+	Type         string
+	Description  string
+	DefaultValue string
+	IsRequired   bool
+	IsSensitive  bool
+}
+
+// Equal returns true if the param metadata is the same (except the description)
+func (m *PuppetParamMetadata) Equal(other *PuppetParamMetadata) bool {
+	if m == nil || other == nil {
+		return m == other
+	}
+	return m.Type == other.Type && m.DefaultValue == other.DefaultValue && m.IsRequired == other.IsRequired && m.IsSensitive == other.IsSensitive
+}
+
+// String returns a short summary of the param metadata, i.e. Integer = 3 (required, sensitive)
+func (m *PuppetParamMetadata) String() string {
+	if m == nil {
+		return "(missing)"
+	}
+	s := m.Type
+	if s == "" {
+		s = "Any"
+	}
+	if m.DefaultValue != "" {
+		s += " = " + m.DefaultValue
+	}
+	flags := make([]string, 0)
+	if m.IsRequired {
+		flags = append(flags, "required")
+	}
+	if m.IsSensitive {
+		flags = append(flags, "sensitive")
+	}
+	if len(flags) > 0 {
+		s += " (" + strings.Join(flags, ", ") + ")"
+	}
+	return s
+}
+
+// Save : Save PuppetMetadata object
+func (m *PuppetMetadata) Save() error {
+	return GetDB().Save(m).Error
+}
+
+// GetName returns the PuppetServer and environment, i.e. pe-prod (production)
+func (m *PuppetMetadata) GetName() string {
+	name := fmt.Sprintf("PuppetServer %v", m.PuppetServerID)
+	if m.PuppetServer != nil {
+		name = m.PuppetServer.Name
+	}
+	return fmt.Sprintf("%s (%s)", name, m.Environment)
+}
+
+// GetMissingParams returns the names of the required params without a value (sorted by name)
+func (m *PuppetMetadata) GetMissingParams(params map[string]string) (missing []string) {
+	missing = make([]string, 0)
+	for name, param := range m.Params {
+		if param.IsRequired && strings.TrimSpace(params[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return
+}
+
+// GetSensitiveParamNames returns the names of the sensitive params (nil safe)
+func (m *PuppetMetadata) GetSensitiveParamNames() (names []string) {
+	names = make([]string, 0)
+	if m == nil {
+		return
+	}
+	for name, param := range m.Params {
+		if param.IsSensitive {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// RemoveUnknownParams removes the params that are not in the task/plan on the PuppetServer for the environment,
+// i.e. the template values of params that only exist on another PuppetServer (nil safe)
+func (m *PuppetMetadata) RemoveUnknownParams(params map[string]string) {
+	if m == nil {
+		return
+	}
+	for name := range params {
+		if _, ok := m.Params[name]; !ok {
+			delete(params, name)
+		}
+	}
+}
+
+// GetPuppetMetadata returns the metadata of the task/plan on the PuppetServer for the environment (nil if not synced)
+func GetPuppetMetadata(parentType string, parentID uint, puppetServerID uint, env string) *PuppetMetadata {
+	m := new(PuppetMetadata)
+	err := wherePuppetMetadata(parentType, parentID, puppetServerID, env).First(m).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error("Error retrieving PuppetMetadata: ", err)
+		}
+		return nil
+	}
+	if m.SyncError != "" {
+		return nil // not usable, i.e. the task does not exist in the environment
+	}
+	return m
+}
+
+// wherePuppetMetadata returns the condition for the metadata of the task/plan on the PuppetServer for the environment
+// NOTE: Explicit conditions, a struct condition would ignore zero values (i.e. match any environment)
+func wherePuppetMetadata(parentType string, parentID uint, puppetServerID uint, env string) *gorm.DB {
+	return GetDB().Where("puppet_parent_type = ? AND puppet_parent_id = ? AND puppet_server_id = ? AND environment = ?",
+		parentType, parentID, puppetServerID, env)
+}
+
+// SetPuppetMetadata creates or updates the metadata of the task/plan on the PuppetServer for the environment
+func SetPuppetMetadata(m *PuppetMetadata) (err error) {
+	if m.PuppetParentID == 0 || m.PuppetServerID == 0 || m.Environment == "" {
+		return fmt.Errorf("puppet metadata requires the %s, PuppetServer and environment", m.PuppetParentType)
+	}
+	existing := new(PuppetMetadata)
+	err = wherePuppetMetadata(m.PuppetParentType, m.PuppetParentID, m.PuppetServerID, m.Environment).FirstOrInit(existing).Error
+	if err != nil {
+		return
+	}
+	m.ID = existing.ID
+	m.CreatedAt = existing.CreatedAt
+	m.SyncedAt = time.Now()
+	return m.Save()
+}
+
+// getPuppetMetadataList returns the metadata of the task/plan, sorted by PuppetServer and environment
+func getPuppetMetadataList(parentType string, parentID uint) (list []*PuppetMetadata) {
+	list = make([]*PuppetMetadata, 0)
+	err := GetDB().Where("puppet_parent_type = ? AND puppet_parent_id = ?", parentType, parentID).Preload("PuppetServer").Find(&list).Error
+	if err != nil {
+		log.Error("Error retrieving PuppetMetadata: ", err)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].GetName() == list[j].GetName() {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].GetName() < list[j].GetName()
+	})
+	return
+}
+
+// getPuppetMetadataEnvironments returns the environments synced (without errors) for the task/plan on the PuppetServer (sorted)
+// NOTE: The default environment (def) is always included
+func getPuppetMetadataEnvironments(parentType string, parentID uint, puppetServerID uint, def string) (envs []string) {
+	found := map[string]bool{def: true}
+	envs = []string{def}
+	for _, m := range getPuppetMetadataList(parentType, parentID) {
+		if m.SyncError != "" || (puppetServerID != 0 && m.PuppetServerID != puppetServerID) {
+			continue
+		}
+		if !found[m.Environment] {
+			found[m.Environment] = true
+			envs = append(envs, m.Environment)
+		}
+	}
+	sort.Strings(envs)
+	return
+}
+
+// getPuppetMetadataParams returns the params of the task/plan on any PuppetServer and environment (synced without errors)
+// NOTE: A param that differs between them is returned as first found (sorted by PuppetServer and environment)
+func getPuppetMetadataParams(parentType string, parentID uint) (params map[string]*PuppetParamMetadata) {
+	params = make(map[string]*PuppetParamMetadata)
+	for _, m := range getPuppetMetadataList(parentType, parentID) {
+		if m.SyncError != "" {
+			continue
+		}
+		for name, param := range m.Params {
+			if _, ok := params[name]; !ok {
+				params[name] = param
+			}
+		}
+	}
+	return
+}
+
+// getParamNames returns the names of the params in the metadata, sorted
+func (m *PuppetMetadata) getParamNames() (names []string) {
+	names = make([]string, 0, len(m.Params))
+	for name := range m.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// deletePuppetMetadata deletes the metadata of a task/plan
+func deletePuppetMetadata(parentType string, parentID uint) error {
+	return GetDB().Where("puppet_parent_type = ? AND puppet_parent_id = ?", parentType, parentID).Delete(&PuppetMetadata{}).Error
+}
+
+// PuppetMetadataDiff compares the param metadata of a task/plan across PuppetServers and environments
+type PuppetMetadataDiff struct {
+	Metadata []*PuppetMetadata // columns (PuppetServer and environment)
+	Params   []*PuppetParamDiff
+}
+
+// PuppetParamDiff is a param in the PuppetMetadataDiff
+type PuppetParamDiff struct {
+	Name     string
+	Values   []*PuppetParamMetadata // per Metadata column, nil if the param is missing
+	Mismatch bool
+}
+
+// HasMismatch returns true if any param differs between the PuppetServers and environments
+func (d *PuppetMetadataDiff) HasMismatch() bool {
+	for _, p := range d.Params {
+		if p.Mismatch {
+			return true
+		}
+	}
+	return false
+}
+
+// getPuppetMetadataDiff returns the param metadata of the task/plan per PuppetServer and environment
+// NOTE: Metadata with a sync error (not found) is listed, but not compared
+func getPuppetMetadataDiff(parentType string, parentID uint) (diff *PuppetMetadataDiff) {
+	diff = &PuppetMetadataDiff{Metadata: getPuppetMetadataList(parentType, parentID), Params: make([]*PuppetParamDiff, 0)}
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, m := range diff.Metadata {
+		for name := range m.Params {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := &PuppetParamDiff{Name: name, Values: make([]*PuppetParamMetadata, len(diff.Metadata))}
+		var first *PuppetParamMetadata
+		compared := false
+		for i, m := range diff.Metadata {
+			p.Values[i] = m.Params[name]
+			if m.SyncError != "" {
+				continue
+			}
+			if !compared {
+				first, compared = p.Values[i], true
+			} else if !first.Equal(p.Values[i]) {
+				p.Mismatch = true
+			}
+		}
+		diff.Params = append(diff.Params, p)
+	}
+	return
+}
+
+// GetMetadata returns the metadata of the task on the PuppetServer for the environment (nil if not synced)
+func (t *PuppetTask) GetMetadata(puppetServerID uint, env string) *PuppetMetadata {
+	return GetPuppetMetadata("Task", t.ID, puppetServerID, env)
+}
+
+// GetMetadataDiff returns the param metadata of the task per PuppetServer and environment
+func (t *PuppetTask) GetMetadataDiff() *PuppetMetadataDiff {
+	return getPuppetMetadataDiff("Task", t.ID)
+}
+
+// GetMetadataParams returns the params of the task on any PuppetServer and environment (synced)
+func (t *PuppetTask) GetMetadataParams() map[string]*PuppetParamMetadata {
+	return getPuppetMetadataParams("Task", t.ID)
+}
+
+// GetParamsFor returns the task params as on the PuppetServer for the environment (i.e. for the preview), with the
+// type, default, required-ness and sensitivity from the metadata. The params that are not in the task there are flagged
+// (IsNotInTask), the params only there are added (not saved). Without metadata (not synced) the task params are returned.
+func (t *PuppetTask) GetParamsFor(puppetServerID uint, env string) (params []*PuppetTaskParam) {
+	params, err := t.GetParams()
+	if err != nil {
+		log.Error("Error retrieving puppetTask params: ", err)
+		params = make([]*PuppetTaskParam, 0)
+	}
+	metadata := t.GetMetadata(puppetServerID, env)
+	if metadata == nil {
+		return
+	}
+	found := make(map[string]bool, len(params))
+	for _, param := range params {
+		found[param.Name] = true
+		m, ok := metadata.Params[param.Name]
+		param.IsNotInTask = !ok
+		if ok {
+			param.Type, param.DefaultValue, param.IsRequired, param.IsSensitive = m.Type, m.DefaultValue, m.IsRequired, m.IsSensitive
+		}
+	}
+	for _, name := range metadata.getParamNames() {
+		if !found[name] {
+			m := metadata.Params[name]
+			params = append(params, &PuppetTaskParam{Name: name, Type: m.Type, Description: m.Description, DefaultValue: m.DefaultValue,
+				IsRequired: m.IsRequired, IsSensitive: m.IsSensitive, PuppetTaskID: t.ID})
+		}
+	}
+	return
+}
+
+// GetEnvironments returns the (code) environments synced for the task on the PuppetServer (0 for all)
+func (t *PuppetTask) GetEnvironments(puppetServerID uint) []string {
+	return getPuppetMetadataEnvironments("Task", t.ID, puppetServerID, t.GetEnvironment())
+}
+
+// GetEnvironment returns the default (code) environment of the task
+func (t *PuppetTask) GetEnvironment() string {
+	if t.Environment == "" {
+		return DefaultPuppetEnvironment
+	}
+	return t.Environment
+}
+
+// GetMetadataBreadCrumbs returns a list of bread crumbs for navigation (metadata page)
+func (t *PuppetTask) GetMetadataBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, t.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Metadata", fmt.Sprintf("/config/puppetTask/%v/metadata", t.ID)))
+	return
+}
+
+// GetMetadata returns the metadata of the plan on the PuppetServer for the environment (nil if not synced)
+func (p *PuppetPlan) GetMetadata(puppetServerID uint, env string) *PuppetMetadata {
+	return GetPuppetMetadata("Plan", p.ID, puppetServerID, env)
+}
+
+// GetMetadataDiff returns the param metadata of the plan per PuppetServer and environment
+func (p *PuppetPlan) GetMetadataDiff() *PuppetMetadataDiff {
+	return getPuppetMetadataDiff("Plan", p.ID)
+}
+
+// GetMetadataParams returns the params of the plan on any PuppetServer and environment (synced)
+func (p *PuppetPlan) GetMetadataParams() map[string]*PuppetParamMetadata {
+	return getPuppetMetadataParams("Plan", p.ID)
+}
+
+// GetParamsFor returns the plan params as on the PuppetServer for the environment (i.e. for the preview), with the
+// type, default, required-ness and sensitivity from the metadata. The params that are not in the plan there are flagged
+// (IsNotInPlan), the params only there are added (not saved). Without metadata (not synced) the plan params are returned.
+func (p *PuppetPlan) GetParamsFor(puppetServerID uint, env string) (params []*PuppetPlanParam) {
+	params, err := p.GetParams()
+	if err != nil {
+		log.Error("Error retrieving puppetPlan params: ", err)
+		params = make([]*PuppetPlanParam, 0)
+	}
+	metadata := p.GetMetadata(puppetServerID, env)
+	if metadata == nil {
+		return
+	}
+	found := make(map[string]bool, len(params))
+	for _, param := range params {
+		found[param.Name] = true
+		m, ok := metadata.Params[param.Name]
+		param.IsNotInPlan = !ok
+		if ok {
+			param.Type, param.DefaultValue, param.IsRequired, param.IsSensitive = m.Type, m.DefaultValue, m.IsRequired, m.IsSensitive
+		}
+	}
+	for _, name := range metadata.getParamNames() {
+		if !found[name] {
+			m := metadata.Params[name]
+			params = append(params, &PuppetPlanParam{Name: name, Type: m.Type, Description: m.Description, DefaultValue: m.DefaultValue,
+				IsRequired: m.IsRequired, IsSensitive: m.IsSensitive, PuppetPlanID: p.ID})
+		}
+	}
+	return
+}
+
+// GetEnvironments returns the (code) environments synced for the plan on the PuppetServer (0 for all)
+func (p *PuppetPlan) GetEnvironments(puppetServerID uint) []string {
+	return getPuppetMetadataEnvironments("Plan", p.ID, puppetServerID, p.GetEnvironment())
+}
+
+// GetEnvironment returns the default (code) environment of the plan
+func (p *PuppetPlan) GetEnvironment() string {
+	if p.Environment == "" {
+		return DefaultPuppetEnvironment
+	}
+	return p.Environment
+}
+
+// GetMetadataBreadCrumbs returns a list of bread crumbs for navigation (metadata page)
+func (p *PuppetPlan) GetMetadataBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, p.GetBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Metadata", fmt.Sprintf("/config/puppetPlan/%v/metadata", p.ID)))
+	return
+}
+
+// whereEnvironment returns the (name and) environment condition of a task/plan
+// NOTE: An empty environment is the DefaultPuppetEnvironment (see GetEnvironment), the exact environment is preferred (order)
+func whereEnvironment(tx *gorm.DB, name, env string) *gorm.DB {
+	if env == "" {
+		env = DefaultPuppetEnvironment
+	}
+	return tx.Where("name = ? AND (environment = ? OR (environment = '' AND ? = ?))", name, env, env, DefaultPuppetEnvironment).
+		Order("environment DESC")
+}
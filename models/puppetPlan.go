@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -17,8 +19,10 @@ type PuppetPlan struct {
 	Enabled          bool
 	IsForPatchRun    bool
 	IsForApplication bool
+	IsForEnvironment bool
 	IsForComponent   bool
 	IsForServer      bool
+	IsNotOnServer    bool               `form:"-"`                                                               // Flags plans removed from (one of) the PuppetServers (catalog sync)
 	PuppetServers    *[]PuppetServer    `gorm:"many2many:puppetserver_plans" json:"-" yaml:"-" xml:"-" form:"-"` // Parent Puppet Server(s)
 	Params           []*PuppetPlanParam `json:"-" yaml:"-" xml:"-" form:"-"`                                     // Params are owned by a PuppetPlan
 }
@@ -45,6 +49,20 @@ func (p *PuppetPlan) Save() error {
 	return GetDB().Save(p).Error
 }
 
+// SaveFromAPI saves the fields updated from the API (a new plan is created), so concurrent edits are kept
+func (p *PuppetPlan) SaveFromAPI() error {
+	if p.ID == 0 {
+		return p.Save()
+	}
+	return GetDB().Model(p).Select("Description", "APIPlanID").Updates(p).Error
+}
+
+// SetNotOnServer saves the IsNotOnServer flag (catalog sync)
+func (p *PuppetPlan) SetNotOnServer(notOnServer bool) error {
+	p.IsNotOnServer = notOnServer
+	return GetDB().Model(p).Update("IsNotOnServer", notOnServer).Error
+}
+
 // Delete : Delete PatchRun object
 func (p *PuppetPlan) Delete(cascade bool) (err error) {
 	if cascade {
@@ -60,8 +78,18 @@ func (p *PuppetPlan) Delete(cascade bool) (err error) {
 				return
 			}
 		}
+		err = deletePuppetMetadata("Plan", p.ID)
+		if err != nil {
+			log.Error("Error DELETING metadata: ", err)
+			return
+		}
 		// TODO: Should we delete PuppetPlanJob(s) ... currently not doing it
 	}
+	err = clearPlanBindings(p.ID) // the actions fall back to the built-in default
+	if err != nil {
+		log.Error("Error CLEARING the patching actions: ", err)
+		return
+	}
 	return GetDB().Delete(p).Error // TODO: Catch Error on delete from DB
 }
 
@@ -103,6 +131,65 @@ func (p *PuppetPlan) GetParamByName(paramName string) (param *PuppetPlanParam, e
 	return
 }
 
+// IsFor returns true if the PuppetPlan is available on the level (PatchRun, Application, Environment, Component or Server)
+func (p *PuppetPlan) IsFor(level string) bool {
+	return isForLevel(level, p.IsForPatchRun, p.IsForApplication, p.IsForEnvironment, p.IsForComponent, p.IsForServer)
+}
+
+// ValidateParamTemplates validates the param templates against a sample object
+// for each level (PatchRun, Application, ...) the puppet plan is available on (the IsFor* fields, not saved yet)
+func (p *PuppetPlan) ValidateParamTemplates() error {
+	params, err := p.GetParams()
+	if err != nil {
+		return err
+	}
+	return validateParamTemplates(params, getParamTemplateSamples(p.IsForPatchRun, p.IsForApplication, p.IsForEnvironment, p.IsForComponent, p.IsForServer, true))
+}
+
+// GetParamValues will execute the param templates (with data, i.e. a Component or Server) and return the param values
+// NOTE: Params without a TemplateValue are empty (the orchestrator applies the default), template errors are returned (with the param name)
+func (p *PuppetPlan) GetParamValues(data interface{}) (params map[string]string, err error) {
+	planParams, err := p.GetParams()
+	if err != nil {
+		log.Error("Error retrieving puppetPlan params: ", err)
+		return
+	}
+	return getParamValues(p.Name, planParams, data, false)
+}
+
+// GetMissingParams returns the names of the required params without a value (sorted by name)
+func (p *PuppetPlan) GetMissingParams(params map[string]string) (missing []string) {
+	missing = make([]string, 0)
+	planParams, err := p.GetParams()
+	if err != nil {
+		log.Error("Error retrieving planParams: ", err)
+		return
+	}
+	for _, planParam := range planParams {
+		if planParam.IsRequired && !planParam.IsNotInPlan && strings.TrimSpace(params[planParam.Name]) == "" {
+			missing = append(missing, planParam.Name)
+		}
+	}
+	sort.Strings(missing)
+	return
+}
+
+// GetSensitiveParamNames returns the names of the sensitive params
+func (p *PuppetPlan) GetSensitiveParamNames() (names []string) {
+	names = make([]string, 0)
+	planParams, err := p.GetParams()
+	if err != nil {
+		log.Error("Error retrieving planParams: ", err)
+		return
+	}
+	for _, planParam := range planParams {
+		if planParam.IsSensitive {
+			names = append(names, planParam.Name)
+		}
+	}
+	return
+}
+
 // Param : Return a PuppetPlanParam object by name (create if not exist)
 func (p *PuppetPlan) Param(name string) (param *PuppetPlanParam) {
 	param = new(PuppetPlanParam)
@@ -129,6 +216,14 @@ func IsEnabledPuppetPlans() (enabled bool) {
 	return count > 0
 }
 
+// GetPuppetPlanByName returns the PuppetPlan by name and environment (ID is 0 if not found)
+// NOTE: A plan without an environment is in the DefaultPuppetEnvironment
+func GetPuppetPlanByName(name, env string) (p *PuppetPlan, err error) {
+	p = new(PuppetPlan)
+	err = whereEnvironment(GetDB().Preload("Params"), name, env).Limit(1).Find(p).Error
+	return
+}
+
 // GetPuppetPlans returns a list of all PuppetPlans
 func GetPuppetPlans() (servers PuppetPlans) {
 	servers = make(PuppetPlans, 0)
@@ -6,8 +6,6 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
-
-	"github.com/tjm/puppet-patching-automation/functions"
 )
 
 // PuppetPlanParam defines PuppetPlanParamParams
@@ -17,6 +15,9 @@ type PuppetPlanParam struct {
 	Type          string
 	Description   string
 	TemplateValue string
+	DefaultValue  string             `form:"-"` // from the plan metadata (JSON for non-string values), applied by the orchestrator
+	IsRequired    bool               `form:"-"` // no default value and not Optional, the launch is blocked without a value
+	IsSensitive   bool               `form:"-"` // from the plan metadata, masked in the preview and the recorded jobs
 	IsNotInPlan   bool               // Finds old parameters
 	template      *template.Template `gorm:"-" binding:"-" form:"-"`
 	PuppetPlanID  uint               `form:"-"`                           // Parent PuppetPlan ID
@@ -48,6 +49,14 @@ func (p *PuppetPlanParam) Save() error {
 	return GetDB().Save(p).Error
 }
 
+// SaveFromAPI saves the fields updated from the API (not the TemplateValue), so concurrent edits are kept
+func (p *PuppetPlanParam) SaveFromAPI() error {
+	if p.ID == 0 {
+		return p.Save()
+	}
+	return GetDB().Model(p).Select("Type", "Description", "DefaultValue", "IsRequired", "IsSensitive", "IsNotInPlan").Updates(p).Error
+}
+
 // Delete : Delete PatchRun object
 func (p *PuppetPlanParam) Delete(cascade bool) (err error) {
 	// if cascade {
@@ -57,6 +66,11 @@ func (p *PuppetPlanParam) Delete(cascade bool) (err error) {
 	return GetDB().Delete(p).Error
 }
 
+// getTemplateInfo returns the ID, Name and TemplateValue of the param (templateParam)
+func (p *PuppetPlanParam) getTemplateInfo() (uint, string, string) {
+	return p.ID, p.Name, p.TemplateValue
+}
+
 // GetTemplate : Returns Template for Param
 func (p *PuppetPlanParam) GetTemplate() (tpl *template.Template, err error) {
 	if p.template == nil {
@@ -68,29 +82,29 @@ func (p *PuppetPlanParam) GetTemplate() (tpl *template.Template, err error) {
 	return p.template, nil
 }
 
-// GetDefaultValue will get the appropriate Default value based on the type
-// TODO: See if there is a way to get the default value from Puppet API, for now returns ""
+// GetDefaultValue will get the default value from the plan metadata ("" if there is none)
 func (p *PuppetPlanParam) GetDefaultValue() (value string, err error) {
-	// switch p.Type {
-	// case "":
-	// 	err = errors.New("type must be set before trying to get a default value")
-	// case "BooleanParameterDefinition":
-	// 	value = strconv.FormatBool(p.DefaultBool)
-	// case "StringParameterDefinition", "ChoiceParameterDefinition", "TextParameterDefinition":
-	// 	value = p.DefaultString
-	// default:
-	// 	err = errors.New("Unable to handle parameter type: " + p.Type)
-	// }
-	return
+	return p.DefaultValue, nil
+}
+
+// ValidateTemplate parses the template and executes it against a sample object
+// for each level (PatchRun, Application, ...) the puppet plan is available on
+func (p *PuppetPlanParam) ValidateTemplate() error {
+	err := p.buildTemplate()
+	if err != nil {
+		return err
+	}
+	plan, err := GetPuppetPlanByID(p.PuppetPlanID)
+	if err != nil {
+		return err
+	}
+	return validateParamTemplate(p.template, getParamTemplateSamples(plan.IsForPatchRun, plan.IsForApplication, plan.IsForEnvironment, plan.IsForComponent, plan.IsForServer, true))
 }
 
 // buildTemplate : Builds Template
 func (p *PuppetPlanParam) buildTemplate() (err error) {
 	templateName := fmt.Sprintf("PuppetPlanParamID-%v", p.ID) // I am not even sure where this us used.
-	tpl, err := template.New(templateName).Funcs(template.FuncMap{
-		"FormatAsDateTimeLocal": functions.FormatAsDateTimeLocal,
-		"FormatAsISO8601":       functions.FormatAsISO8601,
-	}).Parse(p.TemplateValue)
+	tpl, err := parseParamTemplate(templateName, p.TemplateValue)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"ID":        p.ID,
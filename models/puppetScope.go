@@ -0,0 +1,213 @@
+package models
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PuppetActions are the puppet tasks and plans (and their jobs) available on a PuppetServer
+// for a PatchRun, Application, Environment or Server
+type PuppetActions struct {
+	Path         string // path of the object, i.e. /application/1
+	Single       bool   // the object is on a single PuppetServer (Server), the run path has no puppetServerID
+	PuppetServer *PuppetServer
+	Tasks        PuppetTasks
+	Plans        PuppetPlans
+	TaskJobs     []*PuppetJob
+	PlanJobs     []*PuppetJob
+}
+
+// GetRunURL returns the URL to preview (GET) or run (POST) the Task or Plan (kind) with the ID
+func (a *PuppetActions) GetRunURL(kind string, id uint) string {
+	if a.Single {
+		return fmt.Sprintf("%s/runPuppet%s/%v", a.Path, kind, id)
+	}
+	return fmt.Sprintf("%s/runPuppet%s/%v/%v", a.Path, kind, a.PuppetServer.ID, id)
+}
+
+// ServerScope is a Server with its facts (from PuppetDB)
+// NOTE: The Server is embedded, so the param templates of a PuppetTask/PuppetPlan render against it,
+// i.e. {{ .Name }}, {{ .IPAddress }}, {{ .VMName }} or {{ index .Facts "os" }}
+type ServerScope struct {
+	*Server
+	Facts map[string]interface{}
+}
+
+// PatchRunScope is a PatchRun limited to the servers on a PuppetServer
+// NOTE: The PatchRun is embedded, so the param templates of a PuppetTask/PuppetPlan render against it, i.e. {{ .Name }}
+type PatchRunScope struct {
+	*PatchRun
+	Servers Servers // included servers on the PuppetServer
+}
+
+// ApplicationScope is an Application limited to the servers on a PuppetServer
+// NOTE: The Application is embedded, so the param templates of a PuppetTask/PuppetPlan render against it, i.e. {{ .Name }}
+type ApplicationScope struct {
+	*Application
+	Servers Servers // included servers on the PuppetServer
+}
+
+// EnvironmentScope is an Environment limited to the servers on a PuppetServer
+// NOTE: The Environment is embedded, so the param templates of a PuppetTask/PuppetPlan render against it, i.e. {{ .Name }}
+type EnvironmentScope struct {
+	*Environment
+	Servers Servers // included servers on the PuppetServer
+}
+
+// GetServerList returns the names of the servers in scope (targets), sorted
+func (s *PatchRunScope) GetServerList() []string {
+	return s.Servers.GetNames()
+}
+
+// GetServerList returns the names of the servers in scope (targets), sorted
+func (s *ApplicationScope) GetServerList() []string {
+	return s.Servers.GetNames()
+}
+
+// GetServerList returns the names of the servers in scope (targets), sorted
+func (s *EnvironmentScope) GetServerList() []string {
+	return s.Servers.GetNames()
+}
+
+// OnPuppetServer returns the PatchRun limited to the (included) servers on the PuppetServer
+func (p *PatchRun) OnPuppetServer(puppetServerID uint) *PatchRunScope {
+	return &PatchRunScope{PatchRun: p, Servers: p.GetAllServers().OnPuppetServer(puppetServerID).GetIncluded()}
+}
+
+// OnPuppetServer returns the Application limited to the (included) servers on the PuppetServer
+func (a *Application) OnPuppetServer(puppetServerID uint) *ApplicationScope {
+	return &ApplicationScope{Application: a, Servers: a.GetAllServers().OnPuppetServer(puppetServerID).GetIncluded()}
+}
+
+// OnPuppetServer returns the Environment limited to the (included) servers on the PuppetServer
+func (e *Environment) OnPuppetServer(puppetServerID uint) *EnvironmentScope {
+	return &EnvironmentScope{Environment: e, Servers: e.GetAllServers().OnPuppetServer(puppetServerID).GetIncluded()}
+}
+
+// GetAllServers returns all servers in the application (including excluded servers)
+func (a *Application) GetAllServers() (servers Servers) {
+	servers = make(Servers, 0)
+	for _, env := range a.GetEnvironments() {
+		servers = append(servers, env.GetAllServers()...)
+	}
+	return
+}
+
+// GetAllServers returns all servers in the environment (including excluded servers)
+func (e *Environment) GetAllServers() (servers Servers) {
+	servers = make(Servers, 0)
+	for _, component := range e.GetComponents() {
+		servers = append(servers, component.GetServers()...)
+	}
+	return
+}
+
+// GetServerList returns the names of the servers in the patch run (not excluded from patching), sorted
+func (p *PatchRun) GetServerList() []string {
+	return p.GetAllServers().GetIncluded().GetNames()
+}
+
+// GetServerList returns the names of the servers in the application (not excluded from patching), sorted
+func (a *Application) GetServerList() []string {
+	return a.GetAllServers().GetIncluded().GetNames()
+}
+
+// GetServerList returns the names of the servers in the environment (not excluded from patching), sorted
+func (e *Environment) GetServerList() []string {
+	return e.GetAllServers().GetIncluded().GetNames()
+}
+
+// GetPuppetActions returns the puppet tasks and plans for the patch run, per PuppetServer
+func (p *PatchRun) GetPuppetActions() []*PuppetActions {
+	return getPuppetActions(fmt.Sprintf("/patchRun/%v", p.ID), "PatchRun", p.ID, p.GetAllServers(),
+		&PuppetTask{Enabled: true, IsForPatchRun: true}, &PuppetPlan{Enabled: true, IsForPatchRun: true})
+}
+
+// GetPuppetActions returns the puppet tasks and plans for the application, per PuppetServer
+func (a *Application) GetPuppetActions() []*PuppetActions {
+	return getPuppetActions(fmt.Sprintf("/application/%v", a.ID), "Application", a.ID, a.GetAllServers(),
+		&PuppetTask{Enabled: true, IsForApplication: true}, &PuppetPlan{Enabled: true, IsForApplication: true})
+}
+
+// GetPuppetActions returns the puppet tasks and plans for the environment, per PuppetServer
+func (e *Environment) GetPuppetActions() []*PuppetActions {
+	return getPuppetActions(fmt.Sprintf("/environment/%v", e.ID), "Environment", e.ID, e.GetAllServers(),
+		&PuppetTask{Enabled: true, IsForEnvironment: true}, &PuppetPlan{Enabled: true, IsForEnvironment: true})
+}
+
+// GetPuppetActions returns the puppet tasks and plans for the server (on its PuppetServer)
+func (s *Server) GetPuppetActions() []*PuppetActions {
+	actions := getPuppetActions(fmt.Sprintf("/server/%v", s.ID), "Server", s.ID, Servers{s},
+		&PuppetTask{Enabled: true, IsForServer: true}, &PuppetPlan{Enabled: true, IsForServer: true})
+	for _, a := range actions {
+		a.Single = true
+	}
+	return actions
+}
+
+// getPuppetActions returns the puppet tasks and plans (matching the filters) on the PuppetServers of the servers
+// NOTE: PuppetServers without any matching tasks or plans are skipped
+func getPuppetActions(path string, initiatorType string, initiatorID uint, servers Servers, taskFilter *PuppetTask, planFilter *PuppetPlan) (actions []*PuppetActions) {
+	actions = make([]*PuppetActions, 0)
+	for _, puppetServer := range servers.GetPuppetServers() {
+		a := &PuppetActions{
+			Path:         path,
+			PuppetServer: puppetServer,
+			Tasks:        getPuppetTasks(puppetServer.ID, taskFilter),
+			Plans:        getPuppetPlans(puppetServer.ID, planFilter),
+		}
+		if len(a.Tasks) == 0 && len(a.Plans) == 0 {
+			continue
+		}
+		a.TaskJobs = getPuppetJobs(puppetServer.ID, initiatorType, initiatorID, "Task")
+		a.PlanJobs = getPuppetJobs(puppetServer.ID, initiatorType, initiatorID, "Plan")
+		actions = append(actions, a)
+	}
+	return
+}
+
+// getPuppetTasks returns the puppet tasks on the PuppetServer matching the filter, sorted by name
+func getPuppetTasks(puppetServerID uint, filter *PuppetTask) (tasks PuppetTasks) {
+	tasks = make(PuppetTasks, 0)
+	err := GetDB().Model(&PuppetServer{Model: gorm.Model{ID: puppetServerID}}).Where(filter).Distinct().Order("name").Association("PuppetTasks").Find(&tasks)
+	if err != nil {
+		log.WithField("puppetServerID", puppetServerID).Error("Error Retrieving PuppetTasks: ", err)
+	}
+	return
+}
+
+// getPuppetPlans returns the puppet plans on the PuppetServer matching the filter, sorted by name
+func getPuppetPlans(puppetServerID uint, filter *PuppetPlan) (plans PuppetPlans) {
+	plans = make(PuppetPlans, 0)
+	err := GetDB().Model(&PuppetServer{Model: gorm.Model{ID: puppetServerID}}).Where(filter).Distinct().Order("name").Association("PuppetPlans").Find(&plans)
+	if err != nil {
+		log.WithField("puppetServerID", puppetServerID).Error("Error Retrieving PuppetPlans: ", err)
+	}
+	return
+}
+
+// getPuppetJobs returns the PuppetJobs (of kind Task, Plan or Default) on the PuppetServer started from the initiator
+func getPuppetJobs(puppetServerID uint, initiatorType string, initiatorID uint, kind string) (jobs []*PuppetJob) {
+	jobs = make([]*PuppetJob, 0)
+	GetDB().Where(&PuppetJob{PuppetServerID: puppetServerID, InitiatorID: initiatorID, InitiatorType: initiatorType, PuppetParentType: kind}).Find(&jobs)
+	return
+}
+
+// isForLevel returns true if the level (PatchRun, Application, Environment, Component or Server) is enabled
+func isForLevel(level string, patchRun, application, environment, component, server bool) bool {
+	switch level {
+	case "PatchRun":
+		return patchRun
+	case "Application":
+		return application
+	case "Environment":
+		return environment
+	case "Component":
+		return component
+	case "Server":
+		return server
+	}
+	return false
+}
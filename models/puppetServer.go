@@ -2,12 +2,11 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/puppetlabs/go-pe-client/pkg/orch"
-	"github.com/puppetlabs/go-pe-client/pkg/pe"
-	"github.com/puppetlabs/go-pe-client/pkg/puppetdb"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -17,21 +16,31 @@ type PuppetServer struct {
 	gorm.Model
 	Name          string `binding:"required"`
 	Description   string
-	Hostname      string `binding:"required,fqdn"`
-	PuppetDBPort  uint   `binding:"required,numeric,gte=1024,lte=65535"`
-	OrchPort      uint   `binding:"required,numeric,gte=1024,lte=65535"`
-	RBACPort      uint   `binding:"required,numeric,gte=1024,lte=65535"`
-	Token         string // `binding:"required"` - This can't be "required"
+	Hostname      string       `binding:"required,fqdn"`
+	PuppetDBPort  uint         `binding:"required,numeric,gte=1024,lte=65535"`
+	OrchPort      uint         `binding:"required,numeric,gte=1024,lte=65535"`
+	RBACPort      uint         `binding:"required,numeric,gte=1024,lte=65535"`
+	Token         SecretString // `binding:"required"` - This can't be "required"
 	SSL           bool
 	SSLSkipVerify bool
 	CACert        string
 	Enabled       bool
-	FactName      string           `binding:"required"` // TODO: Validate FactString
-	PuppetTasks   PuppetTasks      `gorm:"many2many:puppetserver_tasks" json:"-" yaml:"-" xml:"-" form:"-"`
-	PuppetPlans   PuppetPlans      `gorm:"many2many:puppetserver_plans" json:"-" yaml:"-" xml:"-" form:"-"`
-	OrchClient    *orch.Client     `gorm:"-" json:"-" yaml:"-" xml:"-" form:"-"`
-	PDBClient     *puppetdb.Client `gorm:"-" json:"-" yaml:"-" xml:"-" form:"-"`
-	PEClient      *pe.Client       `gorm:"-" json:"-" yaml:"-" xml:"-" form:"-"`
+	FactName      string `binding:"required"` // TODO: Validate FactString
+	SnapshotFacts string // comma separated list of facts for fact snapshots (blank is the default list)
+	// Patching Actions - bound to a PuppetTask/PuppetPlan (0 is the built-in default)
+	PatchTaskID uint // "patch" a server (default: <module>::patch_server)
+	TestTaskID  uint // "test" a server (default: <module>::clean_cache)
+	PatchPlanID uint // "cluster patch" a component (default: patchy::cluster_patching)
+	// RBAC Service Account - when RBACUsername is set, the Token is requested (and renewed) from the RBAC API
+	RBACUsername      string
+	RBACPassword      SecretString
+	RBACTokenLifetime uint        `binding:"omitempty,numeric,gte=1"` // hours
+	TokenExpiration   time.Time   `form:"-"`
+	TokenError        string      `form:"-"`
+	APITimeout        uint        `binding:"omitempty,numeric,gte=1"`  // seconds, not used by the Orchestrator and PE clients
+	APIRetries        uint        `binding:"omitempty,numeric,lte=10"` // not used by the Orchestrator and PE clients
+	PuppetTasks       PuppetTasks `gorm:"many2many:puppetserver_tasks" json:"-" yaml:"-" xml:"-" form:"-"`
+	PuppetPlans       PuppetPlans `gorm:"many2many:puppetserver_plans" json:"-" yaml:"-" xml:"-" form:"-"`
 }
 
 // PuppetServers is a list of PuppetServer objects
@@ -47,6 +56,9 @@ func NewPuppetServer() (p *PuppetServer) {
 	p.SSL = true
 	p.Enabled = true
 	p.FactName = "pe_patch.patch_group"
+	p.RBACTokenLifetime = 24
+	p.APITimeout = 30
+	p.APIRetries = 2
 	return
 }
 
@@ -58,6 +70,7 @@ func (p *PuppetServer) Init() {
 // Save : Save PatchRun object
 func (p *PuppetServer) Save() {
 	GetDB().Save(p)
+	p.InvalidateClients()
 }
 
 // Delete : Delete PatchRun object
@@ -65,6 +78,8 @@ func (p *PuppetServer) Delete(cascade bool) (err error) {
 	// if cascade {
 	// 	// No Child Objects yet
 	// }
+	_ = DeleteHealthChecksForTarget(HealthTargetPuppetServer, p.ID)
+	p.InvalidateClients()
 	GetDB().Delete(p) // TODO: Catch Error on delete from DB
 	return
 }
@@ -99,6 +114,54 @@ func (p *PuppetServer) GetPlans() (plans PuppetPlans, err error) {
 	return
 }
 
+// GetPatchTask returns the PuppetTask bound to the "patch" action (nil for the built-in default)
+func (p *PuppetServer) GetPatchTask() (task *PuppetTask, err error) {
+	return p.getBoundTask("PatchTaskID", p.PatchTaskID)
+}
+
+// GetTestTask returns the PuppetTask bound to the "test" action (nil for the built-in default)
+func (p *PuppetServer) GetTestTask() (task *PuppetTask, err error) {
+	return p.getBoundTask("TestTaskID", p.TestTaskID)
+}
+
+// GetPatchPlan returns the PuppetPlan bound to the "cluster patch" action (nil for the built-in default)
+// NOTE: A plan that no longer exists falls back to the built-in default
+func (p *PuppetServer) GetPatchPlan() (plan *PuppetPlan, err error) {
+	if p.PatchPlanID == 0 {
+		return
+	}
+	plan, err = GetPuppetPlanByID(p.PatchPlanID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.WithFields(log.Fields{"puppetServer": p.Name, "PatchPlanID": p.PatchPlanID}).Warn("Bound plan not found, using the built-in default")
+		return nil, nil
+	}
+	return
+}
+
+// getBoundTask returns the PuppetTask bound to an action (nil for the built-in default)
+// NOTE: A task that no longer exists falls back to the built-in default
+func (p *PuppetServer) getBoundTask(action string, id uint) (task *PuppetTask, err error) {
+	if id == 0 {
+		return
+	}
+	task, err = GetPuppetTaskByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.WithFields(log.Fields{"puppetServer": p.Name, action: id}).Warn("Bound task not found, using the built-in default")
+		return nil, nil
+	}
+	return
+}
+
+// HasPuppetTask returns true if the PuppetTask is associated to this PuppetServer
+func (p *PuppetServer) HasPuppetTask(task *PuppetTask) bool {
+	return GetDB().Model(p).Where("puppet_tasks.id = ?", task.ID).Association("PuppetTasks").Count() > 0
+}
+
+// HasPuppetPlan returns true if the PuppetPlan is associated to this PuppetServer
+func (p *PuppetServer) HasPuppetPlan(plan *PuppetPlan) bool {
+	return GetDB().Model(p).Where("puppet_plans.id = ?", plan.ID).Association("PuppetPlans").Count() > 0
+}
+
 // GetUnassociatedPlans : Get Puppet Plans that are not associated to this PuppetServer, that match names
 func (p *PuppetServer) GetUnassociatedPlans(names []string) (plans PuppetPlans, err error) {
 	notPlanIDs := make([]uint, 0)
@@ -106,7 +169,8 @@ func (p *PuppetServer) GetUnassociatedPlans(names []string) (plans PuppetPlans,
 	if err != nil {
 		return
 	}
-	err = GetDB().Model(PuppetPlan{}).Not(notPlanIDs).Find(&plans).Error
+	log.WithField("names", names).Info("Plans for names")
+	err = GetDB().Model(PuppetPlan{}).Not(notPlanIDs).Where("name IN ?", names).Find(&plans).Error
 	return
 }
 
@@ -128,9 +192,13 @@ func (p *PuppetServer) AddPuppetPlan(plan *PuppetPlan) (err error) {
 	return
 }
 
-// RemovePuppetPlan : Remove PuppetPlan from this PuppetServer
+// RemovePuppetPlan : Remove PuppetPlan from this PuppetServer (and clear the "cluster patch" action, if bound)
 func (p *PuppetServer) RemovePuppetPlan(plan *PuppetPlan) (err error) {
 	err = GetDB().Model(p).Association("PuppetPlans").Delete(plan)
+	if err == nil && p.PatchPlanID == plan.ID {
+		p.PatchPlanID = 0
+		err = GetDB().Model(p).Update("patch_plan_id", 0).Error
+	}
 	return
 }
 
@@ -140,12 +208,36 @@ func (p *PuppetServer) AddPuppetTask(task *PuppetTask) (err error) {
 	return
 }
 
-// RemovePuppetTask : Remove PuppetTask from this PuppetServer
+// RemovePuppetTask : Remove PuppetTask from this PuppetServer (and clear the actions it is bound to)
 func (p *PuppetServer) RemovePuppetTask(task *PuppetTask) (err error) {
 	err = GetDB().Model(p).Association("PuppetTasks").Delete(task)
+	if err == nil && p.PatchTaskID == task.ID {
+		p.PatchTaskID = 0
+		err = GetDB().Model(p).Update("patch_task_id", 0).Error
+	}
+	if err == nil && p.TestTaskID == task.ID {
+		p.TestTaskID = 0
+		err = GetDB().Model(p).Update("test_task_id", 0).Error
+	}
 	return
 }
 
+// clearTaskBindings clears the actions bound to a (deleted) PuppetTask on every PuppetServer
+func clearTaskBindings(taskID uint) (err error) {
+	for _, column := range []string{"patch_task_id", "test_task_id"} {
+		err = GetDB().Model(&PuppetServer{}).Where(column+" = ?", taskID).Update(column, 0).Error
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// clearPlanBindings clears the actions bound to a (deleted) PuppetPlan on every PuppetServer
+func clearPlanBindings(planID uint) (err error) {
+	return GetDB().Model(&PuppetServer{}).Where("patch_plan_id = ?", planID).Update("patch_plan_id", 0).Error
+}
+
 // IsPuppetServersEnabled returns a bool if there are enabled PuppetServers
 func IsPuppetServersEnabled() (enabled bool) {
 	var count int64
@@ -183,6 +275,111 @@ func (p *PuppetServer) GetConsoleURL() (url string) {
 	return p.GetBaseURL(443) // NOTE: hardcoded to 443
 }
 
+// GetRBACURL returns the Puppet RBAC API URL for the Puppet Server
+func (p *PuppetServer) GetRBACURL() (url string) {
+	return p.GetBaseURL(p.RBACPort)
+}
+
+// UsesRBACToken returns true if the Token is requested from the RBAC API (using the service account)
+func (p *PuppetServer) UsesRBACToken() bool {
+	return p.RBACUsername != ""
+}
+
+// GetRBACTokenLifetime returns the lifetime to request for RBAC tokens
+func (p *PuppetServer) GetRBACTokenLifetime() time.Duration {
+	return time.Duration(p.RBACTokenLifetime) * time.Hour
+}
+
+// TokenNeedsRenewal returns true if the RBAC token is missing, or will expire soon (within 1/4 of its lifetime)
+func (p *PuppetServer) TokenNeedsRenewal() bool {
+	if !p.UsesRBACToken() {
+		return false
+	}
+	if p.Token == "" || p.TokenExpiration.IsZero() {
+		return true
+	}
+	return time.Until(p.TokenExpiration) < p.GetRBACTokenLifetime()/4
+}
+
+// GetTokenStatus returns a description of the state of the Token
+func (p *PuppetServer) GetTokenStatus() (status string) {
+	switch {
+	case p.TokenError != "":
+		status = "Error: " + p.TokenError
+	case p.Token == "":
+		status = "Not Set"
+	case !p.UsesRBACToken() && p.Token.IsReference():
+		status = "External Reference"
+	case !p.UsesRBACToken():
+		status = "Static (expiration unknown)"
+	case time.Now().After(p.TokenExpiration):
+		status = fmt.Sprintf("Expired at %s", p.TokenExpiration.Format(time.RFC1123))
+	case p.TokenNeedsRenewal():
+		status = fmt.Sprintf("Expiring at %s (will be renewed on next use)", p.TokenExpiration.Format(time.RFC1123))
+	default:
+		status = fmt.Sprintf("Valid until %s", p.TokenExpiration.Format(time.RFC1123))
+	}
+	return
+}
+
+// ReloadToken will reload (only) the token related fields from the database (i.e. renewed by another request)
+func (p *PuppetServer) ReloadToken() (err error) {
+	fresh := new(PuppetServer)
+	err = GetDB().Select("token", "token_expiration", "token_error").Where("id = ?", p.ID).First(fresh).Error
+	if err != nil {
+		return
+	}
+	p.Token = fresh.Token
+	p.TokenExpiration = fresh.TokenExpiration
+	p.TokenError = fresh.TokenError
+	return
+}
+
+// SetRBACToken will update (only) the token related fields
+// NOTE: tokenErr is recorded (the existing Token is kept) when the token request failed
+func (p *PuppetServer) SetRBACToken(token string, expiration time.Time, tokenErr error) (err error) {
+	updates := map[string]interface{}{"token_error": ""}
+	if tokenErr != nil {
+		updates["token_error"] = tokenErr.Error()
+	} else {
+		updates["token"] = SecretString(token)
+		updates["token_expiration"] = expiration
+	}
+	err = GetDB().Model(p).UpdateColumns(updates).Error
+	if err != nil {
+		return
+	}
+	if tokenErr != nil {
+		p.TokenError = tokenErr.Error()
+		return
+	}
+	p.Token = SecretString(token)
+	p.TokenExpiration = expiration
+	p.TokenError = ""
+	// Clients were created with the old token
+	p.InvalidateClients()
+	return
+}
+
+// GetAPITimeout returns the timeout for API requests
+func (p *PuppetServer) GetAPITimeout() time.Duration {
+	if p.APITimeout == 0 {
+		return time.Duration(NewPuppetServer().APITimeout) * time.Second
+	}
+	return time.Duration(p.APITimeout) * time.Second
+}
+
+// GetConfigHash returns a hash of the configuration used to create the API clients
+// NOTE: The stored Token is hashed, so references (env:, file:, vault:) are refreshed by ClientCacheTTL
+func (p *PuppetServer) GetConfigHash() string {
+	return hashConfig(p.Hostname, p.PuppetDBPort, p.OrchPort, p.RBACPort, p.SSL, p.SSLSkipVerify, p.CACert, p.Token, p.APITimeout, p.APIRetries)
+}
+
+// InvalidateClients removes the cached API clients for this PuppetServer
+func (p *PuppetServer) InvalidateClients() {
+	InvalidateClients(p.ID, ClientKindOrch, ClientKindPuppetDB, ClientKindPE)
+}
+
 // GetFactNamePath returns the FactName as a "path" for PuppetDB API
 func (p *PuppetServer) GetFactNamePath() (factPath string) {
 	factList := strings.Split(p.FactName, ".")
@@ -194,6 +391,24 @@ func (p *PuppetServer) GetFactNamePath() (factPath string) {
 	return
 }
 
+// GetSnapshotFacts returns the list of facts for fact snapshots
+// NOTE: The default list uses the patching fact (first part of the FactName), i.e. pe_patch
+func (p *PuppetServer) GetSnapshotFacts() []string {
+	if facts := splitList(p.SnapshotFacts); len(facts) > 0 {
+		return facts
+	}
+	patchingFact := strings.Split(p.FactName, ".")[0]
+	return []string{
+		"kernelrelease",
+		"os.release",
+		"system_uptime",
+		patchingFact + ".package_update_count",
+		patchingFact + ".security_package_update_count",
+		patchingFact + ".pinned_packages",
+		patchingFact + ".reboots",
+	}
+}
+
 // setDefaults sets defaults on "existing" entries. This handles adding new attributes.
 // NOTE: We cannot handle setting a boolean default to true on existing entries.
 func (p *PuppetServer) setDefaults() {
@@ -215,6 +430,14 @@ func (p *PuppetServer) setDefaults() {
 		p.OrchPort = new.OrchPort
 		changed = true
 	}
+	if p.APITimeout == 0 {
+		p.APITimeout = new.APITimeout
+		changed = true
+	}
+	if p.RBACTokenLifetime == 0 {
+		p.RBACTokenLifetime = new.RBACTokenLifetime
+		changed = true
+	}
 	if changed {
 		p.Save()
 	}
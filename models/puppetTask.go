@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -14,11 +16,14 @@ type PuppetTask struct {
 	Description      string
 	APITaskID        string // Used by pe-go-client as the "id" - Looks like a URL
 	Environment      string
+	SupportsNoop     bool `form:"-"` // from the task metadata
 	Enabled          bool
 	IsForPatchRun    bool
 	IsForApplication bool
+	IsForEnvironment bool
 	IsForComponent   bool
 	IsForServer      bool
+	IsNotOnServer    bool               `form:"-"`                                                               // Flags tasks removed from (one of) the PuppetServers (catalog sync)
 	PuppetServers    *[]PuppetServer    `gorm:"many2many:puppetserver_tasks" json:"-" yaml:"-" xml:"-" form:"-"` // Parent Puppet Server(s)
 	Params           []*PuppetTaskParam `json:"-" yaml:"-" xml:"-" form:"-"`                                     // Params are owned by a PuppetTask
 }
@@ -45,6 +50,20 @@ func (t *PuppetTask) Save() error {
 	return GetDB().Save(t).Error
 }
 
+// SaveFromAPI saves the fields updated from the API (a new task is created), so concurrent edits are kept
+func (t *PuppetTask) SaveFromAPI() error {
+	if t.ID == 0 {
+		return t.Save()
+	}
+	return GetDB().Model(t).Select("Description", "SupportsNoop", "APITaskID").Updates(t).Error
+}
+
+// SetNotOnServer saves the IsNotOnServer flag (catalog sync)
+func (t *PuppetTask) SetNotOnServer(notOnServer bool) error {
+	t.IsNotOnServer = notOnServer
+	return GetDB().Model(t).Update("IsNotOnServer", notOnServer).Error
+}
+
 // Delete : Delete PatchRun object
 func (t *PuppetTask) Delete(cascade bool) (err error) {
 	if cascade {
@@ -60,8 +79,18 @@ func (t *PuppetTask) Delete(cascade bool) (err error) {
 				return
 			}
 		}
+		err = deletePuppetMetadata("Task", t.ID)
+		if err != nil {
+			log.Error("Error DELETING metadata: ", err)
+			return
+		}
 		// TODO: Should we delete PuppetTaskJob(s) ... currently not doing it
 	}
+	err = clearTaskBindings(t.ID) // the actions fall back to the built-in default
+	if err != nil {
+		log.Error("Error CLEARING the patching actions: ", err)
+		return
+	}
 	return GetDB().Delete(t).Error // TODO: Catch Error on delete from DB
 }
 
@@ -103,6 +132,65 @@ func (t *PuppetTask) GetParamByName(paramName string) (param *PuppetTaskParam, e
 	return
 }
 
+// IsFor returns true if the PuppetTask is available on the level (PatchRun, Application, Environment, Component or Server)
+func (t *PuppetTask) IsFor(level string) bool {
+	return isForLevel(level, t.IsForPatchRun, t.IsForApplication, t.IsForEnvironment, t.IsForComponent, t.IsForServer)
+}
+
+// ValidateParamTemplates validates the param templates against a sample object
+// for each level (PatchRun, Application, ...) the puppet task is available on (the IsFor* fields, not saved yet)
+func (t *PuppetTask) ValidateParamTemplates() error {
+	params, err := t.GetParams()
+	if err != nil {
+		return err
+	}
+	return validateParamTemplates(params, getParamTemplateSamples(t.IsForPatchRun, t.IsForApplication, t.IsForEnvironment, t.IsForComponent, t.IsForServer, true))
+}
+
+// GetParamValues will execute the param templates (with data, i.e. a Component or Server) and return the param values
+// NOTE: Params without a TemplateValue are empty (the orchestrator applies the default), template errors are returned (with the param name)
+func (t *PuppetTask) GetParamValues(data interface{}) (params map[string]string, err error) {
+	taskParams, err := t.GetParams()
+	if err != nil {
+		log.Error("Error retrieving puppetTask params: ", err)
+		return
+	}
+	return getParamValues(t.Name, taskParams, data, false)
+}
+
+// GetMissingParams returns the names of the required params without a value (sorted by name)
+func (t *PuppetTask) GetMissingParams(params map[string]string) (missing []string) {
+	missing = make([]string, 0)
+	taskParams, err := t.GetParams()
+	if err != nil {
+		log.Error("Error retrieving taskParams: ", err)
+		return
+	}
+	for _, taskParam := range taskParams {
+		if taskParam.IsRequired && !taskParam.IsNotInTask && strings.TrimSpace(params[taskParam.Name]) == "" {
+			missing = append(missing, taskParam.Name)
+		}
+	}
+	sort.Strings(missing)
+	return
+}
+
+// GetSensitiveParamNames returns the names of the sensitive params
+func (t *PuppetTask) GetSensitiveParamNames() (names []string) {
+	names = make([]string, 0)
+	taskParams, err := t.GetParams()
+	if err != nil {
+		log.Error("Error retrieving taskParams: ", err)
+		return
+	}
+	for _, taskParam := range taskParams {
+		if taskParam.IsSensitive {
+			names = append(names, taskParam.Name)
+		}
+	}
+	return
+}
+
 // Param : Return a PuppetTaskParam object by name (create if not exist)
 func (t *PuppetTask) Param(name string) (param *PuppetTaskParam) {
 	param = new(PuppetTaskParam)
@@ -129,6 +217,14 @@ func IsEnabledPuppetTasks() (enabled bool) {
 	return count > 0
 }
 
+// GetPuppetTaskByName returns the PuppetTask by name and environment (ID is 0 if not found)
+// NOTE: A task without an environment is in the DefaultPuppetEnvironment
+func GetPuppetTaskByName(name, env string) (t *PuppetTask, err error) {
+	t = new(PuppetTask)
+	err = whereEnvironment(GetDB().Preload("Params"), name, env).Limit(1).Find(t).Error
+	return
+}
+
 // GetPuppetTasks returns a list of all PuppetTasks
 func GetPuppetTasks() (servers PuppetTasks) {
 	servers = make(PuppetTasks, 0)
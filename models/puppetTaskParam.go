@@ -6,8 +6,6 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
-
-	"github.com/tjm/puppet-patching-automation/functions"
 )
 
 // PuppetTaskParam defines PuppetTaskParamParams
@@ -17,6 +15,9 @@ type PuppetTaskParam struct {
 	Type          string
 	Description   string
 	TemplateValue string
+	DefaultValue  string             `form:"-"` // from the task metadata (JSON for non-string values), applied by the orchestrator
+	IsRequired    bool               `form:"-"` // no default value and not Optional, the launch is blocked without a value
+	IsSensitive   bool               `form:"-"` // from the task metadata, masked in the preview and the recorded jobs
 	IsNotInTask   bool               // Finds old parameters
 	template      *template.Template `gorm:"-" binding:"-" form:"-"`
 	PuppetTaskID  uint               `form:"-"`                           // Parent PuppetTask ID
@@ -48,6 +49,14 @@ func (p *PuppetTaskParam) Save() error {
 	return GetDB().Save(p).Error
 }
 
+// SaveFromAPI saves the fields updated from the API (not the TemplateValue), so concurrent edits are kept
+func (p *PuppetTaskParam) SaveFromAPI() error {
+	if p.ID == 0 {
+		return p.Save()
+	}
+	return GetDB().Model(p).Select("Type", "Description", "DefaultValue", "IsRequired", "IsSensitive", "IsNotInTask").Updates(p).Error
+}
+
 // Delete : Delete PatchRun object
 func (p *PuppetTaskParam) Delete(cascade bool) (err error) {
 	// if cascade {
@@ -57,6 +66,11 @@ func (p *PuppetTaskParam) Delete(cascade bool) (err error) {
 	return GetDB().Delete(p).Error
 }
 
+// getTemplateInfo returns the ID, Name and TemplateValue of the param (templateParam)
+func (p *PuppetTaskParam) getTemplateInfo() (uint, string, string) {
+	return p.ID, p.Name, p.TemplateValue
+}
+
 // GetTemplate : Returns Template for Param
 func (p *PuppetTaskParam) GetTemplate() (tpl *template.Template, err error) {
 	if p.template == nil {
@@ -68,29 +82,29 @@ func (p *PuppetTaskParam) GetTemplate() (tpl *template.Template, err error) {
 	return p.template, nil
 }
 
-// GetDefaultValue will get the appropriate Default value based on the type
-// TODO: See if there is a way to get the default value from Puppet API, for now returns ""
+// GetDefaultValue will get the default value from the task metadata ("" if there is none)
 func (p *PuppetTaskParam) GetDefaultValue() (value string, err error) {
-	// switch p.Type {
-	// case "":
-	// 	err = errors.New("type must be set before trying to get a default value")
-	// case "BooleanParameterDefinition":
-	// 	value = strconv.FormatBool(p.DefaultBool)
-	// case "StringParameterDefinition", "ChoiceParameterDefinition", "TextParameterDefinition":
-	// 	value = p.DefaultString
-	// default:
-	// 	err = errors.New("Unable to handle parameter type: " + p.Type)
-	// }
-	return
+	return p.DefaultValue, nil
+}
+
+// ValidateTemplate parses the template and executes it against a sample object
+// for each level (PatchRun, Application, ...) the puppet task is available on
+func (p *PuppetTaskParam) ValidateTemplate() error {
+	err := p.buildTemplate()
+	if err != nil {
+		return err
+	}
+	t, err := GetPuppetTaskByID(p.PuppetTaskID)
+	if err != nil {
+		return err
+	}
+	return validateParamTemplate(p.template, getParamTemplateSamples(t.IsForPatchRun, t.IsForApplication, t.IsForEnvironment, t.IsForComponent, t.IsForServer, true))
 }
 
 // buildTemplate : Builds Template
 func (p *PuppetTaskParam) buildTemplate() (err error) {
 	templateName := fmt.Sprintf("PuppetTaskParamID-%v", p.ID) // I am not even sure where this us used.
-	tpl, err := template.New(templateName).Funcs(template.FuncMap{
-		"FormatAsDateTimeLocal": functions.FormatAsDateTimeLocal,
-		"FormatAsISO8601":       functions.FormatAsISO8601,
-	}).Parse(p.TemplateValue)
+	tpl, err := parseParamTemplate(templateName, p.TemplateValue)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"ID":        p.ID,
@@ -0,0 +1,49 @@
+package models
+
+// Readiness Status (result of the pre-patch readiness checks of a Server)
+const (
+	ReadinessReady      = "ready"
+	ReadinessNoop       = "noop"       // last puppet run was in noop mode
+	ReadinessUnreported = "unreported" // no puppet report recently
+	ReadinessUnknown    = "unknown"    // not found (active) in PuppetDB
+	ReadinessFailed     = "failed"     // last puppet run failed
+)
+
+// readinessSeverity orders the readiness status (worst is highest) for the roll-up
+var readinessSeverity = map[string]int{
+	ReadinessReady:      1,
+	ReadinessNoop:       2,
+	ReadinessUnreported: 3,
+	ReadinessUnknown:    4,
+	ReadinessFailed:     5,
+}
+
+// Readiness is a roll-up of the readiness of a list of Servers (i.e. a Component)
+type Readiness struct {
+	Status  string         `json:"status"` // worst status of the checked servers
+	Counts  map[string]int `json:"counts"` // number of servers by status
+	Checked int            `json:"checked"`
+	Total   int            `json:"total"`
+}
+
+// IsReady returns true if all of the servers were checked and are ready
+func (r Readiness) IsReady() bool {
+	return r.Total > 0 && r.Checked == r.Total && r.Status == ReadinessReady
+}
+
+// GetReadiness returns the readiness roll-up of the servers (excluded servers are ignored)
+func (servers Servers) GetReadiness() (r Readiness) {
+	r.Counts = make(map[string]int)
+	for _, server := range servers.GetIncluded() {
+		r.Total++
+		if !server.IsReadinessChecked() {
+			continue
+		}
+		r.Checked++
+		r.Counts[server.ReadinessStatus]++
+		if readinessSeverity[server.ReadinessStatus] > readinessSeverity[r.Status] {
+			r.Status = server.ReadinessStatus
+		}
+	}
+	return
+}
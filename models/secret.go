@@ -0,0 +1,332 @@
+package models
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/tjm/puppet-patching-automation/config"
+)
+
+// ***** NOTICE: Secrets are stored using envelope encryption.
+// *****         Each value is encrypted with a random data key (AES-256-GCM), the data key is
+// *****         encrypted (wrapped) with the primary key encryption key (SECRET_KEYS / SECRET_KEY_FILE).
+// *****         Stored format: enc:v1:<keyID>:<base64 wrapped data key>:<base64 ciphertext>
+
+// secretPrefix identifies an encrypted value in the database
+const secretPrefix = "enc:v1:"
+
+// SecretString is a string that is encrypted at rest (in the database)
+type SecretString string
+
+// secretKey is a key encryption key
+type secretKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var (
+	secretKeys     []*secretKey // first key is the primary (used to encrypt)
+	secretKeysOnce sync.Once
+
+	errSecretMalformed   = errors.New("malformed encrypted secret")
+	errSecretKeyNotFound = errors.New("secret encryption key not found")
+	errSecretKeyInvalid  = errors.New("secret encryption key must be keyID:base64key (32 bytes)")
+)
+
+// secretColumns lists the table columns that contain SecretString values (for migrateSecrets)
+var secretColumns = []struct {
+	table  string
+	column string
+}{
+	{"puppet_servers", "token"},
+	{"puppet_servers", "rbac_password"},
+	{"jenkins_servers", "token"},
+	{"chat_rooms", "webhook_url"},
+	{"settings", "value"},
+}
+
+// GormDataType keeps the column a plain string (text) column
+func (SecretString) GormDataType() string {
+	return "string"
+}
+
+// Value encrypts the secret for storage in the database (driver.Valuer)
+func (s SecretString) Value() (driver.Value, error) {
+	if s == "" || !IsSecretEncryptionEnabled() {
+		return string(s), nil
+	}
+	return encryptSecret(string(s))
+}
+
+// Scan decrypts the secret when read from the database (sql.Scanner)
+func (s *SecretString) Scan(value interface{}) (err error) {
+	var stored string
+	switch v := value.(type) {
+	case nil:
+		stored = ""
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("unable to scan %T into SecretString", value)
+	}
+	plaintext, err := decryptSecret(stored)
+	if err != nil {
+		return
+	}
+	*s = SecretString(plaintext)
+	return
+}
+
+// String returns the (decrypted) secret
+func (s SecretString) String() string {
+	return string(s)
+}
+
+// IsSecretEncryptionEnabled returns true if there is a key to encrypt secrets
+func IsSecretEncryptionEnabled() bool {
+	return len(getSecretKeys()) > 0
+}
+
+// getSecretKeys returns the key encryption keys (loading them the first time)
+func getSecretKeys() []*secretKey {
+	secretKeysOnce.Do(func() {
+		var err error
+		secretKeys, err = loadSecretKeys()
+		if err != nil {
+			panic("failed to load secret encryption keys: " + err.Error())
+		}
+		if len(secretKeys) == 0 {
+			log.Warn("No secret encryption keys (SECRET_KEYS or SECRET_KEY_FILE), secrets will be stored in plaintext. This should be set in production!")
+		}
+	})
+	return secretKeys
+}
+
+// loadSecretKeys will load the keys from SecretKeys then SecretKeyFile
+func loadSecretKeys() (keys []*secretKey, err error) {
+	args := config.GetArgs()
+	entries := append([]string{}, args.SecretKeys...)
+	if args.SecretKeyFile != "" {
+		var f *os.File
+		f, err = os.Open(args.SecretKeyFile)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		err = scanner.Err()
+		if err != nil {
+			return
+		}
+	}
+	for _, entry := range entries {
+		var key *secretKey
+		key, err = parseSecretKey(entry)
+		if err != nil {
+			return
+		}
+		keys = append(keys, key)
+	}
+	return
+}
+
+// parseSecretKey will parse keyID:base64key into a secretKey
+func parseSecretKey(entry string) (key *secretKey, err error) {
+	id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+	if !found || id == "" {
+		return nil, errSecretKeyInvalid
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 32 {
+		return nil, errSecretKeyInvalid
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return
+	}
+	return &secretKey{id: id, aead: aead}, nil
+}
+
+// getSecretKeyByID returns the key encryption key with the id
+func getSecretKeyByID(id string) (*secretKey, error) {
+	for _, key := range getSecretKeys() {
+		if key.id == id {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errSecretKeyNotFound, id)
+}
+
+// encryptSecret will encrypt the plaintext with a new data key, wrapped by the primary key
+func encryptSecret(plaintext string) (encrypted string, err error) {
+	keys := getSecretKeys()
+	if len(keys) == 0 {
+		return "", errSecretKeyNotFound
+	}
+	primary := keys[0]
+	dataKey := make([]byte, 32)
+	_, err = rand.Read(dataKey)
+	if err != nil {
+		return
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return
+	}
+	wrappedKey, err := seal(primary.aead, dataKey)
+	if err != nil {
+		return
+	}
+	ciphertext, err := seal(dataAEAD, []byte(plaintext))
+	if err != nil {
+		return
+	}
+	encrypted = secretPrefix + strings.Join([]string{
+		primary.id,
+		base64.StdEncoding.EncodeToString(wrappedKey),
+		base64.StdEncoding.EncodeToString(ciphertext),
+	}, ":")
+	return
+}
+
+// decryptSecret will decrypt an encrypted value, plaintext (legacy) values are returned as is
+func decryptSecret(stored string) (plaintext string, err error) {
+	if !isEncryptedSecret(stored) {
+		return stored, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(stored, secretPrefix), ":")
+	if len(parts) != 3 {
+		return "", errSecretMalformed
+	}
+	key, err := getSecretKeyByID(parts[0])
+	if err != nil {
+		return
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errSecretMalformed
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errSecretMalformed
+	}
+	dataKey, err := open(key.aead, wrappedKey)
+	if err != nil {
+		return
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return
+	}
+	raw, err := open(dataAEAD, ciphertext)
+	if err != nil {
+		return
+	}
+	return string(raw), nil
+}
+
+// isEncryptedSecret returns true if the stored value is encrypted
+func isEncryptedSecret(stored string) bool {
+	return strings.HasPrefix(stored, secretPrefix)
+}
+
+// secretNeedsEncryption returns true if the stored value is plaintext or not encrypted with the primary key
+func secretNeedsEncryption(stored string) bool {
+	keys := getSecretKeys()
+	if stored == "" || len(keys) == 0 {
+		return false
+	}
+	return !strings.HasPrefix(stored, secretPrefix+keys[0].id+":")
+}
+
+// migrateSecrets will encrypt existing plaintext secrets and re-encrypt (rotate) secrets
+// that were not encrypted with the primary key
+func migrateSecrets() {
+	if !IsSecretEncryptionEnabled() {
+		return
+	}
+	for _, sc := range secretColumns {
+		var rows []struct {
+			ID    uint
+			Value string
+		}
+		err := GetDB().Table(sc.table).Select("id, " + sc.column + " AS value").Where(sc.column + " <> ''").Scan(&rows).Error
+		if err != nil {
+			log.WithField("table", sc.table).Error("Error reading secrets for migration: ", err)
+			continue
+		}
+		count := 0
+		for _, row := range rows {
+			if !secretNeedsEncryption(row.Value) {
+				continue
+			}
+			plaintext, err := decryptSecret(row.Value)
+			if err != nil {
+				log.WithFields(log.Fields{"table": sc.table, "id": row.ID}).Error("Error decrypting secret for migration: ", err)
+				continue
+			}
+			encrypted, err := encryptSecret(plaintext)
+			if err != nil {
+				log.WithFields(log.Fields{"table": sc.table, "id": row.ID}).Error("Error encrypting secret for migration: ", err)
+				continue
+			}
+			err = GetDB().Table(sc.table).Where("id = ?", row.ID).UpdateColumn(sc.column, encrypted).Error
+			if err != nil {
+				log.WithFields(log.Fields{"table": sc.table, "id": row.ID}).Error("Error saving secret for migration: ", err)
+				continue
+			}
+			count++
+		}
+		if count > 0 {
+			log.WithFields(log.Fields{"table": sc.table, "column": sc.column, "count": count}).Info("Encrypted secrets with primary key")
+		}
+	}
+}
+
+// newAEAD returns an AES-GCM cipher for the key
+func newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data, prefixing the random nonce
+func seal(aead cipher.AEAD, data []byte) (sealed []byte, err error) {
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// open decrypts data sealed by seal
+func open(aead cipher.AEAD, sealed []byte) (data []byte, err error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errSecretMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tjm/puppet-patching-automation/config"
+)
+
+// ***** NOTICE: A SecretString can contain a reference to an external secret instead of the secret itself.
+// *****         env:NAME                     - environment variable
+// *****         file:/path/to/file           - contents of a file (trailing whitespace removed)
+// *****         vault:path/to/secret#key     - HashiCorp Vault (KV v1 or v2), using VAULT_ADDR and VAULT_TOKEN
+// *****         References are resolved each time a client is created, so changes are picked up without a restart.
+// *****         env: references are limited to SecretEnvPrefix, file: references to SecretFileDir (see ValidateReference).
+
+// Secret reference prefixes
+const (
+	secretRefEnv   = "env:"
+	secretRefFile  = "file:"
+	secretRefVault = "vault:"
+)
+
+// vaultTimeout is the timeout for requests to Vault
+const vaultTimeout = 10 * time.Second
+
+var (
+	errSecretRefEmpty    = errors.New("secret reference resolved to an empty value")
+	errSecretRefNotFound = errors.New("secret reference not found")
+	errVaultNotEnabled   = errors.New("vault secret references require VAULT_ADDR and VAULT_TOKEN")
+	errSecretEnvDenied   = errors.New("env secret reference is not allowed, the variable name must start with SECRET_ENV_PREFIX")
+	errSecretFileDenied  = errors.New("file secret reference is not allowed, the file must be in SECRET_FILE_DIR")
+)
+
+// IsReference returns true if the secret is a reference to an external secret (env:, file:, vault:)
+func (s SecretString) IsReference() bool {
+	v := string(s)
+	return strings.HasPrefix(v, secretRefEnv) || strings.HasPrefix(v, secretRefFile) || strings.HasPrefix(v, secretRefVault)
+}
+
+// ValidateReference returns an error if the secret is an env: or file: reference that is not allowed
+// - env:NAME - NAME must start with SecretEnvPrefix (if set)
+// - file:/path - the path must be in SecretFileDir (file references are disabled if it is not set)
+func (s SecretString) ValidateReference() (err error) {
+	v := string(s)
+	switch {
+	case strings.HasPrefix(v, secretRefEnv):
+		prefix := config.GetArgs().SecretEnvPrefix
+		if !strings.HasPrefix(strings.TrimPrefix(v, secretRefEnv), prefix) {
+			return fmt.Errorf("%w (%s): %s", errSecretEnvDenied, prefix, v)
+		}
+	case strings.HasPrefix(v, secretRefFile):
+		_, err = secretFilePath(strings.TrimPrefix(v, secretRefFile))
+	}
+	return
+}
+
+// secretFilePath returns the path (symlinks resolved) if it is in SecretFileDir
+func secretFilePath(path string) (resolved string, err error) {
+	dir := config.GetArgs().SecretFileDir
+	if dir == "" || !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%w: %s", errSecretFileDenied, path)
+	}
+	resolved = filepath.Clean(path)
+	if r, evalErr := filepath.EvalSymlinks(resolved); evalErr == nil {
+		resolved = r
+	}
+	if d, evalErr := filepath.EvalSymlinks(dir); evalErr == nil {
+		dir = d
+	}
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", errSecretFileDenied, path)
+	}
+	return
+}
+
+// Resolve returns the secret, resolving external secret references
+// NOTE: References that are not allowed (see ValidateReference) are rejected.
+func (s SecretString) Resolve() (secret string, err error) {
+	v := string(s)
+	err = s.ValidateReference()
+	if err != nil {
+		return
+	}
+	switch {
+	case strings.HasPrefix(v, secretRefEnv):
+		secret = os.Getenv(strings.TrimPrefix(v, secretRefEnv))
+	case strings.HasPrefix(v, secretRefFile):
+		var path string
+		path, err = secretFilePath(strings.TrimPrefix(v, secretRefFile))
+		if err != nil {
+			return
+		}
+		var data []byte
+		data, err = os.ReadFile(path) // #nosec G304 - limited to SecretFileDir
+		if err != nil {
+			return
+		}
+		secret = strings.TrimRight(string(data), "\r\n\t ")
+	case strings.HasPrefix(v, secretRefVault):
+		secret, err = resolveVaultSecret(strings.TrimPrefix(v, secretRefVault))
+		if err != nil {
+			return
+		}
+	default:
+		return v, nil
+	}
+	if secret == "" {
+		err = fmt.Errorf("%w: %s", errSecretRefEmpty, v)
+	}
+	return
+}
+
+// resolveVaultSecret will read path#key from Vault
+// NOTE: KV v2 paths must include "data" (i.e. secret/data/pe#token), same as the Vault API.
+func resolveVaultSecret(ref string) (secret string, err error) {
+	args := config.GetArgs()
+	if args.VaultAddr == "" || args.VaultToken == "" {
+		return "", errVaultNotEnabled
+	}
+	path, key, found := strings.Cut(ref, "#")
+	if !found || path == "" || key == "" {
+		return "", fmt.Errorf("vault secret reference must be vault:path#key: %s", ref)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(args.VaultAddr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Vault-Token", args.VaultToken)
+	if args.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", args.VaultNamespace)
+	}
+	client := &http.Client{
+		Timeout: vaultTimeout,
+		/* #nosec G402 - VaultSkipVerify defaults to false */
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: args.VaultSkipVerify}},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return
+	}
+	data := body.Data
+	// KV v2 nests the secret inside data.data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, isMetadata := data["metadata"]; isMetadata {
+			data = nested
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s#%s", errSecretRefNotFound, path, key)
+	}
+	secret = fmt.Sprint(value)
+	return
+}
@@ -1,29 +1,99 @@
 package models
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
+// Drift Status (result of verifying a Server against PuppetDB)
+const (
+	DriftStatusOK          = "ok"
+	DriftStatusMissing     = "missing"     // not found in PuppetDB (decommissioned or renamed)
+	DriftStatusDeactivated = "deactivated" // deactivated or expired in PuppetDB
+	DriftStatusMoved       = "moved"       // patch window fact has changed
+	DriftStatusStale       = "stale"       // no recent puppet report
+)
+
+// Patch Result Status (result of verifying a Server after patching)
+const (
+	PatchResultPatched      = "patched"
+	PatchResultNeedsPatches = "needs patches" // updates are still available
+	PatchResultNotRebooted  = "not rebooted"  // a reboot was required, but the server has not rebooted
+	PatchResultUnknown      = "unknown"       // facts not found in PuppetDB, no pre-patch snapshot or unknown reboot
+)
+
 // Server : Server Details Object
 type Server struct {
 	gorm.Model
-	Name              string   `json:"name"`
-	IPAddress         string   `json:"ip"`
-	VMName            string   `json:"vm_name"`
-	Notes             string   `json:"notes"`
-	OperatingSystem   string   `json:"operating_system"`
-	OSVersion         string   `json:"os_version"`
-	PackageUpdates    int      `json:"package_updates"`
-	PatchWindow       string   `json:"patch_window"`
-	PinnedPackages    []string `json:"pinned_packages" gorm:"-"`
-	SecurityUpdates   int      `json:"security_updates"`
-	UUID              string   `json:"uuid"`
-	TrelloItemID      string   `json:"trello_item_id"`
-	TrelloChecklistID string   `json:"trello_checklist_id"`
+	Name              string    `json:"name"`
+	IPAddress         string    `json:"ip"`
+	VMName            string    `json:"vm_name"`
+	Notes             string    `json:"notes"`
+	OperatingSystem   string    `json:"operating_system"`
+	OSVersion         string    `json:"os_version"`
+	OSFamily          string    `json:"os_family"`
+	PackageUpdates    int       `json:"package_updates"`
+	PatchWindow       string    `json:"patch_window"`
+	PinnedPackages    []string  `json:"pinned_packages" gorm:"serializer:json"`
+	BlockedPackages   []string  `json:"blocked_packages" gorm:"serializer:json"`
+	SecurityUpdates   int       `json:"security_updates"`
+	UpdatePackages    []string  `json:"update_packages" gorm:"serializer:json"`   // package_updates fact
+	SecurityPackages  []string  `json:"security_packages" gorm:"serializer:json"` // security_package_updates fact
+	UpdateKBs         []string  `json:"update_kbs" gorm:"serializer:json"`        // missing_update_kbs fact (Windows)
+	Kernel            string    `json:"kernel"`
+	Uptime            int       `json:"uptime"` // seconds
+	RebootRequired    bool      `json:"reboot_required"`
+	FactsAt           time.Time `json:"facts_at"` // when the facts were read from PuppetDB (inventory)
+	UUID              string    `json:"uuid"`
+	TrelloItemID      string    `json:"trello_item_id"`
+	TrelloChecklistID string    `json:"trello_checklist_id"`
 	TrelloCardID      uint
 	ComponentID       uint
 	PuppetServerID    uint
-	PuppetServer      *PuppetServer
+	PuppetServer      *PuppetServer `json:"-" yaml:"-" xml:"-" form:"-"` // not serialized (credentials)
+	patchRun          *PatchRun     // GetPatchRun (param templates)
+	// Exclusion from patching (execution)
+	Excluded       bool   `json:"excluded" form:"-"`
+	ExcludedReason string `json:"excluded_reason,omitempty" form:"-"`
+	// Drift (last verification against PuppetDB)
+	DriftStatus  string    `json:"drift_status,omitempty" form:"-"`
+	DriftMessage string    `json:"drift_message,omitempty" form:"-"`
+	LastReport   time.Time `json:"last_report" form:"-"`
+	VerifiedAt   time.Time `json:"verified_at" form:"-"`
+	// Readiness (last pre-patch readiness check)
+	ReadinessStatus    string    `json:"readiness_status,omitempty" form:"-"`
+	ReadinessMessage   string    `json:"readiness_message,omitempty" form:"-"`
+	ReadinessCheckedAt time.Time `json:"readiness_checked_at" form:"-"`
+	// Patch Result (post-patch verification)
+	PatchResult PatchResult `json:"patch_result" gorm:"embedded;embeddedPrefix:result_" form:"-"`
+}
+
+// PatchResult is the result of verifying a Server after patching (fresh facts compared to the pre-patch facts)
+type PatchResult struct {
+	Status          string    `json:"status,omitempty"`
+	Message         string    `json:"message,omitempty"`
+	PackageUpdates  int       `json:"package_updates"`
+	SecurityUpdates int       `json:"security_updates"`
+	Kernel          string    `json:"kernel"`
+	Uptime          int       `json:"uptime"` // seconds
+	RebootRequired  bool      `json:"reboot_required"`
+	Rebooted        bool      `json:"rebooted"`
+	VerifiedAt      time.Time `json:"verified_at"`
+}
+
+// IsVerified returns true if the server has been verified after patching
+func (r PatchResult) IsVerified() bool {
+	return !r.VerifiedAt.IsZero()
+}
+
+// IsFlagged returns true if the server still needs patches, has not rebooted or could not be verified
+func (r PatchResult) IsFlagged() bool {
+	return r.IsVerified() && r.Status != PatchResultPatched
 }
 
 // Servers - List of Servers
@@ -32,6 +102,10 @@ type Servers []*Server
 // Init - Create new server
 func (s *Server) Init() {
 	s.PinnedPackages = make([]string, 0)
+	s.BlockedPackages = make([]string, 0)
+	s.UpdatePackages = make([]string, 0)
+	s.SecurityPackages = make([]string, 0)
+	s.UpdateKBs = make([]string, 0)
 	GetDB().Create(s)
 }
 
@@ -52,6 +126,53 @@ func (s *Server) Delete(cascade bool) (err error) {
 	return
 }
 
+// IsWindows returns true if the server is running Windows (os.family fact)
+func (s *Server) IsWindows() bool {
+	return strings.EqualFold(s.OSFamily, "windows")
+}
+
+// GetRemoteURL returns a URL to connect to the server (rdp for Windows, otherwise ssh)
+func (s *Server) GetRemoteURL() string {
+	if s.IsWindows() {
+		return "rdp://" + s.Name
+	}
+	return "ssh://" + s.Name
+}
+
+// Exclude will exclude the server from patching
+func (s *Server) Exclude(reason string) {
+	s.Excluded = true
+	s.ExcludedReason = reason
+	s.Save()
+}
+
+// Include will include a (previously excluded) server in patching
+func (s *Server) Include() {
+	s.Excluded = false
+	s.ExcludedReason = ""
+	s.Save()
+}
+
+// IsVerified returns true if the server has been verified against PuppetDB
+func (s *Server) IsVerified() bool {
+	return !s.VerifiedAt.IsZero()
+}
+
+// HasDrift returns true if the last verification found the server has drifted
+func (s *Server) HasDrift() bool {
+	return s.IsVerified() && s.DriftStatus != DriftStatusOK
+}
+
+// IsReadinessChecked returns true if the pre-patch readiness has been checked
+func (s *Server) IsReadinessChecked() bool {
+	return !s.ReadinessCheckedAt.IsZero()
+}
+
+// IsReady returns true if the last readiness check passed
+func (s *Server) IsReady() bool {
+	return s.ReadinessStatus == ReadinessReady
+}
+
 // GetServerByID : Return a Server object by ID
 func GetServerByID(id uint) (server *Server, err error) {
 	server = new(Server)
@@ -59,9 +180,69 @@ func GetServerByID(id uint) (server *Server, err error) {
 	return
 }
 
-// GetBreadCrumbs for a Server - NOT CURRENTLY USED
-func (s Server) GetBreadCrumbs() BreadCrumbs {
-	return GetDefaultBreadCrumbs()
+// GetIncluded returns the Servers that are not excluded from patching
+func (servers Servers) GetIncluded() (included Servers) {
+	included = make(Servers, 0, len(servers))
+	for _, server := range servers {
+		if !server.Excluded {
+			included = append(included, server)
+		}
+	}
+	return
+}
+
+// OnPuppetServer returns the Servers associated to the PuppetServer
+func (servers Servers) OnPuppetServer(puppetServerID uint) (filtered Servers) {
+	filtered = make(Servers, 0, len(servers))
+	for _, server := range servers {
+		if server.PuppetServerID == puppetServerID {
+			filtered = append(filtered, server)
+		}
+	}
+	return
+}
+
+// GetNames returns the names of the Servers, sorted
+func (servers Servers) GetNames() (names []string) {
+	names = make([]string, 0, len(servers))
+	for _, server := range servers {
+		names = append(names, server.Name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// GetPuppetServers returns the PuppetServers the Servers are associated to, sorted by name
+func (servers Servers) GetPuppetServers() (puppetServers PuppetServers) {
+	puppetServers = make(PuppetServers, 0)
+	ids := make([]uint, 0)
+	seen := make(map[uint]bool)
+	for _, server := range servers {
+		if server.PuppetServerID != 0 && !seen[server.PuppetServerID] {
+			seen[server.PuppetServerID] = true
+			ids = append(ids, server.PuppetServerID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	err := GetDB().Where("id IN ?", ids).Order("name").Find(&puppetServers).Error
+	if err != nil {
+		log.Error("Error retrieving puppetServers from servers: ", err)
+	}
+	return
+}
+
+// GetBreadCrumbs returns a list of bread crumbs for navigation
+func (s Server) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	component, err := GetComponentByID(s.ComponentID)
+	if err != nil {
+		breadcrumbs = append(breadcrumbs, GetDefaultBreadCrumbs()...)
+	} else {
+		breadcrumbs = append(breadcrumbs, component.GetBreadCrumbs()...)
+	}
+	breadcrumbs = append(breadcrumbs, createBreadCrumb(fmt.Sprintf("Server: %s", s.Name), fmt.Sprintf("/server/%v", s.ID)))
+	return
 }
 
 // GetBreadCrumbs for a list of servers - NOT CURRENTLY USED
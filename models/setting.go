@@ -0,0 +1,85 @@
+package models
+
+import (
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/tjm/puppet-patching-automation/config"
+)
+
+// Setting names
+const (
+	SettingTrelloToken = "TrelloToken"
+)
+
+// Setting defines an application setting that is stored in the database
+// NOTE: Setting values are credentials (i.e. Trello Token), so they are always encrypted (SecretString)
+type Setting struct {
+	gorm.Model
+	Name  string       `gorm:"uniqueIndex" binding:"required"`
+	Value SecretString `json:"-" yaml:"-" xml:"-" form:"-"`
+}
+
+// Settings is a list of Setting objects
+type Settings []*Setting
+
+// GetSetting returns the value of a setting by name ("" if not set)
+func GetSetting(name string) (value string, err error) {
+	s := new(Setting)
+	err = GetDB().Where(&Setting{Name: name}).First(s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return s.Value.String(), err
+}
+
+// SetSetting sets the value of a setting by name
+func SetSetting(name, value string) (err error) {
+	s := new(Setting)
+	err = GetDB().Where(&Setting{Name: name}).FirstOrInit(s).Error
+	if err != nil {
+		return
+	}
+	s.Value = SecretString(value)
+	err = GetDB().Save(s).Error
+	if name == SettingTrelloToken {
+		InvalidateClients(0, ClientKindTrello)
+	}
+	return
+}
+
+// IsSettingSet returns true if the setting has a value
+func IsSettingSet(name string) bool {
+	value, err := GetSetting(name)
+	return err == nil && value != ""
+}
+
+// initSettings will seed the settings provided by config (env) in the database
+// NOTE: The config value is only used when the setting is not set, so a value set in the WebUI is kept on restart
+func initSettings() {
+	args := config.GetArgs()
+	if args.TrelloToken != "" {
+		current, err := GetSetting(SettingTrelloToken)
+		if err != nil {
+			log.Error("Error retrieving Trello Token setting: ", err)
+			return
+		}
+		if current == "" {
+			err = SetSetting(SettingTrelloToken, args.TrelloToken)
+			if err != nil {
+				log.Error("Error saving Trello Token setting: ", err)
+			}
+		} else if current != args.TrelloToken {
+			log.Warn("Trello Token is already set in the database (WebUI), ignoring the configured Trello Token")
+		}
+	}
+}
+
+// GetBreadCrumbs returns a list of bread crumbs for navigation
+func (settings Settings) GetBreadCrumbs() (breadcrumbs BreadCrumbs) {
+	breadcrumbs = append(breadcrumbs, GetDefaultBreadCrumbs()...)
+	breadcrumbs = append(breadcrumbs, createBreadCrumb("Settings", "/config/settings"))
+	return
+}
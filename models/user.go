@@ -0,0 +1,137 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// User defines a local user (used by the "local" authentication type)
+type User struct {
+	gorm.Model
+	Username     string `gorm:"uniqueIndex" binding:"required"`
+	Name         string
+	PasswordHash string `json:"-" yaml:"-" xml:"-" form:"-"`
+	Enabled      bool
+}
+
+// Users is a list of User objects
+type Users []*User
+
+var errInvalidPassword = errors.New("invalid username or password")
+
+// dummyPasswordHash is compared when there is no (usable) password hash, so a failed login takes as long as a
+// wrong password (does not leak which usernames exist or are disabled)
+const dummyPasswordHash = "$2a$10$LcWSZoMpk1IRXiKamixB7uos.WKMGwgbirsiA7CSrG8Dm4iG1CBcq"
+
+// NewUser returns a new User object
+func NewUser() (u *User) {
+	u = new(User)
+	// Defaults
+	u.Enabled = true
+	return
+}
+
+// Init : Create new User object
+func (u *User) Init() error {
+	return GetDB().Create(u).Error
+}
+
+// Save : Save User object
+func (u *User) Save() error {
+	return GetDB().Save(u).Error
+}
+
+// Delete : Delete User object
+func (u *User) Delete(cascade bool) (err error) {
+	// if cascade {
+	// 	// No Child Objects yet
+	// }
+	return GetDB().Delete(u).Error
+}
+
+// SetPassword will set the PasswordHash for the user
+// NOTE: If password already looks like a bcrypt hash, it is stored as is.
+func (u *User) SetPassword(password string) (err error) {
+	if _, err = bcrypt.Cost([]byte(password)); err == nil {
+		u.PasswordHash = password
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+	u.PasswordHash = string(hash)
+	return
+}
+
+// CheckPassword returns an error unless the password matches and the user is enabled
+// NOTE: The password is always compared (even for disabled users), so the timing is the same.
+func (u *User) CheckPassword(password string) (err error) {
+	hash := u.PasswordHash
+	if hash == "" {
+		hash = dummyPasswordHash
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil || !u.Enabled || u.PasswordHash == "" {
+		return errInvalidPassword
+	}
+	return
+}
+
+// IsPasswordUnchanged returns true if the password (or bcrypt hash, see SetPassword) is already set for the user
+// NOTE: Unlike CheckPassword, it does not matter whether the user is enabled.
+func (u *User) IsPasswordUnchanged(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+	if _, err := bcrypt.Cost([]byte(password)); err == nil {
+		return u.PasswordHash == password
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// CheckDummyPassword compares the password with a dummy hash and always returns errInvalidPassword
+// NOTE: Use when the user does not exist, so it takes as long as a wrong password.
+func CheckDummyPassword(password string) error {
+	_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+	return errInvalidPassword
+}
+
+// GetDisplayName returns the Name of the user, or the Username if Name is not set
+func (u *User) GetDisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Username
+}
+
+// GetUserByID returns User object by ID
+func GetUserByID(id uint) (u *User, err error) {
+	u = new(User)
+	err = GetDB().First(u, id).Error
+	return
+}
+
+// GetUserByUsername returns User object by Username (case insensitive)
+func GetUserByUsername(username string) (u *User, err error) {
+	u = new(User)
+	err = GetDB().Where(&User{Username: strings.ToLower(username)}).First(u).Error
+	return
+}
+
+// GetOrCreateUser returns User object by Username (creating it if it does not exist)
+func GetOrCreateUser(username string) (u *User, err error) {
+	u = NewUser()
+	err = GetDB().Where(User{Username: strings.ToLower(username)}).Attrs(User{Enabled: true}).FirstOrCreate(u).Error
+	return
+}
+
+// GetUsers returns a list of all Users
+func GetUsers() (users Users) {
+	users = make(Users, 0)
+	GetDB().Order("username").Find(&users)
+	return
+}
@@ -47,7 +47,7 @@ func StartService() {
 	router.Static("/assets", "./assets")
 	router.GET("/favicon.ico", favicon.New("assets/favicon.ico"))
 	middleware.SetupAuthentication(router) // Sets up authentication endpoints /login, /logout and /AUTHREDIRECTPATH
-	router.GET("/healthz", controllers.GetPing)
+	router.GET("/healthz", controllers.GetHealthz)
 	router.GET("/ping", controllers.GetPing) // Legacy health check (almost every gin-gonic app has a /ping)
 
 	// Patching Automation Specific Paths and Handlers
@@ -64,12 +64,30 @@ func StartService() {
 		patchRun.GET(":id/trelloBoards", middleware.Authorize("patchRun", "read"), controllers.GetTrelloBoards)
 
 		patchRun.POST(":id/runQuery", middleware.Authorize("patchRun", "write"), controllers.RunPuppetDBQuery)
+		patchRun.GET(":id/verify", middleware.Authorize("patchRun", "read"), controllers.GetPatchRunVerification)
+		patchRun.POST(":id/verify", middleware.Authorize("patchRun", "write"), controllers.VerifyPatchRun)
+		patchRun.GET(":id/readiness", middleware.Authorize("patchRun", "read"), controllers.GetPatchRunReadiness)
+		patchRun.POST(":id/readiness", middleware.Authorize("patchRun", "write"), controllers.CheckPatchRunReadiness)
+		patchRun.GET(":id/results", middleware.Authorize("patchRun", "read"), controllers.GetPatchRunResults)
+		patchRun.POST(":id/results", middleware.Authorize("patchRun", "write"), controllers.VerifyPatchRunResults)
+		patchRun.GET(":id/snapshots", middleware.Authorize("patchRun", "read"), controllers.GetPatchRunSnapshots)
+		patchRun.POST(":id/snapshots/:stage", middleware.Authorize("patchRun", "write"), controllers.TakePatchRunSnapshots)
+		patchRun.GET(":id/packages", middleware.Authorize("patchRun", "read"), controllers.GetPatchRunPackages)
+		patchRun.GET(":id/pinnedPackages", middleware.Authorize("patchRun", "read"), controllers.GetPatchRunPinnedPackages)
+		patchRun.GET(":id/snapshotCSV", middleware.Authorize("patchRun", "read"), controllers.GetPatchRunSnapshotCSV)
+		patchRun.POST(":id/excludeServer/:serverID", middleware.Authorize("server", "write"), controllers.ExcludePatchRunServer)
+		patchRun.POST(":id/includeServer/:serverID", middleware.Authorize("server", "write"), controllers.IncludePatchRunServer)
 
 		patchRun.POST(":id/linkChatRoom", middleware.Authorize("patchRun", "write"), controllers.LinkChatRoomToPatchRun)
 
 		patchRun.GET(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "read"), controllers.BuildJenkinsJob) // PREVIEW
 		patchRun.POST(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "run"), controllers.BuildJenkinsJob)
 
+		patchRun.GET(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.PatchRunRunPuppetPlan) // PREVIEW
+		patchRun.POST(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.PatchRunRunPuppetPlan)
+		patchRun.GET(":id/runPuppetTask/:puppetServerID/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.PatchRunRunPuppetTask) // PREVIEW
+		patchRun.POST(":id/runPuppetTask/:puppetServerID/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.PatchRunRunPuppetTask)
+
 		patchRun.GET(":id/applications", middleware.Authorize("application", "read"), controllers.GetAllApplications)
 		patchRun.GET(":id/serverList", middleware.Authorize("server", "read"), controllers.GetServerList)
 		patchRun.GET(":id/serverCSV", middleware.Authorize("server", "read"), controllers.GetDetailedServerList)
@@ -81,6 +99,12 @@ func StartService() {
 		// Get application IDs from /patchRun/:id/applications
 		application.GET(":id", middleware.Authorize("application", "read"), controllers.GetApplication)
 		application.GET(":id/environments", middleware.Authorize("environment", "read"), controllers.GetAllEnvironments)
+		application.GET(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "read"), controllers.ApplicationBuildJenkinsJob) // PREVIEW
+		application.POST(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "run"), controllers.ApplicationBuildJenkinsJob)
+		application.GET(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.ApplicationRunPuppetPlan) // PREVIEW
+		application.POST(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.ApplicationRunPuppetPlan)
+		application.GET(":id/runPuppetTask/:puppetServerID/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.ApplicationRunPuppetTask) // PREVIEW
+		application.POST(":id/runPuppetTask/:puppetServerID/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.ApplicationRunPuppetTask)
 	}
 
 	environment := router.Group("/environment", middleware.Authenticate())
@@ -88,6 +112,12 @@ func StartService() {
 		// Get environment IDs from /application/:id/environments
 		environment.GET(":id", middleware.Authorize("environment", "read"), controllers.GetEnvironment)
 		environment.GET(":id/components", middleware.Authorize("component", "read"), controllers.GetAllComponents)
+		environment.GET(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "read"), controllers.EnvironmentBuildJenkinsJob) // PREVIEW
+		environment.POST(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "run"), controllers.EnvironmentBuildJenkinsJob)
+		environment.GET(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.EnvironmentRunPuppetPlan) // PREVIEW
+		environment.POST(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.EnvironmentRunPuppetPlan)
+		environment.GET(":id/runPuppetTask/:puppetServerID/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.EnvironmentRunPuppetTask) // PREVIEW
+		environment.POST(":id/runPuppetTask/:puppetServerID/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.EnvironmentRunPuppetTask)
 	}
 
 	component := router.Group("/component", middleware.Authenticate())
@@ -96,6 +126,8 @@ func StartService() {
 		component.GET(":id", middleware.Authorize("component", "read"), controllers.GetComponent)
 		component.GET(":id/servers", middleware.Authorize("component", "read"), controllers.GetAllServers)
 		component.POST(":id/runPatching", middleware.Authorize("puppetTaskRun", "run"), controllers.ComponentRunPatching)
+		component.GET(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "read"), controllers.ComponentBuildJenkinsJob) // PREVIEW
+		component.POST(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "run"), controllers.ComponentBuildJenkinsJob)
 		component.GET(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetTaskRun", "run"), controllers.ComponentRunPuppetPlan)
 		component.POST(":id/runPuppetPlan/:puppetServerID/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.ComponentRunPuppetPlan)
 		component.GET(":id/runPuppetTask/:puppetServerID/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.ComponentRunPuppetTask)
@@ -107,7 +139,14 @@ func StartService() {
 		// Get Server IDs from /component/:id/servers
 		server.GET(":id", middleware.Authorize("server", "read"), controllers.GetServer)
 		server.POST(":id/runPatching", middleware.Authorize("puppetTaskRun", "run"), controllers.ServerRunPatching)
+		server.GET(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "read"), controllers.ServerBuildJenkinsJob) // PREVIEW
+		server.POST(":id/buildJenkinsJob/:jobID", middleware.Authorize("jenkinsJobRun", "run"), controllers.ServerBuildJenkinsJob)
+		server.GET(":id/runPuppetPlan/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.ServerRunPuppetPlan) // PREVIEW
+		server.POST(":id/runPuppetPlan/:planID", middleware.Authorize("puppetPlanRun", "run"), controllers.ServerRunPuppetPlan)
+		server.GET(":id/runPuppetTask/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.ServerRunPuppetTask) // PREVIEW
+		server.POST(":id/runPuppetTask/:taskID", middleware.Authorize("puppetTaskRun", "run"), controllers.ServerRunPuppetTask)
 		server.GET(":id/facts", middleware.Authorize("server", "read"), controllers.GetServerFacts)
+		server.GET(":id/packages", middleware.Authorize("server", "read"), controllers.GetServerPackages)
 	}
 
 	trelloboard := router.Group("/trelloboard", middleware.Authenticate())
@@ -120,6 +159,7 @@ func StartService() {
 	data := router.Group("/data", middleware.Authenticate())
 	{
 		data.GET("patchWindows", middleware.Authorize("patchRun", "read"), controllers.GetPatchWindows)
+		data.GET("nodeCounts", middleware.Authorize("patchRun", "read"), controllers.GetNodeCounts)
 	}
 
 	config := router.Group("/config", middleware.Authenticate())
@@ -132,6 +172,29 @@ func StartService() {
 			role.POST(":name", middleware.Authorize("role", "write"), controllers.UpdateRole)
 		}
 
+		health := config.Group("/health")
+		{
+			health.GET("", middleware.Authorize("health", "read"), controllers.ListHealthChecks)
+			health.POST("", middleware.Authorize("health", "write"), controllers.RunHealthChecks)
+		}
+
+		settings := config.Group("/settings")
+		{
+			settings.GET("", middleware.Authorize("settings", "read"), controllers.GetSettings)
+			settings.PUT("", middleware.Authorize("settings", "write"), controllers.UpdateSettings)
+			settings.POST("", middleware.Authorize("settings", "write"), controllers.UpdateSettings)
+		}
+
+		patchWindow := config.Group("/patchWindow")
+		{
+			patchWindow.GET("", middleware.Authorize("patchWindow", "read"), controllers.ListPatchWindowCatalog)
+			patchWindow.POST("sync", middleware.Authorize("patchWindow", "write"), controllers.SyncPatchWindowCatalog)
+			patchWindow.GET(":id", middleware.Authorize("patchWindow", "read"), controllers.GetPatchWindow)
+			patchWindow.PUT(":id", middleware.Authorize("patchWindow", "write"), controllers.UpdatePatchWindow)
+			patchWindow.POST(":id", middleware.Authorize("patchWindow", "write"), controllers.UpdatePatchWindow)
+			patchWindow.DELETE(":id", middleware.Authorize("patchWindow", "delete"), controllers.DeletePatchWindow)
+		}
+
 		ChatRoom := config.Group("/ChatRoom")
 		{
 			ChatRoom.GET("", middleware.Authorize("chatRoom", "read"), controllers.ListChatRooms)
@@ -139,7 +202,7 @@ func StartService() {
 			ChatRoom.PUT(":id", middleware.Authorize("chatRoom", "write"), controllers.UpdateChatRoom)
 			ChatRoom.POST(":id", middleware.Authorize("chatRoom", "write"), controllers.UpdateChatRoom)
 			ChatRoom.DELETE(":id", middleware.Authorize("chatRoom", "delete"), controllers.DeleteChatRoom)
-			ChatRoom.GET(":id/test", middleware.Authorize("chatRoom", "read"), controllers.TestChatRoom)
+			ChatRoom.POST(":id/test", middleware.Authorize("chatRoom", "write"), controllers.TestChatRoom)
 		}
 
 		puppetServer := config.Group("/puppetServer")
@@ -150,6 +213,8 @@ func StartService() {
 			puppetServer.PUT(":id", middleware.Authorize("puppetServer", "write"), controllers.UpdatePuppetServer)
 			puppetServer.POST(":id", middleware.Authorize("puppetServer", "write"), controllers.UpdatePuppetServer)
 			puppetServer.DELETE(":id", middleware.Authorize("puppetServer", "delete"), controllers.DeletePuppetServer)
+			puppetServer.POST(":id/renewToken", middleware.Authorize("puppetServer", "write"), controllers.RenewPuppetServerToken)
+			puppetServer.POST(":id/test", middleware.Authorize("puppetServer", "write"), controllers.TestPuppetServer)
 
 			puppetServer.GET(":id/environments-pe", middleware.Authorize("puppetServer", "read"), controllers.GetPuppetServerEnvironmentsPE)
 			puppetServer.GET(":id/environments", middleware.Authorize("puppetServer", "read"), controllers.GetPuppetServerEnvironments)
@@ -164,11 +229,17 @@ func StartService() {
 			puppetServer.POST(":id/addTask", middleware.Authorize("puppetTask", "write"), controllers.AddPuppetTaskToServer)
 			puppetServer.POST(":id/associateTask", middleware.Authorize("puppetTask", "write"), controllers.AssociatePuppetTaskToServer)
 			puppetServer.POST(":id/disassociateTask", middleware.Authorize("puppetTask", "write"), controllers.DisassociatePuppetTaskFromServer)
+			puppetServer.GET(":id/importTasks", middleware.Authorize("puppetTask", "read"), controllers.GetPuppetServerImportTasks)
+			puppetServer.POST(":id/importTasks", middleware.Authorize("puppetTask", "write"), controllers.ImportPuppetServerTasks)
 
 			puppetServer.GET(":id/plans", middleware.Authorize("puppetPlan", "read"), controllers.GetPuppetServerPlans)
 			puppetServer.POST(":id/addPlan", middleware.Authorize("puppetPlan", "write"), controllers.AddPuppetPlanToServer)
 			puppetServer.POST(":id/associatePlan", middleware.Authorize("puppetPlan", "write"), controllers.AssociatePuppetPlanToServer)
 			puppetServer.POST(":id/disassociatePlan", middleware.Authorize("puppetPlan", "write"), controllers.DisassociatePuppetPlanFromServer)
+			puppetServer.GET(":id/importPlans", middleware.Authorize("puppetPlan", "read"), controllers.GetPuppetServerImportPlans)
+			puppetServer.POST(":id/importPlans", middleware.Authorize("puppetPlan", "write"), controllers.ImportPuppetServerPlans)
+
+			puppetServer.POST(":id/syncCatalog", middleware.Authorize("puppetServer", "write"), controllers.SyncPuppetServerCatalog)
 
 			puppetServer.GET(":id/job/:jobID", middleware.Authorize("puppetServer", "read"), controllers.GetPuppetServerJob)
 			puppetServer.GET(":id/jobReport/:jobID", middleware.Authorize("puppetServer", "read"), controllers.GetPuppetServerJobReport)
@@ -182,6 +253,7 @@ func StartService() {
 			puppetTask.PUT(":id", middleware.Authorize("puppetTask", "write"), controllers.UpdatePuppetTask)
 			puppetTask.POST(":id", middleware.Authorize("puppetTask", "write"), controllers.UpdatePuppetTask)
 			puppetTask.POST(":id/updateFromAPI", middleware.Authorize("puppetTask", "write"), controllers.UpdatePuppetTaskFromAPI)
+			puppetTask.GET(":id/metadata", middleware.Authorize("puppetTask", "read"), controllers.GetPuppetTaskMetadata)
 			puppetTask.DELETE(":id", middleware.Authorize("puppetTask", "delete"), controllers.DeletePuppetTask)
 		}
 
@@ -201,6 +273,7 @@ func StartService() {
 			puppetPlan.PUT(":id", middleware.Authorize("puppetPlan", "write"), controllers.UpdatePuppetPlan)
 			puppetPlan.POST(":id", middleware.Authorize("puppetPlan", "write"), controllers.UpdatePuppetPlan)
 			puppetPlan.POST(":id/updateFromAPI", middleware.Authorize("puppetPlan", "write"), controllers.UpdatePuppetPlanFromAPI)
+			puppetPlan.GET(":id/metadata", middleware.Authorize("puppetPlan", "read"), controllers.GetPuppetPlanMetadata)
 			puppetPlan.DELETE(":id", middleware.Authorize("puppetPlan", "delete"), controllers.DeletePuppetPlan)
 		}
 
@@ -222,6 +295,7 @@ func StartService() {
 			jenkinsServer.DELETE(":id", middleware.Authorize("jenkinsServer", "delete"), controllers.DeleteJenkinsServer)
 
 			jenkinsServer.GET(":id/info", middleware.Authorize("jenkinsServer", "read"), controllers.GetJenkinsServerInfo)
+			jenkinsServer.POST(":id/test", middleware.Authorize("jenkinsServer", "write"), controllers.TestJenkinsServer)
 
 			jenkinsServer.GET(":id/apiJobs", middleware.Authorize("jenkinsServer", "read"), controllers.GetJenkinsAPIJobs)
 			jenkinsServer.GET(":id/apiJobs/*path", middleware.Authorize("jenkinsServer", "read"), controllers.GetJenkinsAPIJobs)
@@ -251,6 +325,9 @@ func StartService() {
 		}
 	} // END config group
 
+	controllers.StartHealthChecks()
+	controllers.StartCatalogSync()
+
 	log.Info("Starting server.")
 	err := router.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
 	if err != nil {
@@ -35,6 +35,10 @@ func OutputServerCSV(apps models.Applications) (out *bytes.Buffer, err error) {
 		"SecurityUpdates",
 		"PatchWindow",
 		"VMName",
+		"Excluded",
+		"DriftStatus",
+		"PinnedPackages",
+		"BlockedPackages",
 	})
 	for _, app := range apps {
 		for _, env := range app.GetEnvironments() {
@@ -52,6 +56,10 @@ func OutputServerCSV(apps models.Applications) (out *bytes.Buffer, err error) {
 						fmt.Sprint(server.SecurityUpdates),
 						server.PatchWindow,
 						server.VMName,
+						fmt.Sprint(server.Excluded),
+						server.DriftStatus,
+						strings.Join(server.PinnedPackages, " "),
+						strings.Join(server.BlockedPackages, " "),
 					})
 					if err != nil {
 						return
@@ -65,6 +73,31 @@ func OutputServerCSV(apps models.Applications) (out *bytes.Buffer, err error) {
 	return
 }
 
+// OutputFactSnapshotCSV outputs a CSV of the fact snapshots (value of each fact at each stage)
+func OutputFactSnapshotCSV(diffs []*models.FactDiff) (out *bytes.Buffer, err error) {
+	out = new(bytes.Buffer)
+	writer := csv.NewWriter(out)
+
+	header := []string{"ServerName", "Fact"}
+	for _, stage := range models.SnapshotStages {
+		header = append(header, stage)
+	}
+	_ = writer.Write(append(header, "Changed"))
+	for _, diff := range diffs {
+		record := []string{diff.Certname, diff.Fact}
+		for _, stage := range models.SnapshotStages {
+			record = append(record, diff.Values[stage])
+		}
+		err = writer.Write(append(record, fmt.Sprint(diff.Changed)))
+		if err != nil {
+			return
+		}
+	}
+	writer.Flush()
+	err = writer.Error()
+	return
+}
+
 // OutputServerList outputs a list of servers in apps
 // ... used for the Jenkins Job to silence monitoring and possibly SNOW
 func OutputServerList(apps models.Applications) (out string) {